@@ -18,6 +18,7 @@ package v1beta1
 
 import (
 	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,24 +32,254 @@ type AppWrapperSpec struct {
 	// Priority slope
 	DoNotUsePrioritySlope resource.Quantity `json:"priorityslope,omitempty"`
 
+	// Workload type: Batch workloads run to completion, Service workloads run until deleted
+	// +kubebuilder:validation:Enum=Batch;Service
+	// +kubebuilder:default=Batch
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
 	// Scheduling specification
 	Scheduling SchedulingSpec `json:"schedulingSpec,omitempty"`
 
+	// Retry policy: Always requeues failed AppWrappers up to max requeuings
+	// Never fails the AppWrapper on the first failure, including the first failed pod
+	// OnInfraFailureOnly fails the AppWrapper on the first workload failure and requeues it on infrastructure failures
+	// +kubebuilder:validation:Enum=Always;Never;OnInfraFailureOnly
+	// +kubebuilder:default=Always
+	RetryPolicy RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// Maximum time since creation covering queuing, running, and requeuings before the AppWrapper fails (unlimited if zero)
+	// +kubebuilder:validation:Minimum=0
+	MaxLifetimeSeconds int64 `json:"maxLifetimeSeconds,omitempty"`
+
+	// Hibernation specification, only applies to Service workloads
+	Hibernation HibernationSpec `json:"hibernation,omitempty"`
+
+	// Checkpoint specification, checkpoint before requeuing and restore after dispatching again if not nil
+	Checkpoint *CheckpointSpec `json:"checkpoint,omitempty"`
+
+	// Jobs run by MCAD at specific points of the AppWrapper lifecycle
+	Hooks *HooksSpec `json:"hooks,omitempty"`
+
 	// Wrapped resources
 	Resources AppWrapperResources `json:"resources"`
+
+	// Isolate AppWrapper pods with a NetworkPolicy if not nil
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// Create a headless Service and a ConfigMap listing peer host names for the wrapped pods
+	// The AppWrapper name must be a valid DNS label
+	PeerDiscovery bool `json:"peerDiscovery,omitempty"`
+
+	// Copy the ConfigMaps and Secrets referenced by wrapped pods at first dispatch
+	// and use these copies for the lifetime of the AppWrapper, only applies to the local cluster
+	SnapshotReferences bool `json:"snapshotReferences,omitempty"`
+
+	// Service account to inject into wrapped pods if not empty
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Scheduler to inject into wrapped pods if not empty
+	SchedulerName string `json:"schedulerName,omitempty"`
+
+	// Image pull secrets to inject into wrapped pods
+	ImagePullSecrets []v1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Node selector to inject into wrapped pods and restrict the capacity available to the AppWrapper
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations to inject into wrapped pods and take into account to compute the capacity available to the AppWrapper
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// GPU type matching the nvidia.com/gpu.product node label if not empty
+	// Restricts wrapped pods and GPU capacity to nodes with this GPU type
+	GPUType string `json:"gpuType,omitempty"`
+
+	// Topology constraints to inject into wrapped pods if not nil
+	Placement *PlacementSpec `json:"placement,omitempty"`
+
+	// Data dependencies to take into account for dispatching and placement if not nil
+	Data *DataSpec `json:"data,omitempty"`
+
+	// Constraints and preferences on the dispatch target if not nil
+	Clusters *ClusterSpec `json:"clusters,omitempty"`
+
+	// Pull images on candidate nodes before checking pod counts
+	PrePullImages bool `json:"prePullImages,omitempty"`
+
+	// Increment to tear down and requeue a running AppWrapper
+	RestartGeneration int64 `json:"restartGeneration,omitempty"`
 }
 
+// WorkloadType is the type of the wrapped workload
+type WorkloadType string
+
+const (
+	// Workload runs to completion
+	Batch WorkloadType = "Batch"
+
+	// Workload never completes, e.g., a Deployment
+	Service WorkloadType = "Service"
+)
+
+// RetryPolicy is the response to failures of the AppWrapper
+type RetryPolicy string
+
+const (
+	// Requeue on failures up to max requeuings
+	RetryAlways RetryPolicy = "Always"
+
+	// Fail on the first failure
+	RetryNever RetryPolicy = "Never"
+
+	// Fail on the first workload failure, requeue on infrastructure failures up to max requeuings
+	RetryOnInfraFailureOnly RetryPolicy = "OnInfraFailureOnly"
+)
+
 type SchedulingSpec struct {
 	// Minimum number of expected running and successful pods
 	MinAvailable int32 `json:"minAvailable,omitempty"`
 
+	// Policy for assessing success from pod counts
+	// MinAvailable requires MinAvailable succeeded pods and no other pods
+	// All requires all expected pods to succeed
+	// AtLeast requires MinSucceeded succeeded pods and tolerates failed pods
+	// Any requires one succeeded pod and tolerates failed pods
+	// Remaining pods are deleted upon success
+	// +kubebuilder:validation:Enum=MinAvailable;All;AtLeast;Any
+	// +kubebuilder:default=MinAvailable
+	SuccessPolicy SuccessPolicy `json:"successPolicy,omitempty"`
+
+	// Minimum number of succeeded pods for AtLeast success policy
+	MinSucceeded int32 `json:"minSucceeded,omitempty"`
+
 	// Requeuing specification
 	Requeuing RequeuingSpec `json:"requeuing,omitempty"`
 
 	// Enable forced deletion after delay if nonzero
 	ForceDeletionTimeInSeconds int64 `json:"forceDeletionTimeInSeconds,omitempty"`
+
+	// Verify that pods can be scheduled using probe pods before creating wrapped resources
+	VerifyPlacement bool `json:"verifyPlacement,omitempty"`
+
+	// Report a queue SLO violation if queued for longer than this delay if nonzero
+	MaxQueueTimeInSeconds int64 `json:"maxQueueTimeInSeconds,omitempty"`
+
+	// Preemption specification, only applies if preemption is enabled
+	Preemption PreemptionSpec `json:"preemption,omitempty"`
+
+	// Dispatch with elastic resources at their minimum replica counts if the total request does not fit
+	// The replicas above the minimum are burst capacity added once free and reclaimed by preemption
+	StartAtMinimum bool `json:"startAtMinimum,omitempty"`
+}
+
+type PreemptionSpec struct {
+	// Whether the AppWrapper may preempt lower-priority AppWrappers: Never or LowerPriority
+	// +kubebuilder:validation:Enum=Never;LowerPriority
+	// +kubebuilder:default=LowerPriority
+	Preempt PreemptionPolicy `json:"preempt,omitempty"`
+
+	// Whether the AppWrapper may be preempted by higher-priority AppWrappers: Never, LowerPriority, or CostBased
+	// CostBased only permits preemption while the cost of preempting the AppWrapper does not exceed MaxCostInSeconds
+	// +kubebuilder:validation:Enum=Never;LowerPriority;CostBased
+	// +kubebuilder:default=LowerPriority
+	Preemptible PreemptionPolicy `json:"preemptible,omitempty"`
+
+	// Maximum cost of preempting the AppWrapper for CostBased, i.e., the running time lost since last dispatch
+	MaxCostInSeconds int64 `json:"maxCostInSeconds,omitempty"`
 }
 
+// PreemptionPolicy is the policy for preempting or being preempted
+type PreemptionPolicy string
+
+const (
+	// Never preempt or be preempted
+	NeverPreempt PreemptionPolicy = "Never"
+
+	// Preempt or be preempted by AppWrappers with a lower or higher priority respectively
+	LowerPriorityPreempt PreemptionPolicy = "LowerPriority"
+
+	// Be preempted by higher-priority AppWrappers while the preemption cost does not exceed a threshold
+	CostBasedPreempt PreemptionPolicy = "CostBased"
+)
+
+// SuccessPolicy is the policy for assessing success from pod counts
+type SuccessPolicy string
+
+const (
+	// Require MinAvailable succeeded pods and no other pods
+	MinAvailableSucceeded SuccessPolicy = "MinAvailable"
+
+	// Require all expected pods to succeed
+	AllSucceeded SuccessPolicy = "All"
+
+	// Require MinSucceeded succeeded pods
+	AtLeastSucceeded SuccessPolicy = "AtLeast"
+
+	// Require one succeeded pod
+	AnySucceeded SuccessPolicy = "Any"
+)
+
+type HibernationSpec struct {
+	// Scale wrapped resources to zero replicas
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// Release the capacity reserved for the AppWrapper while hibernated, waking up then requires dispatching again
+	ReleaseCapacity bool `json:"releaseCapacity,omitempty"`
+}
+
+// Output artifact
+type Artifact struct {
+	// Artifact name
+	Name string `json:"name"`
+
+	// Artifact location, e.g., an object storage URI or a model registry ID
+	URI string `json:"uri"`
+}
+
+type CheckpointSpec struct {
+	// Base location of checkpoints, e.g., a mounted volume path or an object storage URI
+	Path string `json:"path"`
+
+	// Time given to wrapped pods to write a checkpoint before deleting wrapped resources
+	// +kubebuilder:default=60
+	GracePeriodInSeconds int64 `json:"gracePeriodInSeconds,omitempty"`
+}
+
+type HooksSpec struct {
+	// Hook run at each dispatch before wrapped resources are created, resources are only created once it succeeds
+	PreDispatch *HookSpec `json:"preDispatch,omitempty"`
+
+	// Hook run once the AppWrapper succeeds or fails, before its wrapped resources are deleted
+	OnCompletion *HookSpec `json:"onCompletion,omitempty"`
+}
+
+type HookSpec struct {
+	// Job template, the Job is created in the namespace of the AppWrapper on the local cluster
+	// +optional
+	Template runtime.RawExtension `json:"template,omitempty"`
+
+	// URL of a webhook called with a POST request instead of running a Job
+	URL string `json:"url,omitempty"`
+
+	// Time given to the Job to complete, unlimited if zero, or to each webhook call, ten seconds if zero
+	TimeoutInSeconds int64 `json:"timeoutInSeconds,omitempty"`
+
+	// Treatment of hook failures and timeouts
+	// +kubebuilder:validation:Enum=Ignore;Fail
+	// +kubebuilder:default=Ignore
+	FailurePolicy HookFailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// Treatment of hook failures and timeouts
+type HookFailurePolicy string
+
+const (
+	// Report the failure and proceed
+	IgnoreHookFailure HookFailurePolicy = "Ignore"
+
+	// Report the failure and fail the AppWrapper
+	FailOnHookFailure HookFailurePolicy = "Fail"
+)
+
 type RequeuingSpec struct {
 	// Initial waiting time before requeuing conditions are checked
 	// +kubebuilder:default=300
@@ -59,6 +290,61 @@ type RequeuingSpec struct {
 
 	// Max requeuings permitted (infinite if zero)
 	MaxNumRequeuings int32 `json:"maxNumRequeuings,omitempty"`
+
+	// Waiting time during which pods running init containers count as progressing (unlimited if zero)
+	InitTimeInSeconds int64 `json:"initTimeInSeconds,omitempty"`
+}
+
+type NetworkPolicySpec struct {
+	// Egress rules permitted in addition to traffic between AppWrapper pods
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+type PlacementSpec struct {
+	// Node label defining topology domains, e.g., topology.kubernetes.io/zone
+	TopologyKey string `json:"topologyKey"`
+
+	// Pack all pods into one topology domain or spread pods evenly across domains
+	// +kubebuilder:validation:Enum=Pack;Spread
+	// +kubebuilder:default=Pack
+	Policy PlacementPolicy `json:"policy,omitempty"`
+}
+
+// PlacementPolicy is the topology policy for wrapped pods
+type PlacementPolicy string
+
+const (
+	// Require all pods to run in the same topology domain
+	Pack PlacementPolicy = "Pack"
+
+	// Spread pods evenly across topology domains
+	Spread PlacementPolicy = "Spread"
+)
+
+type DataSpec struct {
+	// PersistentVolumeClaims in the AppWrapper namespace holding the data
+	PersistentVolumeClaims []string `json:"persistentVolumeClaims,omitempty"`
+
+	// Labels of the nodes hosting the data, e.g., a dataset label
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+type ClusterSpec struct {
+	// Labels a dispatch target must have to be eligible
+	Selector map[string]string `json:"selector,omitempty"`
+
+	// Preferred dispatch targets, eligible targets are ranked by the sum of the weights of their matching preferences
+	Preferences []ClusterPreference `json:"preferences,omitempty"`
+}
+
+type ClusterPreference struct {
+	// Weight of the preference
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Labels a dispatch target must have to match the preference
+	MatchLabels map[string]string `json:"matchLabels"`
 }
 
 // AppWrapperStatus defines the observed state of AppWrapper
@@ -66,23 +352,225 @@ type AppWrapperStatus struct {
 	// Phase
 	Phase AppWrapperPhase `json:"state,omitempty"`
 
+	// User who created the AppWrapper as recorded by the admission webhook
+	Submitter string `json:"submitter,omitempty"`
+
 	// Status of wrapped resources
 	Step AppWrapperStep `json:"step,omitempty"`
 
+	// Reason code of the failure if the AppWrapper failed
+	FailureReason FailureReason `json:"failureReason,omitempty"`
+
 	// When last dispatched
 	DispatchTimestamp metav1.Time `json:"dispatchTimestamp,omitempty"`
 
+	// Target the AppWrapper was last dispatched to, empty for the local cluster
+	Target string `json:"target,omitempty"`
+
+	// Placement scores of the dispatch targets considered when last dispatched if dispatch targets are configured
+	PlacementScores []PlacementScore `json:"placementScores,omitempty"`
+
 	// When last requeued
 	RequeueTimestamp metav1.Time `json:"requeueTimestamp,omitempty"`
 
+	// When images were last pulled on candidate nodes
+	PrePullTimestamp metav1.Time `json:"prePullTimestamp,omitempty"`
+
+	// Output artifacts reported by wrapped workloads upon completion
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+
+	// Location of the last checkpoint requested before requeuing
+	CheckpointPath string `json:"checkpointPath,omitempty"`
+
+	// When the last checkpoint was requested
+	CheckpointTimestamp metav1.Time `json:"checkpointTimestamp,omitempty"`
+
 	// How many times restarted
 	Restarts int32 `json:"restarts"`
 
+	// Pending migration to another target if any
+	Migration *MigrationStatus `json:"migration,omitempty"`
+
+	// How many times migrated, migrations do not count against the requeuing budget
+	Migrations int32 `json:"migrations,omitempty"`
+
+	// Requeued by a Drain DispatchControl, drains do not count against the requeuing budget
+	Drained bool `json:"drained,omitempty"`
+
+	// Restart generation observed when last dispatched or restarted
+	RestartGeneration int64 `json:"restartGeneration,omitempty"`
+
+	// Name of the DispatchControl expediting the queued AppWrapper if any
+	ExpeditedBy string `json:"expeditedBy,omitempty"`
+
 	// Transition log
 	Transitions []AppWrapperTransition `json:"transitions,omitempty"`
 
 	// Number of transitions
 	TransitionCount int32 `json:"transitionCount,omitempty"`
+
+	// Dispatch and requeue log, bounded to the most recent records
+	DispatchHistory []DispatchRecord `json:"dispatchHistory,omitempty"`
+
+	// Dashboard URL of wrapped resources if any
+	DashboardURL string `json:"dashboardURL,omitempty"`
+
+	// Status of each pod set, i.e., pods created from the same pod template
+	PodSets []PodSetStatus `json:"podSets,omitempty"`
+
+	// Elastic wrapped resources shrunk to make room for higher-priority AppWrappers or dispatched at their minimum
+	Shrunk []ShrunkResource `json:"shrunk,omitempty"`
+
+	// Wrapped resources created by the agent of a pull-based dispatch target and their observed status
+	// Only set on the AppWrappers assigned to the agent
+	ReportedResources []ReportedResource `json:"reportedResources,omitempty"`
+
+	// Conditions
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Placement score of one dispatch target
+type PlacementScore struct {
+	// Target name, empty for the local cluster
+	Target string `json:"target,omitempty"`
+
+	// Combined score of cluster preferences, target score modifiers, and free capacity, higher is better
+	Score string `json:"score"`
+
+	// Reason the target was not selected if any
+	Reason string `json:"reason,omitempty"`
+}
+
+// Migration of a running AppWrapper from one target to another
+type MigrationStatus struct {
+	// Target the AppWrapper is migrated from, empty for the local cluster
+	From string `json:"from,omitempty"`
+
+	// Target the AppWrapper is migrated to, "local" for the local cluster, any other target if empty
+	To string `json:"to,omitempty"`
+
+	// Why the AppWrapper is migrated
+	Reason string `json:"reason,omitempty"`
+
+	// When the migration was requested
+	Timestamp metav1.Time `json:"timestamp"`
+}
+
+// Elastic wrapped resource shrunk to make room for a higher-priority AppWrapper
+type ShrunkResource struct {
+	// Index of the resource in GenericItems
+	Index int32 `json:"index"`
+
+	// Replica count of the shrunk resource
+	Replicas int32 `json:"replicas"`
+
+	// Namespace and name of the AppWrapper the resource was shrunk for, empty if dispatched at its minimum
+	PreemptedBy string `json:"preemptedBy,omitempty"`
+}
+
+// Wrapped resource reported by the agent of a pull-based dispatch target
+type ReportedResource struct {
+	// API version
+	APIVersion string `json:"apiVersion"`
+
+	// Kind
+	Kind string `json:"kind"`
+
+	// Namespace
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name
+	Name string `json:"name"`
+
+	// Last observed status of the resource
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	Status runtime.RawExtension `json:"status,omitempty"`
+}
+
+// Dispatch or requeue record
+type DispatchRecord struct {
+	// When dispatched or requeued
+	Time metav1.Time `json:"time"`
+
+	// Dispatched or Requeued
+	Action DispatchRecordAction `json:"action"`
+
+	// Reason for requeuing
+	Reason string `json:"reason,omitempty"`
+
+	// Target the AppWrapper was dispatched to, empty for the local cluster
+	Target string `json:"target,omitempty"`
+}
+
+// DispatchRecordAction is the action of a dispatch record
+type DispatchRecordAction string
+
+const (
+	// AppWrapper was dispatched
+	Dispatched DispatchRecordAction = "Dispatched"
+
+	// AppWrapper was requeued
+	Requeued DispatchRecordAction = "Requeued"
+)
+
+// FailureReason is the reason code of a failed AppWrapper
+type FailureReason string
+
+const (
+	// Wrapped resources could not be parsed or mapped to known kinds
+	ResourceParsingFailed FailureReason = "ResourceParsingFailed"
+
+	// Creation of wrapped resources was refused by policy
+	CreationForbidden FailureReason = "CreationForbidden"
+
+	// Pods or wrapped resources failed or too few pods were healthy
+	PodsFailed FailureReason = "PodsFailed"
+
+	// Wrapped resources ran out of time
+	DeadlineExceeded FailureReason = "DeadlineExceeded"
+
+	// AppWrapper exceeded its max lifetime
+	LifetimeExceeded FailureReason = "LifetimeExceeded"
+
+	// Max requeuings exhausted
+	RetriesExhausted FailureReason = "RetriesExhausted"
+
+	// AppWrapper was preempted with no requeuing left
+	Preempted FailureReason = "Preempted"
+
+	// Pre-dispatch or completion hook failed
+	HookFailed FailureReason = "HookFailed"
+
+	// AppWrapper was failed by an administrator
+	Flushed FailureReason = "Flushed"
+)
+
+// Pod set status
+type PodSetStatus struct {
+	// Pod set name
+	Name string `json:"name"`
+
+	// Expected number of pods
+	Expected int32 `json:"expected"`
+
+	// Number of running pods
+	Running int32 `json:"running"`
+
+	// Number of succeeded pods
+	Succeeded int32 `json:"succeeded"`
+
+	// Number of failed pods
+	Failed int32 `json:"failed"`
+
+	// Number of pods in other phases
+	Other int32 `json:"other"`
+
+	// Number of pods running init containers, included in other phases
+	Initializing int32 `json:"initializing,omitempty"`
 }
 
 // AppWrapperPhase is the label for the AppWrapper status
@@ -95,6 +583,9 @@ const (
 	// Initial state upon creation of the AppWrapper object
 	Empty AppWrapperPhase = ""
 
+	// AppWrapper passed validation and awaits admission checks before being queued
+	Admitting AppWrapperPhase = "Admitting"
+
 	// AppWrapper has not been dispatched yet or has been requeued
 	Queued AppWrapperPhase = "Pending"
 
@@ -107,6 +598,9 @@ const (
 	// AppWrapper failed and is not requeued
 	Failed AppWrapperPhase = "Failed"
 
+	// AppWrapper was not admitted and never queued
+	Rejected AppWrapperPhase = "Rejected"
+
 	// Resources are not deployed
 	Idle AppWrapperStep = ""
 
@@ -118,6 +612,9 @@ const (
 
 	// MCAD is in the process of deleting the wrapped resources
 	Deleting AppWrapperStep = "deleting"
+
+	// The wrapped resources have been scaled to zero replicas
+	Hibernated AppWrapperStep = "hibernated"
 )
 
 // AppWrapper resources
@@ -136,10 +633,56 @@ type GenericItem struct {
 	// A comma-separated list of keywords to match against condition types
 	CompletionStatus string `json:"completionstatus,omitempty"`
 
-	// Resource template
-	GenericTemplate runtime.RawExtension `json:"generictemplate"`
+	// Completion of this resource determines completion of the AppWrapper, other resources are then deleted
+	Leader bool `json:"leader,omitempty"`
+
+	// Replica count the resource may be shrunk to in order to make room for higher-priority AppWrappers
+	// Only applies to resources with a spec.replicas field and one custompodresources entry, not elastic if zero
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+
+	// Treatment of succeeded pods of this resource in running pod count checks
+	// Count succeeded pods toward MinAvailable (default) or ignore them
+	// +kubebuilder:validation:Enum=Count;Ignore
+	// +kubebuilder:default=Count
+	SucceededPods SucceededPodsPolicy `json:"succeededPods,omitempty"`
+
+	// Resource template, may be omitted if offloaded
+	// +optional
+	GenericTemplate runtime.RawExtension `json:"generictemplate,omitempty"`
+
+	// Reference to ConfigMap key holding the resource template if offloaded
+	GenericTemplateRef *v1.ConfigMapKeySelector `json:"generictemplateref,omitempty"`
+
+	// Encoding of the compressed resource template, the template is not compressed if empty
+	// +kubebuilder:validation:Enum=gzip
+	ContentEncoding ContentEncoding `json:"contentEncoding,omitempty"`
+
+	// Compressed resource template, used instead of the resource template if content encoding is set
+	CompressedTemplate []byte `json:"compressedtemplate,omitempty"`
+
+	// Base64-encoded signature of the resource template in canonical JSON form, required if payload verification is enabled
+	Signature string `json:"signature,omitempty"`
 }
 
+// ContentEncoding is the encoding of a compressed resource template
+type ContentEncoding string
+
+const (
+	// Gzip-compressed template, base64-encoded in JSON
+	Gzip ContentEncoding = "gzip"
+)
+
+// SucceededPodsPolicy is the treatment of succeeded pods in running pod count checks
+type SucceededPodsPolicy string
+
+const (
+	// Count succeeded pods toward MinAvailable
+	CountSucceededPods SucceededPodsPolicy = "Count"
+
+	// Ignore succeeded pods
+	IgnoreSucceededPods SucceededPodsPolicy = "Ignore"
+)
+
 // Resource requests
 type CustomPodResource struct {
 	// Replica count
@@ -160,6 +703,9 @@ type AppWrapperTransition struct {
 	// Reason
 	Reason string `json:"reason,omitempty"`
 
+	// Reason code, only set on transitions to the Failed phase
+	Code FailureReason `json:"code,omitempty"`
+
 	// Phase entered
 	Phase AppWrapperPhase `json:"state"`
 
@@ -171,6 +717,7 @@ type AppWrapperTransition struct {
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.state`
 //+kubebuilder:printcolumn:name="Restarts",type="integer",JSONPath=`.status.restarts`
+//+kubebuilder:printcolumn:name="Target",type="string",JSONPath=`.status.target`,priority=1
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // AppWrapper is the Schema for the appwrappers API
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Annotation exempting an AppWrapper from queue limits, GPU quotas, and namespace quotas on dispatch targets
+// The AppWrapper must still fit the cluster capacity
+const QuotaExemptAnnotation = "workload.codeflare.dev/quota-exempt"
+
+// Annotation recording the user who created the AppWrapper, AppWrapperSet, or CronAppWrapper
+// The annotation is set by the mutating webhook on creation and cannot be modified
+// AppWrappers generated from an AppWrapperSet or CronAppWrapper are attributed to the submitter of their owner
+const SubmitterAnnotation = "workload.codeflare.dev/submitter"
+
+// AppWrapperValidator validates AppWrapper admission requests and records the submitter of AppWrappers,
+// AppWrapperSets, and CronAppWrappers
+// +kubebuilder:object:generate=false
+type AppWrapperValidator struct {
+	// Users allowed to add or modify the quota exemption annotation
+	QuotaExemptUsers []string
+
+	// Prefixes of the URLs allowed for webhook hooks, webhook hooks are rejected if empty
+	HookURLPrefixes []string
+}
+
+// User name of a service account
+func ServiceAccountUser(namespace string, name string) string {
+	return "system:serviceaccount:" + namespace + ":" + name
+}
+
+// SetupWebhookWithManager sets up the webhooks with the Manager.
+func (v *AppWrapperValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	for _, obj := range []runtime.Object{&AppWrapper{}, &AppWrapperSet{}, &CronAppWrapper{}} {
+		if err := ctrl.NewWebhookManagedBy(mgr).
+			For(obj).
+			WithDefaulter(v).
+			WithValidator(v).
+			Complete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//+kubebuilder:webhook:path=/mutate-workload-codeflare-dev-v1beta1-appwrapper,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=appwrappers,verbs=create,versions=v1beta1,name=mappwrapper.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-workload-codeflare-dev-v1beta1-appwrapperset,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=appwrappersets,verbs=create,versions=v1beta1,name=mappwrapperset.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/mutate-workload-codeflare-dev-v1beta1-cronappwrapper,mutating=true,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=cronappwrappers,verbs=create,versions=v1beta1,name=mcronappwrapper.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &AppWrapperValidator{}
+
+// Default implements admission.CustomDefaulter
+// Overwrite the submitter annotation with the requesting user so it cannot be spoofed
+func (v *AppWrapperValidator) Default(ctx context.Context, obj runtime.Object) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	object := obj.(metav1.Object)
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[SubmitterAnnotation] = req.UserInfo.Username
+	object.SetAnnotations(annotations)
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-workload-codeflare-dev-v1beta1-appwrapper,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=appwrappers,verbs=create;update,versions=v1beta1,name=vappwrapper.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-workload-codeflare-dev-v1beta1-appwrapperset,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=appwrappersets,verbs=update,versions=v1beta1,name=vappwrapperset.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-workload-codeflare-dev-v1beta1-cronappwrapper,mutating=false,failurePolicy=fail,sideEffects=None,groups=workload.codeflare.dev,resources=cronappwrappers,verbs=update,versions=v1beta1,name=vcronappwrapper.kb.io,admissionReviewVersions=v1
+
+var _ admission.CustomValidator = &AppWrapperValidator{}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *AppWrapperValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	appWrapper, ok := obj.(*AppWrapper)
+	if !ok {
+		return nil, nil
+	}
+	if err := v.checkHookURLs(appWrapper); err != nil {
+		return nil, err
+	}
+	if _, ok := appWrapper.Annotations[QuotaExemptAnnotation]; ok {
+		return nil, v.checkQuotaExemptUser(ctx)
+	}
+	return nil, nil
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *AppWrapperValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	if oldObj.(metav1.Object).GetAnnotations()[SubmitterAnnotation] != newObj.(metav1.Object).GetAnnotations()[SubmitterAnnotation] {
+		return nil, fmt.Errorf("annotation %s is immutable", SubmitterAnnotation)
+	}
+	appWrapper, ok := newObj.(*AppWrapper)
+	if !ok {
+		return nil, nil
+	}
+	if err := v.checkHookURLs(appWrapper); err != nil {
+		return nil, err
+	}
+	oldValue, oldOk := oldObj.(*AppWrapper).Annotations[QuotaExemptAnnotation]
+	newValue, newOk := appWrapper.Annotations[QuotaExemptAnnotation]
+	if newOk && (!oldOk || oldValue != newValue) {
+		return nil, v.checkQuotaExemptUser(ctx)
+	}
+	return nil, nil
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *AppWrapperValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// Check that the requesting user may exempt AppWrappers from quotas
+func (v *AppWrapperValidator) checkQuotaExemptUser(ctx context.Context) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range v.QuotaExemptUsers {
+		if req.UserInfo.Username == user {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s is not allowed to set annotation %s", req.UserInfo.Username, QuotaExemptAnnotation)
+}
+
+// Check that the webhook hooks of the AppWrapper call allowed URLs
+func (v *AppWrapperValidator) checkHookURLs(appWrapper *AppWrapper) error {
+	if appWrapper.Spec.Hooks == nil {
+		return nil
+	}
+	for _, spec := range []*HookSpec{appWrapper.Spec.Hooks.PreDispatch, appWrapper.Spec.Hooks.OnCompletion} {
+		if spec != nil && spec.URL != "" && !HookURLAllowed(spec.URL, v.HookURLPrefixes) {
+			return fmt.Errorf("hook url %s is not allowed", spec.URL)
+		}
+	}
+	return nil
+}
+
+// Check whether a webhook hook URL starts with one of the allowed prefixes
+// URLs with user info or dot segments are refused since they may escape the prefix
+func HookURLAllowed(rawURL string, prefixes []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(rawURL, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AppWrapperSetSpec defines the AppWrappers generated from a template
+// An AppWrapperSet with replicas is an array job, each index is an independent shard dispatched as capacity allows
+type AppWrapperSetSpec struct {
+	// Template of generated AppWrappers
+	// Placeholders <APPWRAPPER_INDEX> and <PARAM_key> in wrapped resources are replaced
+	// with the index of the AppWrapper in the set and the values of its parameters
+	Template AppWrapperTemplate `json:"template"`
+
+	// Number of AppWrappers to generate if no parameter sets are specified
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Parameter sets, one AppWrapper is generated per parameter set
+	Parameters []map[string]string `json:"parameters,omitempty"`
+}
+
+// AppWrapperTemplate describes the AppWrappers generated by an AppWrapperSet
+type AppWrapperTemplate struct {
+	// Labels and annotations of generated AppWrappers
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec of generated AppWrappers
+	Spec AppWrapperSpec `json:"spec"`
+}
+
+// AppWrapperSetStatus aggregates the status of the generated AppWrappers
+type AppWrapperSetStatus struct {
+	// Number of AppWrappers in the set
+	Total int32 `json:"total"`
+
+	// Number of queued AppWrappers
+	Queued int32 `json:"queued"`
+
+	// Number of running AppWrappers
+	Running int32 `json:"running"`
+
+	// Number of succeeded AppWrappers
+	Succeeded int32 `json:"succeeded"`
+
+	// Number of failed AppWrappers
+	Failed int32 `json:"failed"`
+
+	// Indexes of succeeded AppWrappers as comma-separated ranges, e.g., 0-3,7
+	CompletedIndexes string `json:"completedIndexes,omitempty"`
+
+	// Indexes of failed AppWrappers as comma-separated ranges
+	FailedIndexes string `json:"failedIndexes,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Total",type="integer",JSONPath=`.status.total`
+//+kubebuilder:printcolumn:name="Queued",type="integer",JSONPath=`.status.queued`
+//+kubebuilder:printcolumn:name="Running",type="integer",JSONPath=`.status.running`
+//+kubebuilder:printcolumn:name="Succeeded",type="integer",JSONPath=`.status.succeeded`
+//+kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=`.status.failed`
+//+kubebuilder:printcolumn:name="Completed Indexes",type="string",JSONPath=`.status.completedIndexes`,priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// AppWrapperSet is the Schema for the appwrappersets API
+type AppWrapperSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AppWrapperSetSpec   `json:"spec,omitempty"`
+	Status AppWrapperSetStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AppWrapperSetList contains a list of AppWrapperSet
+type AppWrapperSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AppWrapperSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AppWrapperSet{}, &AppWrapperSetList{})
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterInfoSpec defines the desired state of ClusterInfo
+type ClusterInfoSpec struct {
+}
+
+// ClusterInfoStatus is the capacity ledger of the dispatcher
+type ClusterInfoStatus struct {
+	// When the ledger was last refreshed
+	Time metav1.Time `json:"time,omitempty"`
+
+	// Cluster capacity available to MCAD
+	// Allocatable capacity of schedulable nodes minus requests of non-AppWrapper pods and safety margins
+	Capacity v1.ResourceList `json:"capacity,omitempty"`
+
+	// Resources reserved and free capacity at each priority level
+	Reservations []ReservationStatus `json:"reservations,omitempty"`
+
+	// Resources allocated to each dispatched AppWrapper
+	Allocations []AllocationStatus `json:"allocations,omitempty"`
+
+	// Fairness report for each namespace with dispatched or queued AppWrappers
+	Namespaces []NamespaceStatus `json:"namespaces,omitempty"`
+
+	// Capacity of the local cluster and each dispatch target if dispatch targets are configured
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// Sum of the capacities of the local cluster and all dispatch targets if dispatch targets are configured
+	AggregateCapacity v1.ResourceList `json:"aggregateCapacity,omitempty"`
+}
+
+// Capacity of one dispatch target
+type TargetStatus struct {
+	// Target name, empty for the local cluster
+	Name string `json:"name,omitempty"`
+
+	// When the target capacity was last refreshed
+	Time metav1.Time `json:"time,omitempty"`
+
+	// Target capacity available to MCAD
+	Capacity v1.ResourceList `json:"capacity,omitempty"`
+
+	// Number of schedulable nodes
+	Nodes int32 `json:"nodes"`
+
+	// Whether the target is reachable and has ready nodes
+	Healthy bool `json:"healthy"`
+
+	// Reason the target is unhealthy if any
+	Error string `json:"error,omitempty"`
+}
+
+// Fairness report for one namespace
+type NamespaceStatus struct {
+	// Namespace
+	Namespace string `json:"namespace"`
+
+	// Resources allocated to dispatched AppWrappers in this namespace
+	Allocated v1.ResourceList `json:"allocated,omitempty"`
+
+	// Capacity divided evenly among namespaces with dispatched or queued AppWrappers
+	FairShare v1.ResourceList `json:"fairShare,omitempty"`
+
+	// Number of queued AppWrappers
+	Queued int32 `json:"queued"`
+
+	// Average time spent queued before dispatch since controller start
+	AverageWaitSeconds int64 `json:"averageWaitSeconds"`
+}
+
+// Reservations at one priority level
+type ReservationStatus struct {
+	// Priority level
+	Priority int32 `json:"priority"`
+
+	// Resources reserved by AppWrappers at this priority level or above
+	Reserved v1.ResourceList `json:"reserved,omitempty"`
+
+	// Capacity minus reserved resources
+	Free v1.ResourceList `json:"free,omitempty"`
+}
+
+// Resources allocated to one AppWrapper
+type AllocationStatus struct {
+	// AppWrapper namespace
+	Namespace string `json:"namespace"`
+
+	// AppWrapper name
+	Name string `json:"name"`
+
+	// AppWrapper priority
+	Priority int32 `json:"priority"`
+
+	// AppWrapper queue
+	Queue string `json:"queue,omitempty"`
+
+	// User who created the AppWrapper if recorded
+	Submitter string `json:"submitter,omitempty"`
+
+	// Dispatch target, empty for the local cluster
+	Target string `json:"target,omitempty"`
+
+	// Max of AppWrapper requests and requests of non-terminated AppWrapper pods
+	Allocated v1.ResourceList `json:"allocated,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,path=clusterinfos
+//+kubebuilder:printcolumn:name="Time",type="date",JSONPath=".status.time"
+
+// ClusterInfo is the Schema for the clusterinfos API
+type ClusterInfo struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterInfoSpec   `json:"spec,omitempty"`
+	Status ClusterInfoStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterInfoList contains a list of ClusterInfo
+type ClusterInfoList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterInfo `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterInfo{}, &ClusterInfoList{})
+}
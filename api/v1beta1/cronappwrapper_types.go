@@ -0,0 +1,106 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CronAppWrapperSpec defines the schedule and template of recurring AppWrappers
+type CronAppWrapperSpec struct {
+	// Schedule in cron format
+	Schedule string `json:"schedule"`
+
+	// Deadline in seconds for starting a run if it misses its scheduled time, no deadline if nil
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// How to treat concurrent runs
+	// Allow permits concurrent runs
+	// Forbid skips a run if the previous run is still active
+	// Replace deletes active runs before starting a new run
+	// +kubebuilder:default=Allow
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// Suspend subsequent runs
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Template of generated AppWrappers
+	Template AppWrapperTemplate `json:"template"`
+
+	// Number of succeeded AppWrappers to retain
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	SuccessfulHistoryLimit *int32 `json:"successfulHistoryLimit,omitempty"`
+
+	// Number of failed AppWrappers to retain
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=0
+	FailedHistoryLimit *int32 `json:"failedHistoryLimit,omitempty"`
+}
+
+// ConcurrencyPolicy describes how to treat concurrent runs
+type ConcurrencyPolicy string
+
+const (
+	// Permit concurrent runs
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+
+	// Skip new run if previous run is still active
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+
+	// Delete active runs before starting a new run
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// CronAppWrapperStatus reports the active runs and the last scheduled run
+type CronAppWrapperStatus struct {
+	// Names of active AppWrappers
+	Active []string `json:"active,omitempty"`
+
+	// When the last run was scheduled
+	LastScheduleTime metav1.Time `json:"lastScheduleTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schedule",type="string",JSONPath=`.spec.schedule`
+//+kubebuilder:printcolumn:name="Suspend",type="boolean",JSONPath=`.spec.suspend`
+//+kubebuilder:printcolumn:name="Last Schedule",type="date",JSONPath=`.status.lastScheduleTime`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CronAppWrapper is the Schema for the cronappwrappers API
+type CronAppWrapper struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CronAppWrapperSpec   `json:"spec,omitempty"`
+	Status CronAppWrapperStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CronAppWrapperList contains a list of CronAppWrapper
+type CronAppWrapperList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CronAppWrapper `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CronAppWrapper{}, &CronAppWrapperList{})
+}
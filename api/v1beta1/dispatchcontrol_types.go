@@ -0,0 +1,99 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DispatchControlSpec defines a bulk administrative action on AppWrappers
+type DispatchControlSpec struct {
+	// Action
+	// RequeueFailed requeues AppWrappers that failed before the DispatchControl was created
+	// Drain requeues running AppWrappers and holds queued AppWrappers until the DispatchControl is deleted
+	// Flush fails AppWrappers queued before the DispatchControl was created
+	// Expedite moves AppWrappers queued before the DispatchControl was created to the front of the queue
+	// +kubebuilder:validation:Enum=RequeueFailed;Drain;Flush;Expedite
+	Action DispatchAction `json:"action"`
+
+	// Namespace of affected AppWrappers, all namespaces if empty
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of affected AppWrapper, all AppWrappers in namespace if empty
+	Name string `json:"name,omitempty"`
+}
+
+// DispatchAction is the bulk administrative action
+type DispatchAction string
+
+const (
+	// Requeue failed AppWrappers
+	RequeueFailed DispatchAction = "RequeueFailed"
+
+	// Requeue running AppWrappers and hold queued AppWrappers
+	Drain DispatchAction = "Drain"
+
+	// Fail queued AppWrappers
+	Flush DispatchAction = "Flush"
+
+	// Dispatch queued AppWrappers ahead of all other AppWrappers
+	Expedite DispatchAction = "Expedite"
+)
+
+// DispatchControlStatus reports the progress of the action
+type DispatchControlStatus struct {
+	// Number of AppWrappers the action still has to be applied to
+	Remaining int32 `json:"remaining"`
+
+	// Action has been applied to all affected AppWrappers
+	Completed bool `json:"completed"`
+
+	// When the action was completed
+	CompletionTimestamp metav1.Time `json:"completionTimestamp,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Action",type="string",JSONPath=`.spec.action`
+//+kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=`.spec.namespace`
+//+kubebuilder:printcolumn:name="Name",type="string",JSONPath=`.spec.name`
+//+kubebuilder:printcolumn:name="Remaining",type="integer",JSONPath=`.status.remaining`
+//+kubebuilder:printcolumn:name="Completed",type="boolean",JSONPath=`.status.completed`
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DispatchControl is the Schema for the dispatchcontrols API
+type DispatchControl struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DispatchControlSpec   `json:"spec,omitempty"`
+	Status DispatchControlStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DispatchControlList contains a list of DispatchControl
+type DispatchControlList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DispatchControl `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DispatchControl{}, &DispatchControlList{})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DispatchLogSpec defines the desired state of DispatchLog
+type DispatchLogSpec struct {
+}
+
+// DispatchLogStatus is the dispatch transaction log of the dispatcher
+type DispatchLogStatus struct {
+	// Sequence number of the last transaction
+	Sequence int64 `json:"sequence,omitempty"`
+
+	// Most recent transactions in order, bounded to the most recent resolved transactions
+	Entries []DispatchLogEntry `json:"entries,omitempty"`
+}
+
+// Dispatch transaction
+type DispatchLogEntry struct {
+	// Sequence number
+	Sequence int64 `json:"sequence"`
+
+	// When the transaction was recorded
+	Time metav1.Time `json:"time"`
+
+	// AppWrapper UID
+	UID types.UID `json:"uid"`
+
+	// AppWrapper namespace
+	Namespace string `json:"namespace"`
+
+	// AppWrapper name
+	Name string `json:"name"`
+
+	// User who created the AppWrapper if recorded
+	Submitter string `json:"submitter,omitempty"`
+
+	// Dispatch target, empty for the local cluster
+	Target string `json:"target,omitempty"`
+
+	// Resources allocated to the AppWrapper
+	Allocated v1.ResourceList `json:"allocated,omitempty"`
+
+	// Transition count of the AppWrapper once dispatched
+	TransitionCount int32 `json:"transitionCount"`
+
+	// Pending, Committed, or Aborted
+	State DispatchLogState `json:"state"`
+}
+
+// DispatchLogState is the state of a dispatch transaction
+type DispatchLogState string
+
+const (
+	// Transaction recorded, AppWrapper status not updated yet
+	DispatchPending DispatchLogState = "Pending"
+
+	// AppWrapper dispatched
+	DispatchCommitted DispatchLogState = "Committed"
+
+	// AppWrapper not dispatched
+	DispatchAborted DispatchLogState = "Aborted"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster,path=dispatchlogs
+//+kubebuilder:printcolumn:name="Sequence",type="integer",JSONPath=".status.sequence"
+
+// DispatchLog is the Schema for the dispatchlogs API
+type DispatchLog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DispatchLogSpec   `json:"spec,omitempty"`
+	Status DispatchLogStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DispatchLogList contains a list of DispatchLog
+type DispatchLogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DispatchLog `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DispatchLog{}, &DispatchLogList{})
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// to ensure that exec-entrypoint and run can make use of them.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+	"github.com/tardieu/mcad/internal/controller"
+)
+
+// The agent runs in a dispatch target cluster and pulls the AppWrappers assigned to the target from the hub
+
+var (
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+}
+
+func main() {
+	var metricsAddr string
+	var enableLeaderElection bool
+	var probeAddr string
+	var hubKubeconfig string
+	var target string
+	var namespace string
+	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
+		"Enable leader election for the agent. Enabling this will ensure there is only one active agent.")
+	flag.StringVar(&hubKubeconfig, "hub-kubeconfig", "", "Path to the kubeconfig file for the hub.")
+	flag.StringVar(&target, "target", "", "Name of the dispatch target on the hub.")
+	flag.StringVar(&namespace, "namespace", "",
+		"Namespace of the AppWrappers assigned to the target on the hub, defaults to the target name.")
+	opts := zap.Options{
+		Development: true,
+	}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	if hubKubeconfig == "" || target == "" {
+		setupLog.Info("missing hub kubeconfig or target name")
+		os.Exit(1)
+	}
+	if namespace == "" {
+		namespace = target
+	}
+
+	hubConfig, err := clientcmd.BuildConfigFromFlags("", hubKubeconfig)
+	if err != nil {
+		setupLog.Error(err, "unable to load hub kubeconfig")
+		os.Exit(1)
+	}
+	local, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		setupLog.Error(err, "unable to create client for target cluster")
+		os.Exit(1)
+	}
+
+	// the manager connects to the hub and only watches the namespace of the assigned AppWrappers
+	mgr, err := ctrl.NewManager(hubConfig, ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "agent." + target + ".codeflare.dev",
+		LeaderElectionNamespace: namespace,
+		Cache:                   cache.Options{Namespaces: []string{namespace}},
+		Client:                  client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&mcadv1beta1.ClusterInfo{}}}},
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
+	if err = (&controller.AgentReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Local:  local,
+		Target: target,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Agent")
+		os.Exit(1)
+	}
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting agent")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "problem running agent")
+		os.Exit(1)
+	}
+}
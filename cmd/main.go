@@ -18,7 +18,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -54,11 +57,130 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var config controller.Config
+	var quotaExemptUsers []string
+	var targetsFile string
+	var payloadKeysFile string
+	var injectionProfilesFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&config.OrphanSweepPeriod, "orphan-sweep-period", 0,
+		"Period of the inventory of leaked resources labeled as managed by MCAD, never if zero.")
+	flag.DurationVar(&config.ResyncPeriod, "resync-period", 0,
+		"Period of the full resync re-listing all AppWrappers, enqueuing their reconciliation, and flagging anomalies, never if zero.")
+	flag.BoolVar(&config.OwnerReferences, "owner-references", true,
+		"Set owner references on wrapped resources in the namespace of their AppWrapper so garbage collection backs up finalizer-driven cleanup.")
+	flag.BoolVar(&config.InjectPriorityClass, "inject-priority-class", false,
+		"Inject the PriorityClass with the highest value not exceeding the AppWrapper priority into wrapped pods.")
+	flag.BoolVar(&config.RequeueOnCapacityShrink, "requeue-on-capacity-shrink", false,
+		"Requeue running AppWrappers by increasing priority and age when cluster capacity no longer covers their requests.")
+	flag.DurationVar(&config.CacheConflictTimeout, "cache-conflict-timeout", 5*time.Minute,
+		"Time after which conflicts between the reconciler cache and the AppWrapper phase cache are persistent.")
+	config.ConflictPolicy = controller.DropCacheEntry
+	flag.Func("conflict-policy", "Response to persistent cache conflicts: Drop (default) to trust the reconciler cache, Pause to stop acting on the AppWrapper, or Alert to drop the cache entry and emit a warning event.",
+		func(s string) (err error) {
+			config.ConflictPolicy, err = controller.ParseConflictPolicy(s)
+			return
+		})
+	flag.BoolVar(&config.DispatchLog, "dispatch-log", false,
+		"Record dispatch decisions in the mcad DispatchLog object before acting and recover pending decisions on startup.")
+	flag.Func("config-map", "Namespace/name of a ConfigMap overriding settings at runtime, keys are flag names.",
+		func(s string) error {
+			namespace, name, ok := strings.Cut(s, "/")
+			if !ok {
+				return fmt.Errorf("invalid ConfigMap %q", s)
+			}
+			config.ConfigMap = types.NamespacedName{Namespace: namespace, Name: name}
+			return nil
+		})
+	flag.BoolVar(&config.PauseDispatch, "pause-dispatch", false,
+		"Stop dispatching queued AppWrappers.")
+	flag.BoolVar(&config.Preemption, "preemption", false,
+		"Requeue lower-priority AppWrappers to make room for queued AppWrappers instead of overcommitting the cluster.")
+	flag.DurationVar(&config.PreemptionProtection, "preemption-protection", 0,
+		"Time after dispatch during which AppWrappers cannot be preempted.")
+	flag.IntVar(&config.MaxQueuedPerNamespace, "max-queued-per-namespace", 0,
+		"Reject new AppWrappers when a namespace has this many queued AppWrappers, unlimited if zero.")
+	flag.IntVar(&config.MaxQueuedPerQueue, "max-queued-per-queue", 0,
+		"Reject new AppWrappers when a queue has this many queued AppWrappers, unlimited if zero.")
+	flag.IntVar(&config.MaxQueuedPerUser, "max-queued-per-user", 0,
+		"Reject new AppWrappers when their submitter has this many queued AppWrappers, unlimited if zero, requires --record-submitter.")
+	flag.IntVar(&config.MaxTemplateSize, "max-template-size", 0,
+		"Maximum size in bytes of an inline resource template, unlimited if zero.")
+	flag.BoolVar(&config.OffloadTemplates, "offload-templates", false,
+		"Offload oversized resource templates to ConfigMaps instead of rejecting the AppWrapper.")
+	flag.DurationVar(&config.StuckTimeout, "stuck-timeout", time.Hour,
+		"Time after which AppWrappers creating or deleting resources are reported as stuck, never if zero.")
+	config.StuckPolicy = controller.ReportStuck
+	flag.Func("stuck-policy", "Response to stuck AppWrappers: Report (default) or ForceFinalize to abandon resources that cannot be deleted, except when requeuing.",
+		func(s string) (err error) {
+			config.StuckPolicy, err = controller.ParseStuckPolicy(s)
+			return
+		})
+	config.TerminatingPods = controller.GracePeriodTerminating
+	flag.Func("terminating-pods", "Treatment of terminating pods in resource accounting: GracePeriod (default) to count them until the end of their grace period, Count to count them until gone, or Ignore.",
+		func(s string) (err error) {
+			config.TerminatingPods, err = controller.ParseTerminatingPodPolicy(s)
+			return
+		})
+	flag.DurationVar(&config.UnschedulableTimeout, "unschedulable-timeout", 0,
+		"Time after which AppWrappers with pods the scheduler cannot place are requeued, never if zero.")
+	flag.DurationVar(&config.FinalizerRemovalTimeout, "finalizer-removal-timeout", 0,
+		"Time after which strippable finalizers blocking the deletion of wrapped resources are removed, never if zero.")
+	flag.Func("strippable-finalizers", "Comma-separated list of finalizers that may be removed from wrapped resources, * matches all finalizers.",
+		func(s string) error {
+			config.StrippableFinalizers = strings.Split(s, ",")
+			return nil
+		})
+	flag.Func("quota-exempt-service-accounts", "Comma-separated list of namespace/name service accounts allowed to exempt AppWrappers from queue limits and quotas, enables the admission webhooks.",
+		func(s string) error {
+			for _, account := range strings.Split(s, ",") {
+				namespace, name, ok := strings.Cut(account, "/")
+				if !ok {
+					return fmt.Errorf("invalid service account %q", account)
+				}
+				quotaExemptUsers = append(quotaExemptUsers, mcadv1beta1.ServiceAccountUser(namespace, name))
+			}
+			config.QuotaExemption = true
+			return nil
+		})
+	flag.StringVar(&injectionProfilesFile, "injection-profiles", "",
+		"File of injection profiles providing defaults for the wrapped pods of AppWrappers in matching namespaces or queues.")
+	flag.StringVar(&payloadKeysFile, "payload-keys", "",
+		"File of PEM-encoded public keys, resource templates must be signed with one of these keys if specified.")
+	flag.BoolVar(&config.PolicyDryRun, "policy-dry-run", false,
+		"Submit the wrapped resources of new AppWrappers to admission policies in dry-run mode and reject violations when queued.")
+	flag.BoolVar(&config.StrictIsolation, "strict-isolation", false,
+		"Refuse wrapped resources outside of the AppWrapper namespace, cluster-scoped wrapped resources, and labels reserved for MCAD.")
+	flag.BoolVar(&config.RecordSubmitter, "record-submitter", false,
+		"Record the user creating each AppWrapper in its status, enables the admission webhooks.")
+	controller.DispatchPolicyFlags(flag.CommandLine, &config)
+	flag.StringVar(&targetsFile, "dispatch-targets", "",
+		"YAML file listing remote clusters to dispatch to in addition to the local cluster with their names, kubeconfigs, sync periods, labels, and costs.")
+	flag.DurationVar(&config.TargetOutageTimeout, "target-outage-timeout", 0,
+		"Time after which AppWrappers running on an unhealthy dispatch target are requeued and their resources abandoned, never if zero.")
+	flag.DurationVar(&config.HeartbeatTimeout, "heartbeat-timeout", 0,
+		"Time after which running AppWrappers without healthy pods observed bypassing the informer cache are requeued, never if zero.")
+	config.TargetPolicy = controller.MostFreeGPUs
+	flag.Func("target-policy", "Order of eligible dispatch targets with equal placement scores: MostFreeGPUs (default), LowestCost, DataLocality, or RoundRobin.",
+		func(s string) (err error) {
+			config.TargetPolicy, err = controller.ParseTargetPolicy(s)
+			return
+		})
+	flag.Float64Var(&config.FreeGPUWeight, "free-gpu-weight", 0,
+		"Points added to the placement score of a dispatch target per free GPU, free capacity is left to the target policy if zero.")
+	flag.StringVar(&config.PlacementScorer, "placement-scorer", "",
+		"URL of an external placement scorer replacing the built-in scores of eligible dispatch targets.")
+	flag.StringVar(&config.SecretResolver, "secret-resolver", "",
+		"URL of an external secret resolver for secret placeholders in wrapped resources.")
+	flag.Func("hook-url-prefixes", "Comma-separated list of URL prefixes allowed for webhook hooks, prefixes should end with a slash, webhook hooks are refused if empty.",
+		func(s string) error {
+			config.HookURLPrefixes = strings.Split(s, ",")
+			return nil
+		})
 	opts := zap.Options{
 		Development: true,
 	}
@@ -91,15 +213,70 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controller.AppWrapperReconciler{
+	var targets []*controller.Target
+	if targetsFile != "" {
+		if config.LocalTarget, targets, err = controller.LoadTargets(targetsFile, scheme); err != nil {
+			setupLog.Error(err, "unable to load dispatch targets")
+			os.Exit(1)
+		}
+	}
+
+	if injectionProfilesFile != "" {
+		if config.InjectionProfiles, err = controller.LoadInjectionProfiles(injectionProfilesFile); err != nil {
+			setupLog.Error(err, "unable to load injection profiles")
+			os.Exit(1)
+		}
+	}
+	if payloadKeysFile != "" {
+		if config.PayloadKeys, err = controller.LoadPublicKeys(payloadKeysFile); err != nil {
+			setupLog.Error(err, "unable to load payload keys")
+			os.Exit(1)
+		}
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	appWrapperReconciler := &controller.AppWrapperReconciler{
+		Client:   controller.WithFaultInjection(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Cache:    map[types.UID]*controller.CachedAppWrapper{}, // AppWrapper cache
+		Events:   make(chan event.GenericEvent, 1),             // channel to trigger dispatch
+		Recorder: mgr.GetEventRecorderFor("mcad"),
+		Config:   config,
+		Targets:  targets,
+		Stopped:  ctx.Done(),
+	}
+	if err = appWrapperReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AppWrapper")
+		os.Exit(1)
+	}
+	if err = (&controller.DispatchControlReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		AppWrappers: appWrapperReconciler,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DispatchControl")
+		os.Exit(1)
+	}
+	if err = (&controller.AppWrapperSetReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
-		Cache:  map[types.UID]*controller.CachedAppWrapper{}, // AppWrapper cache
-		Events: make(chan event.GenericEvent, 1),             // channel to trigger dispatch
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "AppWrapper")
+		setupLog.Error(err, "unable to create controller", "controller", "AppWrapperSet")
 		os.Exit(1)
 	}
+	if err = (&controller.CronAppWrapperReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CronAppWrapper")
+		os.Exit(1)
+	}
+	if config.QuotaExemption || config.RecordSubmitter {
+		if err = (&mcadv1beta1.AppWrapperValidator{QuotaExemptUsers: quotaExemptUsers, HookURLPrefixes: config.HookURLPrefixes}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AppWrapper")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -112,7 +289,7 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
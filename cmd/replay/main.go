@@ -0,0 +1,123 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Replay the dispatch policy against recorded cluster snapshots, e.g.,
+//
+//	kubectl get nodes,pods,appwrappers -A -o yaml > snapshot.yaml
+//	go run ./cmd/replay --tie-breaker LeastRequested snapshot.yaml
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+	"github.com/tardieu/mcad/internal/controller"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+}
+
+func main() {
+	var config controller.Config
+	controller.DispatchPolicyFlags(flag.CommandLine, &config)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] snapshot.yaml...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	objects := []client.Object{}
+	for _, name := range flag.Args() {
+		objs, err := load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		objects = append(objects, objs...)
+	}
+
+	dispatched, err := controller.Replay(context.Background(), scheme, objects, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error replaying: %v\n", err)
+		os.Exit(1)
+	}
+	for i, appWrapper := range dispatched {
+		fmt.Printf("%d\t%s/%s\tpriority=%d\n", i+1, appWrapper.Namespace, appWrapper.Name, appWrapper.Spec.Priority)
+	}
+}
+
+// Load objects and lists of objects from a multi-document YAML or JSON file
+func load(name string) ([]client.Object, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	reader := yaml.NewYAMLReader(bufio.NewReader(file))
+	objects := []client.Object{}
+	for {
+		doc, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if meta.IsListType(obj) {
+			items, err := meta.ExtractList(obj)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if unknown, ok := item.(*runtime.Unknown); ok {
+					if item, _, err = decoder.Decode(unknown.Raw, nil, nil); err != nil {
+						return nil, err
+					}
+				}
+				objects = append(objects, item.(client.Object))
+			}
+		} else if o, ok := obj.(client.Object); ok {
+			objects = append(objects, o)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tardieu/mcad/internal/controller"
+)
+
+// Run with: make bench
+// Benchmarks are skipped unless KUBEBUILDER_ASSETS points to the envtest binaries
+
+func BenchmarkDispatch(b *testing.B) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		b.Skip("KUBEBUILDER_ASSETS not set")
+	}
+	h, err := Start(controller.Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer h.Stop()
+	for _, size := range []struct{ nodes, appWrappers int }{{10, 50}, {50, 200}, {100, 500}} {
+		b.Run(fmt.Sprintf("nodes=%d/appwrappers=%d", size.nodes, size.appWrappers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+				prefix := fmt.Sprintf("bench-%d-%d-%d", size.nodes, size.appWrappers, i)
+				result, err := h.Run(ctx, prefix, size.nodes, size.appWrappers)
+				if err != nil {
+					cancel()
+					b.Fatal(err)
+				}
+				// remove this run's AppWrappers and nodes before the next run, excluded from measurements
+				b.StopTimer()
+				err = h.Cleanup(ctx, prefix)
+				b.StartTimer()
+				cancel()
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(result.Throughput(size.appWrappers), "appwrappers/s")
+				b.ReportMetric(float64(result.ReconcileLatency.Microseconds()), "µs/reconcile")
+				b.ReportMetric(float64(result.HeapBytes), "heap-bytes")
+			}
+		})
+	}
+}
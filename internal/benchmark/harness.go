@@ -0,0 +1,279 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package benchmark measures dispatch throughput, reconcile latency, and memory usage
+// of the AppWrapper controller running against envtest with synthetic nodes and AppWrappers
+package benchmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+	"github.com/tardieu/mcad/internal/controller"
+)
+
+const (
+	namespace    = "default"
+	runLabel     = "benchmark.mcad/run"
+	pollInterval = 100 * time.Millisecond
+)
+
+// Controller running against envtest
+type Harness struct {
+	Client  client.Client
+	env     *envtest.Environment
+	cancel  context.CancelFunc
+	stopped chan struct{} // closed when the manager returns
+	err     error         // error returned by the manager
+}
+
+// Measurements of a benchmark run
+type Result struct {
+	// Time to dispatch all AppWrappers
+	Duration time.Duration
+
+	// Average reconcile latency
+	ReconcileLatency time.Duration
+
+	// Heap in use after dispatching all AppWrappers
+	HeapBytes uint64
+}
+
+// Dispatched AppWrappers per second
+func (r Result) Throughput(appWrappers int) float64 {
+	return float64(appWrappers) / r.Duration.Seconds()
+}
+
+// Start envtest and the AppWrapper controller with the given configuration
+// Requires KUBEBUILDER_ASSETS to point to the envtest binaries
+func Start(config controller.Config) (*Harness, error) {
+	scheme := pkgruntime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	env := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := env.Start()
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{env: env}
+	if h.Client, err = client.New(cfg, client.Options{Scheme: scheme}); err != nil {
+		h.Stop()
+		return nil, err
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme, MetricsBindAddress: "0"})
+	if err != nil {
+		h.Stop()
+		return nil, err
+	}
+	if err := (&controller.AppWrapperReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Cache:    map[types.UID]*controller.CachedAppWrapper{},
+		Events:   make(chan event.GenericEvent, 1),
+		Recorder: mgr.GetEventRecorderFor("mcad"),
+		Config:   config,
+	}).SetupWithManager(mgr); err != nil {
+		h.Stop()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.stopped = make(chan struct{})
+	go func() {
+		defer close(h.stopped)
+		h.err = mgr.Start(ctx)
+	}()
+	return h, nil
+}
+
+// Stop the controller and envtest
+func (h *Harness) Stop() error {
+	var err error
+	if h.cancel != nil {
+		h.cancel()
+		<-h.stopped
+		err = h.err
+	}
+	return errors.Join(err, h.env.Stop())
+}
+
+// Create synthetic nodes with the given cpu capacity
+func (h *Harness) CreateNodes(ctx context.Context, prefix string, count int, cpus string) error {
+	for i := 0; i < count; i++ {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", prefix, i), Labels: map[string]string{runLabel: prefix}}}
+		if err := h.Client.Create(ctx, node); err != nil {
+			return err
+		}
+		node.Status.Capacity = v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpus)}
+		node.Status.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpus)}
+		if err := h.Client.Status().Update(ctx, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create synthetic AppWrappers each requesting the given cpus and wrapping a ConfigMap
+func (h *Harness) CreateAppWrappers(ctx context.Context, prefix string, count int, cpus string) error {
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s-%d", prefix, i)
+		appWrapper := &mcadv1beta1.AppWrapper{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{runLabel: prefix}},
+			Spec: mcadv1beta1.AppWrapperSpec{
+				Resources: mcadv1beta1.AppWrapperResources{
+					GenericItems: []mcadv1beta1.GenericItem{{
+						CustomPodResources: []mcadv1beta1.CustomPodResource{{
+							Replicas: 1,
+							Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpus)},
+						}},
+						GenericTemplate: pkgruntime.RawExtension{
+							Raw: []byte(fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"%s"}}`, name)),
+						},
+					}},
+				},
+			},
+		}
+		if err := h.Client.Create(ctx, appWrapper); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait until count AppWrappers with the given prefix have created their resources
+func (h *Harness) WaitDispatched(ctx context.Context, prefix string, count int) error {
+	for {
+		appWrappers := &mcadv1beta1.AppWrapperList{}
+		if err := h.Client.List(ctx, appWrappers, client.InNamespace(namespace), client.MatchingLabels{runLabel: prefix}); err != nil {
+			return err
+		}
+		created := 0
+		for _, appWrapper := range appWrappers.Items {
+			if appWrapper.Status.Phase == mcadv1beta1.Running && appWrapper.Status.Step == mcadv1beta1.Created {
+				created++
+			}
+		}
+		if created >= count {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d AppWrappers dispatched: %w", created, count, ctx.Err())
+		case <-h.stopped:
+			return fmt.Errorf("controller stopped: %w", h.err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Delete the AppWrappers and nodes with the given prefix and wait for the AppWrappers to be gone
+// so that the next run starts from an empty cluster
+func (h *Harness) Cleanup(ctx context.Context, prefix string) error {
+	if err := h.Client.DeleteAllOf(ctx, &mcadv1beta1.AppWrapper{}, client.InNamespace(namespace), client.MatchingLabels{runLabel: prefix}); err != nil {
+		return err
+	}
+	for {
+		appWrappers := &mcadv1beta1.AppWrapperList{}
+		if err := h.Client.List(ctx, appWrappers, client.InNamespace(namespace), client.MatchingLabels{runLabel: prefix}); err != nil {
+			return err
+		}
+		if len(appWrappers.Items) == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d AppWrappers remaining: %w", len(appWrappers.Items), ctx.Err())
+		case <-h.stopped:
+			return fmt.Errorf("controller stopped: %w", h.err)
+		case <-time.After(pollInterval):
+		}
+	}
+	return h.Client.DeleteAllOf(ctx, &v1.Node{}, client.MatchingLabels{runLabel: prefix})
+}
+
+// Create nodes and AppWrappers, wait for all AppWrappers to be dispatched, and report measurements
+// Every node has enough capacity to run its share of the AppWrappers
+func (h *Harness) Run(ctx context.Context, prefix string, nodes int, appWrappers int) (Result, error) {
+	count, sum, err := reconcileTime()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := h.CreateNodes(ctx, prefix, nodes, fmt.Sprint((appWrappers+nodes-1)/nodes)); err != nil {
+		return Result{}, err
+	}
+	start := time.Now()
+	if err := h.CreateAppWrappers(ctx, prefix, appWrappers, "1"); err != nil {
+		return Result{}, err
+	}
+	if err := h.WaitDispatched(ctx, prefix, appWrappers); err != nil {
+		return Result{}, err
+	}
+	result := Result{Duration: time.Since(start)}
+	count2, sum2, err := reconcileTime()
+	if err != nil {
+		return Result{}, err
+	}
+	if count2 > count {
+		result.ReconcileLatency = time.Duration((sum2 - sum) / float64(count2-count) * float64(time.Second))
+	}
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	result.HeapBytes = stats.HeapInuse
+	return result, nil
+}
+
+// Total count and duration in seconds of AppWrapper reconciliations
+func reconcileTime() (uint64, float64, error) {
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, family := range families {
+		if family.GetName() != "controller_runtime_reconcile_time_seconds" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "controller" && label.GetValue() == "appwrapper" {
+					return metric.Histogram.GetSampleCount(), metric.Histogram.GetSampleSum(), nil
+				}
+			}
+		}
+	}
+	return 0, 0, nil
+}
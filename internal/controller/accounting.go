@@ -0,0 +1,99 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Dispatching AppWrappers (Running/Creating) reserve their full request before their resources are created
+// Requeuing AppWrappers (Running/Deleting) only reserve the requests of the wrapped resources actually created
+// and, once the deletion of all wrapped resources has been requested, only the requests of their pods not yet terminated
+// Created resources are tracked in memory for AppWrappers dispatched to the local cluster, AppWrappers without
+// records, e.g., after a restart, reserve their full request until deleted
+
+// Resources created for an AppWrapper
+type createdResources struct {
+	indexes map[int]bool // indexes of the wrapped resources created so far, each counted once across retries
+	deleted bool         // deletion of all wrapped resources requested
+}
+
+// Return the created resources record of an AppWrapper, creating an empty record if requested
+func (r *AppWrapperReconciler) createdResources(appWrapper *mcadv1beta1.AppWrapper, create bool) *createdResources {
+	if r.created == nil {
+		r.created = map[types.UID]*createdResources{}
+	}
+	created, ok := r.created[appWrapper.UID]
+	if !ok && create {
+		created = &createdResources{indexes: map[int]bool{}}
+		r.created[appWrapper.UID] = created
+	}
+	return created
+}
+
+// Record the creation of the wrapped resource with the given index
+func (r *AppWrapperReconciler) recordCreation(appWrapper *mcadv1beta1.AppWrapper, index int) {
+	if appWrapper.Status.Target != localTarget {
+		return
+	}
+	r.createdResources(appWrapper, true).indexes[index] = true
+}
+
+// Record that the deletion of all wrapped resources has been requested
+func (r *AppWrapperReconciler) recordDeletion(appWrapper *mcadv1beta1.AppWrapper) {
+	if appWrapper.Status.Target != localTarget {
+		return
+	}
+	r.createdResources(appWrapper, true).deleted = true
+}
+
+// Track AppWrapper transitions, reset records when dispatching and forget them once resources are released
+func (r *AppWrapperReconciler) trackResources(appWrapper *mcadv1beta1.AppWrapper) {
+	switch appWrapper.Status.Step {
+	case mcadv1beta1.Creating:
+		delete(r.created, appWrapper.UID)
+		r.createdResources(appWrapper, true)
+	case mcadv1beta1.Created, mcadv1beta1.Deleting:
+	default:
+		delete(r.created, appWrapper.UID)
+	}
+}
+
+// Forget the created resources of a deleted AppWrapper
+func (r *AppWrapperReconciler) forgetResources(appWrapper *mcadv1beta1.AppWrapper) {
+	delete(r.created, appWrapper.UID)
+}
+
+// Compute the request of a requeuing AppWrapper before accounting for its pods
+// The result never exceeds the request of the AppWrapper
+func (r *AppWrapperReconciler) deletingRequest(appWrapper *mcadv1beta1.AppWrapper, request Weights) Weights {
+	created := r.createdResources(appWrapper, false)
+	if created == nil {
+		return request // no record, assume all resources were created
+	}
+	if created.deleted {
+		return Weights{} // only pods not yet terminated are left
+	}
+	requests := Weights{}
+	for index := range created.indexes {
+		requests.Add(itemRequests(appWrapper, index))
+	}
+	requests.Min(request)
+	return requests
+}
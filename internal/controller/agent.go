@@ -0,0 +1,155 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// AgentReconciler runs in a dispatch target that cannot accept inbound connections from the hub
+// It creates and deletes the wrapped resources of the AppWrappers assigned to the target on the hub,
+// reports the status of these resources, and publishes the target capacity on the hub
+type AgentReconciler struct {
+	client.Client // client for the hub
+	Scheme        *runtime.Scheme
+	Local         client.Client // client for the target cluster
+	Target        string        // target name
+}
+
+// Reconcile one assigned AppWrapper
+func (r *AgentReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	assignment := &mcadv1beta1.AppWrapper{}
+	if err := r.Get(ctx, req.NamespacedName, assignment); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	reports := []mcadv1beta1.ReportedResource{}
+	pending := false // pending creations or deletions
+	// create missing resources and observe their status
+	for _, item := range assignment.Spec.Resources.GenericItems {
+		obj := &unstructured.Unstructured{}
+		if _, _, err := unstructured.UnstructuredJSONScheme.Decode(item.GenericTemplate.Raw, nil, obj); err != nil {
+			log.Error(err, "Parsing error")
+			continue
+		}
+		if err := r.Local.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+			log.Error(err, "Creation error", "kind", obj.GetKind(), "name", obj.GetName())
+			pending = true
+			continue
+		}
+		report, err := r.observe(ctx, obj)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if report == nil {
+			pending = true
+			continue
+		}
+		reports = append(reports, *report)
+	}
+	// delete resources no longer assigned, keep reporting them until they are gone
+	for _, previous := range assignment.Status.ReportedResources {
+		manifest := reportedManifest(previous)
+		if findItem(assignment, manifest) >= 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: manifest}
+		if err := r.Local.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			log.Error(err, "Deletion error", "kind", obj.GetKind(), "name", obj.GetName())
+		}
+		reports = append(reports, previous)
+		pending = true
+	}
+	if !reflect.DeepEqual(reports, assignment.Status.ReportedResources) {
+		// patch the reported resources only, the rest of the status is owned by the hub
+		patch := client.MergeFrom(assignment.DeepCopy())
+		assignment.Status.ReportedResources = reports
+		if err := r.Status().Patch(ctx, assignment, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if pending {
+		return ctrl.Result{RequeueAfter: deletionDelay}, nil
+	}
+	return ctrl.Result{RequeueAfter: runDelay}, nil
+}
+
+// Report the status of a resource in the target cluster, nil if the resource does not exist
+func (r *AgentReconciler) observe(ctx context.Context, obj *unstructured.Unstructured) (*mcadv1beta1.ReportedResource, error) {
+	if err := r.Local.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	report := &mcadv1beta1.ReportedResource{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	if status, ok := obj.Object["status"]; ok {
+		raw, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		report.Status.Raw = raw
+	}
+	return report, nil
+}
+
+// Publish the capacity of the target cluster on the hub periodically until context is canceled
+func (r *AgentReconciler) publishCapacity(ctx context.Context) error {
+	local := &directTransport{client: r.Local}
+	for {
+		capacity, nodes, err := local.Capacity(ctx)
+		if capacity == nil {
+			mcadLog.Error(err, "Capacity error")
+		} else if err := publishAgentClusterInfo(ctx, r.Client, r.Target, capacity, len(nodes), err); err != nil {
+			mcadLog.Error(err, "ClusterInfo error")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(clusterInfoTimeout):
+		}
+	}
+}
+
+// SetupWithManager sets up the agent with the Manager for the hub
+func (r *AgentReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(manager.RunnableFunc(r.publishCapacity)); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("agent").
+		For(&mcadv1beta1.AppWrapper{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetLabels()[assignedLabel] == r.Target
+		}))).
+		Complete(r)
+}
@@ -19,19 +19,27 @@ package controller
 import (
 	"context"
 	"errors"
+	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -45,7 +53,26 @@ type AppWrapperReconciler struct {
 	Cache           map[types.UID]*CachedAppWrapper // cache AppWrapper updates for write/read consistency
 	Events          chan event.GenericEvent         // event channel to trigger dispatch
 	ClusterCapacity Weights                         // cluster capacity available to MCAD
+	Nodes           map[string]*NodeInfo            // schedulable nodes
 	NextSync        time.Time                       // when to refresh cluster capacity
+	Config          Config                          // installation-wide settings
+	baseConfig      Config                          // settings before runtime overrides
+	podsChanged     atomic.Bool                     // non-AppWrapper pods changed since last capacity refresh
+	dispatchPending atomic.Bool                     // dispatch triggered since the last dispatch evaluation started
+	Recorder        record.EventRecorder            // event recorder
+	waits           map[string]*waitStats           // queuing time statistics per namespace
+	mutex           sync.Mutex                      // serialize reconciliations and shutdown procedure
+	stopping        bool                            // shutdown in progress
+	Stopped         <-chan struct{}                 // closed upon stop signal, nil if unknown
+	phantom         map[types.UID]*phantomCapacity  // capacity reported free but rejected by the scheduler per AppWrapper
+	Targets         []*Target                       // remote dispatch targets
+	lastTarget      int                             // rank of the last selected target
+	dispatchLog     *mcadv1beta1.DispatchLog        // dispatch transaction log as last written, nil if unknown
+	gpuWithheld     Weights                         // GPU capacity withheld by GPU quotas at last capacity refresh
+	created         map[types.UID]*createdResources // resources created for AppWrappers dispatched to the local cluster
+	orphans         orphanSweeper                   // kinds of resources to inventory and last orphan report
+	health          healthState                     // timestamps of the dispatch subsystem for health probes
+	APIReader       client.Reader                   // uncached reader to resolve update conflicts, cached client if nil
 }
 
 const (
@@ -54,6 +81,9 @@ const (
 	finalizer      = "workload.codeflare.dev/finalizer"  // finalizer name
 	nvidiaGpu      = "nvidia.com/gpu"                    // GPU resource name
 	specNodeName   = ".spec.nodeName"                    // key to index pods based on node placement
+
+	maxDispatchHistory = 50 // maximum number of dispatch records
+	maxStatusRetries   = 3  // maximum number of status update retries on conflicts
 )
 
 // Structured logger
@@ -68,11 +98,27 @@ func withAppWrapper(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) con
 // Queued->Dispatching transitions happen as part of a special "*/*" reconciliation
 // In a "*/*" reconciliation, we iterate over queued AppWrappers in order, dispatching as many as we can
 func (r *AppWrapperReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// serialize with shutdown procedure
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.reconcile(ctx, req)
+}
+
+// Reconcile one AppWrapper or dispatch queued AppWrappers, caller must hold mutex
+func (r *AppWrapperReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// req == "*/*", dispatch queued AppWrappers
 	if req.Namespace == "*" && req.Name == "*" {
+		if r.stopping {
+			return ctrl.Result{}, nil // do not dispatch during shutdown
+		}
 		return r.dispatch(ctx)
 	}
 
+	// req == "*/config", reload settings
+	if req.Namespace == "*" && req.Name == configRequestName {
+		return ctrl.Result{}, r.reloadConfig(ctx)
+	}
+
 	// get deep copy of AppWrapper object in reconciler cache
 	appWrapper := &mcadv1beta1.AppWrapper{}
 	if err := r.Get(ctx, req.NamespacedName, appWrapper); err != nil {
@@ -80,6 +126,11 @@ func (r *AppWrapperReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	// ignore AppWrappers assigned to pull-based agents
+	if isAssigned(appWrapper) {
+		return ctrl.Result{}, nil
+	}
+
 	// append appWrapper ID to logger
 	ctx = withAppWrapper(ctx, appWrapper)
 
@@ -88,106 +139,344 @@ func (r *AppWrapperReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	// load offloaded resource templates
+	if err := r.loadTemplates(ctx, appWrapper); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// detect AppWrappers stuck creating or deleting resources, including AppWrappers being deleted
+	if err := r.watchdog(ctx, appWrapper); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	// handle deletion
 	if !appWrapper.DeletionTimestamp.IsZero() {
 		// delete wrapped resources
-		if !r.deleteResources(ctx, appWrapper, *appWrapper.DeletionTimestamp) {
+		if !r.deleteOrAbandon(ctx, appWrapper, *appWrapper.DeletionTimestamp) {
 			// requeue reconciliation after delay
 			return ctrl.Result{RequeueAfter: deletionDelay}, nil
 		}
-		// remove finalizer
+		// remove finalizer, patch metadata only as offloaded templates have been loaded
+		patch := client.MergeFromWithOptions(appWrapper.DeepCopy(), client.MergeFromWithOptimisticLock{})
 		if controllerutil.RemoveFinalizer(appWrapper, finalizer) {
-			if err := r.Update(ctx, appWrapper); err != nil {
+			if err := r.Patch(ctx, appWrapper, patch); err != nil {
 				return ctrl.Result{}, err
 			}
 		}
 		// remove AppWrapper from cache
 		r.deleteCachedPhase(appWrapper)
+		r.forgetResources(appWrapper)
 		log.FromContext(ctx).Info("Deleted")
 		return ctrl.Result{}, nil
 	}
 
+	// apply pending administrative actions
+	if applied, result, err := r.applyDispatchControls(ctx, appWrapper); applied {
+		return result, err
+	}
+
+	// fail AppWrapper exceeding its max lifetime
+	if done, result, err := r.checkLifetime(ctx, appWrapper); done {
+		return result, err
+	}
+
 	// handle other phases
 	switch appWrapper.Status.Phase {
 	case mcadv1beta1.Empty:
-		// add finalizer
+		// add finalizer, patch metadata only as offloaded templates have been loaded
+		patch := client.MergeFromWithOptions(appWrapper.DeepCopy(), client.MergeFromWithOptimisticLock{})
 		if controllerutil.AddFinalizer(appWrapper, finalizer) {
-			if err := r.Update(ctx, appWrapper); err != nil {
+			if err := r.Patch(ctx, appWrapper, patch); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		// offload or reject oversized resource templates
+		if offloaded, reason, err := r.offloadTemplates(ctx, appWrapper); err != nil || offloaded || reason != "" {
+			if err != nil || offloaded {
+				return ctrl.Result{}, err
+			}
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, reason)
+		}
+		// reject AppWrapper with unsigned or invalid resource templates
+		if err := r.verifyPayloads(appWrapper); err != nil {
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, err.Error())
+		}
+		// reject AppWrapper with unparsable resource templates or violating strict isolation
+		objects, err := parseResources(appWrapper)
+		if err != nil {
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, err.Error())
+		}
+		if reason := r.checkIsolation(appWrapper, objects); reason != "" {
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, reason)
+		}
+		// record submitter before checking per-user limits
+		if err := r.recordSubmitter(ctx, appWrapper); err != nil {
+			return ctrl.Result{}, err
+		}
+		// set admitting/idle status only after adding finalizer
+		return r.updateStatus(ctx, appWrapper, mcadv1beta1.Admitting, mcadv1beta1.Idle)
+
+	case mcadv1beta1.Admitting:
+		// reject AppWrapper violating admission policies, retry on errors
+		if reason, err := r.evaluatePolicies(ctx, appWrapper); err != nil || reason != "" {
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, reason)
+		}
+		// reject AppWrapper if queue is full
+		if reason, err := r.checkQueueLimits(ctx, appWrapper); err != nil || reason != "" {
+			if err != nil {
 				return ctrl.Result{}, err
 			}
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Rejected, mcadv1beta1.Idle, reason)
 		}
-		// set queued/idle status only after adding finalizer
+		// set queued/idle status once admitted
 		return r.updateStatus(ctx, appWrapper, mcadv1beta1.Queued, mcadv1beta1.Idle)
 
 	case mcadv1beta1.Queued:
 		r.triggerDispatch()
-		return ctrl.Result{}, nil
+		// check queue time objective, check lifetime when it ends
+		result, err := r.checkQueueSLO(ctx, appWrapper)
+		return withinLifetime(appWrapper, result), err
 
 	case mcadv1beta1.Running:
 		switch appWrapper.Status.Step {
 		case mcadv1beta1.Creating:
+			// verify placement using probe pods if requested
+			if appWrapper.Spec.Scheduling.VerifyPlacement {
+				placed, reason, err := r.probePlacement(ctx, appWrapper)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				if reason != "" {
+					return r.requeueOrFail(ctx, appWrapper, false, mcadv1beta1.PodsFailed, reason)
+				}
+				if !placed {
+					return ctrl.Result{RequeueAfter: probeDelay}, nil
+				}
+			}
+			// run pre-dispatch hook before creation
+			if done, result, err := r.runPreDispatchHook(ctx, appWrapper); !done {
+				return result, err
+			}
 			// create wrapped resources
 			if err, fatal := r.createResources(ctx, appWrapper); err != nil {
-				return r.requeueOrFail(ctx, appWrapper, fatal, err.Error())
+				return r.requeueOrFail(ctx, appWrapper, fatal, failureReason(err, mcadv1beta1.CreationForbidden), err.Error())
+			}
+			// restore replica counts if dispatching a hibernated AppWrapper
+			if err := r.wakeResources(ctx, appWrapper); err != nil {
+				return ctrl.Result{}, err
 			}
 			// set running/created status only after successfully requesting the creation of all resources
 			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Created)
 
 		case mcadv1beta1.Created:
+			// requeue if restart requested
+			if appWrapper.Spec.RestartGeneration != appWrapper.Status.RestartGeneration {
+				appWrapper.Status.RestartGeneration = appWrapper.Spec.RestartGeneration
+				appWrapper.Status.RequeueTimestamp = metav1.Now()
+				return r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, "restart requested")
+			}
+			// migrate to another target if requested or if target is under maintenance
+			if migrated, result, err := r.migrateIfRequested(ctx, appWrapper); migrated || err != nil {
+				return result, err
+			}
+			// hibernate service if requested
+			if appWrapper.Spec.WorkloadType == mcadv1beta1.Service && appWrapper.Spec.Hibernation.Hibernate {
+				if err := r.hibernateResources(ctx, appWrapper); err != nil {
+					return ctrl.Result{}, err
+				}
+				if appWrapper.Spec.Hibernation.ReleaseCapacity {
+					// set queued/hibernated status to release capacity
+					r.triggerDispatch()
+					return r.updateStatus(ctx, appWrapper, mcadv1beta1.Queued, mcadv1beta1.Hibernated)
+				}
+				return r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Hibernated)
+			}
 			// count AppWrapper pods
 			counts, err := r.countPods(ctx, appWrapper)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
-			// check for successful completion by looking at pods and wrapped resources
-			success, err := r.isSuccessful(ctx, appWrapper, counts)
+			// get status of wrapped resources of known kinds
+			statuses, err := r.getResourceStatuses(ctx, appWrapper)
 			if err != nil {
 				return ctrl.Result{}, err
 			}
-			// set succeeded/idle status if done
-			if success {
-				r.triggerDispatch()
-				return r.updateStatus(ctx, appWrapper, mcadv1beta1.Succeeded, mcadv1beta1.Idle)
+			// requeue or fail if a wrapped resource failed, failed resources are workload failures
+			if failure := findFailure(statuses); failure != nil {
+				return r.requeueOrFail(ctx, appWrapper, appWrapper.Spec.RetryPolicy == mcadv1beta1.RetryOnInfraFailureOnly, failure.Code, failure.Message)
+			}
+			// fail on the first failed pod if the retry policy does not permit retrying
+			if failed := fatalFailedPods(appWrapper, counts); failed > 0 {
+				return r.requeueOrFail(ctx, appWrapper, true, mcadv1beta1.PodsFailed, strconv.Itoa(failed)+" failed pods")
+			}
+			// record dashboard URL and pod set statuses
+			podSets := podSetStatuses(appWrapper, counts)
+			if url := findDashboardURL(statuses); url != appWrapper.Status.DashboardURL || !reflect.DeepEqual(podSets, appWrapper.Status.PodSets) {
+				appWrapper.Status.DashboardURL = url
+				appWrapper.Status.PodSets = podSets
+				if err := r.saveStatus(ctx, appWrapper); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			// check for successful completion by looking at pods and wrapped resources unless workload is a service
+			if appWrapper.Spec.WorkloadType != mcadv1beta1.Service {
+				success, err := r.isSuccessful(ctx, appWrapper, counts, statuses)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				// set succeeded/idle status if done
+				if success {
+					// record output artifacts before tearing down pods
+					artifacts, err := r.collectArtifacts(ctx, appWrapper)
+					if err != nil {
+						return ctrl.Result{}, err
+					}
+					appWrapper.Status.Artifacts = artifacts
+					if hasLeader(appWrapper) || hasCompletionHook(appWrapper) || counts.Auxiliary > 0 || counts.Running > 0 || counts.Other > 0 {
+						// set succeeded/deleting status to tear down remaining resources
+						appWrapper.Status.RequeueTimestamp = metav1.Now()
+						return r.updateStatus(ctx, appWrapper, mcadv1beta1.Succeeded, mcadv1beta1.Deleting)
+					}
+					r.triggerDispatch()
+					return r.updateStatus(ctx, appWrapper, mcadv1beta1.Succeeded, mcadv1beta1.Idle)
+				}
+			}
+			// start the clock once images have been pulled if requested
+			timestamp := appWrapper.Status.DispatchTimestamp
+			if appWrapper.Spec.PrePullImages {
+				if appWrapper.Status.PrePullTimestamp.Before(&appWrapper.Status.DispatchTimestamp) {
+					pulled, err := r.isPrePulled(ctx, appWrapper)
+					if err != nil {
+						return ctrl.Result{}, err
+					}
+					// give up waiting after the initial waiting time
+					if !pulled && !metav1.Now().After(timestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds)*time.Second)) {
+						return ctrl.Result{RequeueAfter: prePullDelay}, nil
+					}
+					appWrapper.Status.PrePullTimestamp = metav1.Now()
+					if err := r.saveStatus(ctx, appWrapper); err != nil {
+						return ctrl.Result{}, err
+					}
+					log.FromContext(ctx).Info("Images pulled", "pulled", pulled)
+				}
+				timestamp = appWrapper.Status.PrePullTimestamp
 			}
-			// check pod count if dispatched for a while
-			if metav1.Now().After(appWrapper.Status.DispatchTimestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds)*time.Second)) &&
-				counts.Running+counts.Succeeded < int(appWrapper.Spec.Scheduling.MinAvailable) {
-				customMessage := "expected pods " + strconv.Itoa(int(appWrapper.Spec.Scheduling.MinAvailable)) + " but found pods " + strconv.Itoa(counts.Running+counts.Succeeded)
+			// requeue quickly if the scheduler cannot place enough pods, withhold their requests from future dispatch
+			if r.Config.UnschedulableTimeout > 0 && healthyReplicas(appWrapper, counts, statuses) < int(appWrapper.Spec.Scheduling.MinAvailable) {
+				message, requests, err := r.unschedulablePods(ctx, appWrapper)
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				if message != "" {
+					if appWrapper.Status.Target == localTarget {
+						r.addPhantomCapacity(appWrapper, requests)
+					}
+					return r.requeueOrFail(ctx, appWrapper, false, mcadv1beta1.PodsFailed, "unschedulable pods: "+message)
+				}
+			}
+			// check pod count if dispatched for a while unless wrapped resources report they are ready or pods are not visible
+			// pods running init containers count as progressing until the init time has elapsed
+			healthy := healthyReplicas(appWrapper, counts, statuses) + initializingPods(appWrapper, counts, timestamp)
+			if !isReady(statuses) && r.observesPods(appWrapper) && metav1.Now().After(timestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds)*time.Second)) &&
+				healthy < int(appWrapper.Spec.Scheduling.MinAvailable) {
+				customMessage := "expected pods " + strconv.Itoa(int(appWrapper.Spec.Scheduling.MinAvailable)) + " but found pods " + strconv.Itoa(healthy)
 				// requeue or fail if max retries exhausted with custom error message
-				return r.requeueOrFail(ctx, appWrapper, false, customMessage)
+				return r.requeueOrFail(ctx, appWrapper, false, mcadv1beta1.PodsFailed, customMessage)
+			}
+			// refresh heartbeat by counting pods bypassing the informer cache, requeue if missing for too long
+			if done, result, err := r.heartbeat(ctx, appWrapper, counts, statuses, timestamp); done {
+				return result, err
 			}
 			// AppWrapper is healthy, requeue reconciliation after delay
 			return ctrl.Result{RequeueAfter: runDelay}, nil
 
+		case mcadv1beta1.Hibernated:
+			// wake up if requested
+			if !appWrapper.Spec.Hibernation.Hibernate {
+				if err := r.wakeResources(ctx, appWrapper); err != nil {
+					return ctrl.Result{}, err
+				}
+				// restart the clock
+				appWrapper.Status.DispatchTimestamp = metav1.Now()
+				return r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Created)
+			}
+
 		case mcadv1beta1.Deleting:
+			// give pods a chance to checkpoint before deletion
+			if done, result, err := r.checkpoint(ctx, appWrapper); !done {
+				return result, err
+			}
 			// delete wrapped resources
-			if !r.deleteResources(ctx, appWrapper, appWrapper.Status.RequeueTimestamp) {
+			if !r.deleteOrAbandon(ctx, appWrapper, appWrapper.Status.RequeueTimestamp) {
 				// requeue reconciliation after delay
 				return ctrl.Result{RequeueAfter: deletionDelay}, nil
 			}
-			// reset status to queued/idle
-			appWrapper.Status.Restarts += 1
+			// reset status to queued/idle, migrations and drains do not count as restarts
+			if appWrapper.Status.Migration != nil {
+				appWrapper.Status.Migrations += 1
+			} else if !appWrapper.Status.Drained {
+				appWrapper.Status.Restarts += 1
+			}
+			appWrapper.Status.Drained = false
+			// resources are created with their full replica counts at next dispatch
+			if appWrapper.Status.Shrunk != nil {
+				appWrapper.Status.Shrunk = nil
+				meta.RemoveStatusCondition(&appWrapper.Status.Conditions, shrunkCondition)
+			}
 			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Queued, mcadv1beta1.Idle)
 		}
 
+	case mcadv1beta1.Succeeded:
+		switch appWrapper.Status.Step {
+		case mcadv1beta1.Deleting:
+			// run completion hook before deletion
+			if done, result, err := r.runCompletionHook(ctx, appWrapper); !done {
+				return result, err
+			}
+			// delete remaining wrapped resources
+			if !r.deleteOrAbandon(ctx, appWrapper, appWrapper.Status.RequeueTimestamp) {
+				// requeue reconciliation after delay
+				return ctrl.Result{RequeueAfter: deletionDelay}, nil
+			}
+			// set status to succeeded/idle
+			r.triggerDispatch()
+			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Succeeded, mcadv1beta1.Idle)
+		}
+
 	case mcadv1beta1.Failed:
 		switch appWrapper.Status.Step {
 		case mcadv1beta1.Deleting:
+			// run completion hook before deletion
+			if done, result, err := r.runCompletionHook(ctx, appWrapper); !done {
+				return result, err
+			}
 			// delete wrapped resources
-			if !r.deleteResources(ctx, appWrapper, appWrapper.Status.RequeueTimestamp) {
+			if !r.deleteOrAbandon(ctx, appWrapper, appWrapper.Status.RequeueTimestamp) {
 				// requeue reconciliation after delay
 				return ctrl.Result{RequeueAfter: deletionDelay}, nil
 			}
 			// set status to failed/idle
 			r.triggerDispatch()
 			return r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Idle)
+
+		case mcadv1beta1.Creating, mcadv1beta1.Created:
+			// run completion hook of AppWrapper failed with zero min available, resources are left as is
+			if done, result, err := r.runCompletionHook(ctx, appWrapper); !done {
+				return result, err
+			}
 		}
 	}
-	return ctrl.Result{}, nil
+	return withinLifetime(appWrapper, ctrl.Result{}), nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AppWrapperReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.APIReader == nil {
+		r.APIReader = mgr.GetAPIReader()
+	}
 	// index pods with nodeName key
 	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.Pod{}, specNodeName, func(obj client.Object) []string {
 		pod := obj.(*v1.Pod)
@@ -195,12 +484,54 @@ func (r *AppWrapperReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}); err != nil {
 		return err
 	}
+	// dump the AppWrapper phase cache for diagnostics
+	if err := mgr.AddMetricsExtraHandler(cacheDumpPath, http.HandlerFunc(r.serveCache)); err != nil {
+		return err
+	}
+	// report leaked resources and sweep orphans periodically
+	if err := mgr.AddMetricsExtraHandler(orphansPath, http.HandlerFunc(r.serveOrphans)); err != nil {
+		return err
+	}
+	if r.Config.OrphanSweepPeriod > 0 {
+		if err := mgr.Add(manager.RunnableFunc(r.sweepOrphans)); err != nil {
+			return err
+		}
+	}
+	// resync all AppWrappers periodically
+	if r.Config.ResyncPeriod > 0 {
+		if err := mgr.Add(manager.RunnableFunc(r.resyncPeriodically)); err != nil {
+			return err
+		}
+	}
+	// complete in-flight dispatches on shutdown
+	if err := mgr.Add(manager.RunnableFunc(r.shutdown)); err != nil {
+		return err
+	}
+	// refresh the capacity of each dispatch target on its own cadence
+	for _, target := range r.Targets {
+		if err := mgr.Add(target); err != nil {
+			return err
+		}
+	}
+	// reflect the state of the dispatch subsystem in health probes
+	if err := mgr.AddHealthzCheck("dispatch", r.checkLiveness); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("dispatch", r.readinessCheck(mgr.GetCache())); err != nil {
+		return err
+	}
+	// remember command-line settings for runtime overrides
+	r.baseConfig = r.Config
 	// watch AppWrapper pods, watch events
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&mcadv1beta1.AppWrapper{}).
 		Watches(&v1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.podMapFunc)).
-		WatchesRawSource(&source.Channel{Source: r.Events}, &handler.EnqueueRequestForObject{}).
-		Complete(r)
+		WatchesRawSource(&source.Channel{Source: r.Events}, &handler.EnqueueRequestForObject{})
+	// watch the ConfigMap overriding settings
+	if r.Config.ConfigMap.Name != "" {
+		builder = builder.Watches(&v1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.configMapFunc))
+	}
+	return builder.Complete(r)
 }
 
 // Map labelled pods to corresponding AppWrappers
@@ -212,42 +543,72 @@ func (r *AppWrapperReconciler) podMapFunc(ctx context.Context, obj client.Object
 				return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}}}
 			}
 		}
+	} else if pod.Spec.NodeName != "" && !r.podsChanged.Swap(true) {
+		// non-AppWrapper pod placed, terminated, or deleted, refresh capacity
+		r.triggerDispatch()
 	}
 	return nil
 }
 
 // Update AppWrapper status
 func (r *AppWrapperReconciler) updateStatus(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, phase mcadv1beta1.AppWrapperPhase, step mcadv1beta1.AppWrapperStep, reason ...string) (ctrl.Result, error) {
+	previous := appWrapper.Status // shallow copy of the status before the transition
 	// log transition
 	now := metav1.Now()
 	transition := mcadv1beta1.AppWrapperTransition{Time: now, Phase: phase, Step: step}
 	if len(reason) > 0 {
 		transition.Reason = reason[0]
 	}
+	// record failure reason code when entering the failed phase, clear it when leaving the failed phase
+	if phase != mcadv1beta1.Failed {
+		appWrapper.Status.FailureReason = ""
+	} else if appWrapper.Status.Phase != mcadv1beta1.Failed {
+		transition.Code = appWrapper.Status.FailureReason
+	}
 	appWrapper.Status.Transitions = append(appWrapper.Status.Transitions, transition)
 	if len(appWrapper.Status.Transitions) > 20 {
 		appWrapper.Status.Transitions = appWrapper.Status.Transitions[1:]
 	}
 	appWrapper.Status.TransitionCount++
+	// record dispatch and requeue decisions
+	if phase == mcadv1beta1.Running && (step == mcadv1beta1.Creating || step == mcadv1beta1.Deleting) {
+		record := mcadv1beta1.DispatchRecord{Time: now, Action: mcadv1beta1.Dispatched, Reason: transition.Reason, Target: appWrapper.Status.Target}
+		if step == mcadv1beta1.Deleting {
+			record.Action = mcadv1beta1.Requeued
+		}
+		appWrapper.Status.DispatchHistory = append(appWrapper.Status.DispatchHistory, record)
+		if len(appWrapper.Status.DispatchHistory) > maxDispatchHistory {
+			appWrapper.Status.DispatchHistory = appWrapper.Status.DispatchHistory[1:]
+		}
+	}
 	appWrapper.Status.Phase = phase
 	appWrapper.Status.Step = step
-	// update AppWrapper status in etcd, requeue reconciliation on failure
-	if err := r.Status().Update(ctx, appWrapper); err != nil {
+	// patch AppWrapper status in etcd, requeue reconciliation on failure
+	if err := r.patchStatus(ctx, appWrapper, &previous); err != nil {
 		return ctrl.Result{}, err
 	}
 	// cache AppWrapper status
 	r.addCachedPhase(appWrapper)
+	r.trackResources(appWrapper)
 	log.FromContext(ctx).Info(string(phase), "state", phase, "step", step)
 	return ctrl.Result{}, nil
 }
 
 // Set requeuing or failed status depending on error, configuration, and restarts count
-func (r *AppWrapperReconciler) requeueOrFail(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, fatal bool, reason string) (ctrl.Result, error) {
+// Failures are reported with the given reason code unless caused by exhausting max requeuings
+func (r *AppWrapperReconciler) requeueOrFail(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, fatal bool, code mcadv1beta1.FailureReason, reason string) (ctrl.Result, error) {
+	fatal = fatal || appWrapper.Spec.RetryPolicy == mcadv1beta1.RetryNever // every failure is fatal
 	if appWrapper.Spec.Scheduling.MinAvailable == 0 {
-		// set failed status and leave resources as is
+		// set failed status and leave resources as is, the completion hook runs once per failure
+		appWrapper.Status.FailureReason = code
+		appWrapper.Status.RequeueTimestamp = metav1.Now()
 		return r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, appWrapper.Status.Step, reason)
-	} else if fatal || appWrapper.Spec.Scheduling.Requeuing.MaxNumRequeuings > 0 && appWrapper.Status.Restarts >= appWrapper.Spec.Scheduling.Requeuing.MaxNumRequeuings {
+	} else if fatal || requeuingsExhausted(appWrapper) {
 		// set failed/deleting status (request deletion of wrapped resources)
+		appWrapper.Status.FailureReason = code
+		if !fatal {
+			appWrapper.Status.FailureReason = mcadv1beta1.RetriesExhausted
+		}
 		appWrapper.Status.RequeueTimestamp = metav1.Now()
 		return r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Deleting, reason)
 	}
@@ -256,17 +617,48 @@ func (r *AppWrapperReconciler) requeueOrFail(ctx context.Context, appWrapper *mc
 	return r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, reason)
 }
 
+// Check whether the AppWrapper has exhausted its max requeuings
+func requeuingsExhausted(appWrapper *mcadv1beta1.AppWrapper) bool {
+	return appWrapper.Spec.Scheduling.Requeuing.MaxNumRequeuings > 0 && appWrapper.Status.Restarts >= appWrapper.Spec.Scheduling.Requeuing.MaxNumRequeuings
+}
+
 // Trigger dispatch by means of "*/*" request
+// Triggers are coalesced until the next dispatch evaluation starts, so every trigger is followed by an evaluation
+// If the event channel is full, e.g., with DispatchControl events, the event is sent asynchronously
 func (r *AppWrapperReconciler) triggerDispatch() {
+	if dropEvent() {
+		dispatchTriggers.WithLabelValues("dropped").Inc()
+		return // fault injection
+	}
+	if r.dispatchPending.Swap(true) {
+		dispatchTriggers.WithLabelValues("coalesced").Inc()
+		return // pending trigger not yet processed
+	}
+	e := event.GenericEvent{Object: &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "*", Name: "*"}}}
 	select {
-	case r.Events <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "*", Name: "*"}}}:
+	case r.Events <- e:
+		dispatchTriggers.WithLabelValues("sent").Inc()
 	default:
-		// do not block if event is already in channel
+		// do not block the caller, at most one pending trigger waits for the channel
+		dispatchTriggers.WithLabelValues("deferred").Inc()
+		go func() { r.Events <- e }()
 	}
 }
 
 // Attempt to select and dispatch one appWrapper
 func (r *AppWrapperReconciler) dispatch(ctx context.Context) (ctrl.Result, error) {
+	r.health.lastDispatch.Store(time.Now().UnixNano())
+	r.dispatchPending.Store(false) // later triggers cause another evaluation
+	// do not dispatch while paused, resuming triggers dispatch
+	if r.Config.PauseDispatch {
+		return ctrl.Result{RequeueAfter: dispatchDelay}, nil
+	}
+	// resolve pending dispatch transactions before dispatching again
+	if r.Config.DispatchLog && r.dispatchLog == nil {
+		if err := r.recoverDispatchLog(ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	for {
 		// find next dispatch candidate according to priorities, precedence, and available resources
 		appWrapper, err := r.selectForDispatch(ctx)
@@ -275,6 +667,10 @@ func (r *AppWrapperReconciler) dispatch(ctx context.Context) (ctrl.Result, error
 		}
 		// if no AppWrapper can be dispatched, requeue reconciliation after delay
 		if appWrapper == nil {
+			if r.podsChanged.Load() {
+				// pending capacity refresh
+				return ctrl.Result{RequeueAfter: capacityRefreshDelay}, nil
+			}
 			return ctrl.Result{RequeueAfter: dispatchDelay}, nil
 		}
 		// append appWrapper ID to logger
@@ -290,8 +686,37 @@ func (r *AppWrapperReconciler) dispatch(ctx context.Context) (ctrl.Result, error
 		}
 		// set dispatching time and status
 		appWrapper.Status.DispatchTimestamp = metav1.Now()
-		if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Creating); err != nil {
+		appWrapper.Status.RestartGeneration = appWrapper.Spec.RestartGeneration
+		clearQueueSLO(appWrapper)
+		reasons := []string{}
+		if appWrapper.Status.ExpeditedBy != "" {
+			reasons = append(reasons, "expedited by DispatchControl "+appWrapper.Status.ExpeditedBy)
+			appWrapper.Status.ExpeditedBy = ""
+		}
+		if migration := appWrapper.Status.Migration; migration != nil {
+			reasons = append(reasons, "migrated from "+targetDescription(migration.From))
+			appWrapper.Status.Migration = nil
+		}
+		// record dispatch transaction before updating status
+		var sequence int64
+		if r.Config.DispatchLog {
+			if sequence, err = r.beginDispatch(ctx, appWrapper); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Creating, strings.Join(reasons, ", ")); err != nil {
+			if r.Config.DispatchLog {
+				if err := r.endDispatch(ctx, sequence, mcadv1beta1.DispatchAborted); err != nil {
+					log.FromContext(ctx).Error(err, "Dispatch log error")
+				}
+			}
 			return ctrl.Result{}, err
 		}
+		if r.Config.DispatchLog {
+			if err := r.endDispatch(ctx, sequence, mcadv1beta1.DispatchCommitted); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		r.recordWait(appWrapper)
 	}
 }
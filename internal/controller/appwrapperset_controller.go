@@ -0,0 +1,216 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const (
+	setLabel   = "workload.codeflare.dev/appwrapperset" // label naming the AppWrapperSet of a generated AppWrapper
+	indexLabel = "workload.codeflare.dev/index"         // label holding the index of a generated AppWrapper in its set
+
+	appWrapperIndexPlaceholder = "<APPWRAPPER_INDEX>"
+	paramPlaceholderPrefix     = "<PARAM_"
+)
+
+// AppWrapperSetReconciler generates AppWrappers from AppWrapperSet templates
+type AppWrapperSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// Reconcile one AppWrapperSet
+// Create missing AppWrappers, delete AppWrappers beyond the size of the set, and aggregate AppWrapper statuses
+func (r *AppWrapperSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	set := &mcadv1beta1.AppWrapperSet{}
+	if err := r.Get(ctx, req.NamespacedName, set); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err) // generated AppWrappers are garbage collected
+	}
+	if !set.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	size := int(set.Spec.Replicas)
+	if len(set.Spec.Parameters) > 0 {
+		size = len(set.Spec.Parameters)
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.InNamespace(set.Namespace), client.MatchingLabels{setLabel: set.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	status := mcadv1beta1.AppWrapperSetStatus{}
+	existing := map[int]bool{}
+	completed := []int{}
+	failed := []int{}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		index, err := strconv.Atoi(appWrapper.Labels[indexLabel])
+		if err != nil || index >= size {
+			// delete AppWrappers beyond the size of the set
+			if err := r.Delete(ctx, appWrapper, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+			continue
+		}
+		existing[index] = true
+		status.Total++
+		switch appWrapper.Status.Phase {
+		case mcadv1beta1.Empty, mcadv1beta1.Admitting, mcadv1beta1.Queued:
+			status.Queued++
+		case mcadv1beta1.Running:
+			status.Running++
+		case mcadv1beta1.Succeeded:
+			status.Succeeded++
+			completed = append(completed, index)
+		case mcadv1beta1.Failed, mcadv1beta1.Rejected:
+			status.Failed++
+			failed = append(failed, index)
+		}
+	}
+	status.CompletedIndexes = formatIndexes(completed)
+	status.FailedIndexes = formatIndexes(failed)
+	for index := 0; index < size; index++ {
+		if existing[index] {
+			continue
+		}
+		appWrapper, err := r.newSetMember(set, index)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Template error", "index", index)
+			return ctrl.Result{}, nil // do not retry until the set is updated
+		}
+		if err := r.Create(ctx, appWrapper); err != nil && !apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+		status.Total++
+		status.Queued++
+	}
+	if status != set.Status {
+		set.Status = status
+		if err := r.Status().Update(ctx, set); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// Format indexes as comma-separated ranges, e.g., 0-3,7
+func formatIndexes(indexes []int) string {
+	sort.Ints(indexes)
+	ranges := []string{}
+	for i := 0; i < len(indexes); {
+		j := i
+		for j+1 < len(indexes) && indexes[j+1] == indexes[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(indexes[i]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(indexes[i])+"-"+strconv.Itoa(indexes[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// Generate the AppWrapper with the given index in the set
+func (r *AppWrapperSetReconciler) newSetMember(set *mcadv1beta1.AppWrapperSet, index int) (*mcadv1beta1.AppWrapper, error) {
+	var params map[string]string
+	if index < len(set.Spec.Parameters) {
+		params = set.Spec.Parameters[index]
+	}
+	spec, err := instantiate(&set.Spec.Template.Spec, index, params)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for k, v := range set.Spec.Template.Labels {
+		labels[k] = v
+	}
+	labels[setLabel] = set.Name
+	labels[indexLabel] = strconv.Itoa(index)
+	appWrapper := &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   set.Namespace,
+			Name:        set.Name + "-" + strconv.Itoa(index),
+			Labels:      labels,
+			Annotations: set.Spec.Template.Annotations,
+		},
+		Spec: *spec,
+	}
+	if err := controllerutil.SetControllerReference(set, appWrapper, r.Scheme); err != nil {
+		return nil, err
+	}
+	return appWrapper, nil
+}
+
+// Replace index and parameter placeholders in AppWrapper spec
+func instantiate(template *mcadv1beta1.AppWrapperSpec, index int, params map[string]string) (*mcadv1beta1.AppWrapperSpec, error) {
+	// do not escape the angle brackets of placeholders
+	data, err := marshalUnescaped(template)
+	if err != nil {
+		return nil, err
+	}
+	replacements := []string{appWrapperIndexPlaceholder, strconv.Itoa(index)}
+	for k, v := range params {
+		// escape value for inclusion in JSON string
+		escaped, err := marshalUnescaped(v)
+		if err != nil {
+			return nil, err
+		}
+		replacements = append(replacements, paramPlaceholderPrefix+k+">", string(escaped[1:len(escaped)-1]))
+	}
+	spec := &mcadv1beta1.AppWrapperSpec{}
+	if err := json.Unmarshal([]byte(strings.NewReplacer(replacements...).Replace(string(data))), spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Marshal value to JSON without HTML escaping
+// json.Marshal escapes < and > including in raw templates, which hides placeholders
+func marshalUnescaped(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AppWrapperSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mcadv1beta1.AppWrapperSet{}).
+		Owns(&mcadv1beta1.AppWrapper{}).
+		Complete(r)
+}
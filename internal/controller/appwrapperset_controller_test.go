@@ -0,0 +1,61 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestInstantiate(t *testing.T) {
+	template := &mcadv1beta1.AppWrapperSpec{
+		Resources: mcadv1beta1.AppWrapperResources{
+			GenericItems: []mcadv1beta1.GenericItem{{
+				GenericTemplate: runtime.RawExtension{
+					Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"job-<APPWRAPPER_INDEX>"},"spec":{"containers":[{"name":"c","command":["echo","<PARAM_lr>"]}]}}`),
+				},
+			}},
+		},
+	}
+	spec, err := instantiate(template, 3, map[string]string{"lr": `0.1 "<x>"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pod struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Command []string `json:"command"`
+			} `json:"containers"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(spec.Resources.GenericItems[0].GenericTemplate.Raw, &pod); err != nil {
+		t.Fatal(err)
+	}
+	if want := "job-3"; pod.Metadata.Name != want {
+		t.Errorf("name: got %q, want %q", pod.Metadata.Name, want)
+	}
+	if want := `0.1 "<x>"`; pod.Spec.Containers[0].Command[1] != want {
+		t.Errorf("parameter: got %q, want %q", pod.Spec.Containers[0].Command[1], want)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Wrapped workloads report output artifacts using either convention:
+// - a ConfigMap in the AppWrapper namespace labeled with artifactsLabel=<AppWrapper name> mapping artifact names to URIs
+// - termination message lines of the form "artifact: <name>=<uri>"
+
+const (
+	artifactsLabel = "workload.codeflare.dev/artifacts" // label of ConfigMaps reporting artifacts
+	artifactPrefix = "artifact:"                        // prefix of termination message lines reporting artifacts
+)
+
+// Collect output artifacts reported by wrapped workloads, sorted by name
+// Artifacts reported in termination messages override artifacts reported in ConfigMaps
+func (r *AppWrapperReconciler) collectArtifacts(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) ([]mcadv1beta1.Artifact, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil || c == nil {
+		return nil, err // artifacts require direct access to the target
+	}
+	uris := map[string]string{}
+	configMaps := &v1.ConfigMapList{}
+	if err := c.List(ctx, configMaps, client.InNamespace(appWrapper.Namespace),
+		client.MatchingLabels{artifactsLabel: appWrapper.Name}); err != nil {
+		return nil, err
+	}
+	for _, configMap := range configMaps.Items {
+		for name, uri := range configMap.Data {
+			uris[name] = uri
+		}
+	}
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.UnsafeDisableDeepCopy,
+		client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated == nil {
+				continue
+			}
+			for _, line := range strings.Split(status.State.Terminated.Message, "\n") {
+				if s, ok := strings.CutPrefix(strings.TrimSpace(line), artifactPrefix); ok {
+					if name, uri, ok := strings.Cut(strings.TrimSpace(s), "="); ok {
+						uris[strings.TrimSpace(name)] = strings.TrimSpace(uri)
+					}
+				}
+			}
+		}
+	}
+	artifacts := []mcadv1beta1.Artifact{}
+	for name, uri := range uris {
+		artifacts = append(artifacts, mcadv1beta1.Artifact{Name: name, URI: uri})
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].Name < artifacts[j].Name })
+	return artifacts, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Resources ordering pod shapes from largest to smallest
+var packingOrder = []v1.ResourceName{nvidiaGpu, v1.ResourceCPU, v1.ResourceMemory}
+
+// List pod shapes of AppWrapper from largest to smallest, restricted to the resources participating in fit decisions
+func podShapes(appWrapper *mcadv1beta1.AppWrapper, fit func(Weights) Weights) []Weights {
+	shapes := []Weights{}
+	for i, r := range appWrapper.Spec.Resources.GenericItems {
+		for _, cpr := range r.CustomPodResources {
+			replicas := cpr.Replicas
+			if shrunk, ok := shrunkReplicas(appWrapper, i); ok {
+				replicas = shrunk
+			}
+			for j := int32(0); j < replicas; j++ {
+				shapes = append(shapes, fit(addGPUType(NewWeights(cpr.Requests), appWrapper.Spec.GPUType)))
+			}
+		}
+	}
+	sort.SliceStable(shapes, func(i, j int) bool {
+		for _, name := range packingOrder {
+			if c := shapes[i].Cmp(shapes[j], name); c != 0 {
+				return c > 0
+			}
+		}
+		return false
+	})
+	return shapes
+}
+
+// Place pod shapes onto nodes using first-fit-decreasing bin packing
+// Return the free capacity of the nodes after placement or nil if some pod does not fit
+func packPods(appWrapper *mcadv1beta1.AppWrapper, nodes map[string]*NodeInfo, fit func(Weights) Weights) map[string]Weights {
+	names := make([]string, 0, len(nodes))
+	free := map[string]Weights{}
+	for name, node := range nodes {
+		names = append(names, name)
+		free[name] = Weights{}
+		free[name].Add(node.Free) // copy free capacity before subtracting requests
+	}
+	sort.Strings(names) // deterministic first fit
+	for _, shape := range podShapes(appWrapper, fit) {
+		placed := false
+		for _, name := range names {
+			if shape.Fits(free[name]) {
+				free[name].Sub(shape)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			return nil
+		}
+	}
+	return free
+}
+
+// Reserve the node capacity promised to dispatched AppWrappers whose pods are not bound to nodes yet
+// Pods not yet bound are placed onto nodes using first fit so the same capacity is not promised twice
+func (r *AppWrapperReconciler) reserveUnboundPods(ctx context.Context, nodes map[string]*NodeInfo) error {
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic first fit
+	identity := func(w Weights) Weights { return w }
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		phase, step := r.getCachedPhase(appWrapper)
+		if appWrapper.Status.Target != localTarget || phase != mcadv1beta1.Running ||
+			step != mcadv1beta1.Creating && step != mcadv1beta1.Created {
+			continue
+		}
+		pods := &v1.PodList{}
+		if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
+			client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+			return err
+		}
+		// discard the shapes of bound pods, including terminated pods, their requests are accounted for by the nodes
+		shapes := podShapes(appWrapper, identity)
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName == "" {
+				continue
+			}
+			request := Weights{}
+			for _, container := range pod.Spec.Containers {
+				request.Add(addGPUType(NewWeights(container.Resources.Requests), appWrapper.Spec.GPUType))
+			}
+			for j, shape := range shapes {
+				if shape.Equal(request) && request.Equal(shape) {
+					shapes = append(shapes[:j], shapes[j+1:]...)
+					break
+				}
+			}
+		}
+		// place the shapes of unbound pods
+		for _, shape := range shapes {
+			for _, name := range names {
+				if shape.Fits(nodes[name].Free) {
+					nodes[name].Free.Sub(shape)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
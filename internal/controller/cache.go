@@ -18,11 +18,18 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"sort"
 	"time"
 
-	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
 )
 
 // We cache AppWrapper phases because the reconciler cache does not immediately reflect updates.
@@ -35,6 +42,20 @@ import (
 
 // TODO garbage collection
 
+const (
+	cacheDumpPath       = "/debug/mcad/cache" // path of the cache dump on the metrics endpoint
+	cacheConflictReason = "CacheConflict"     // event reason for persistent cache conflicts
+)
+
+// Outcomes of cache consistency checks
+const (
+	cacheInSync             = "in_sync"             // caches agree
+	cacheStaleReconciler    = "stale_reconciler"    // reconciler cache is behind our cache
+	cacheStalePhase         = "stale_phase"         // our cache is behind the reconciler cache
+	cachePhaseConflict      = "phase_conflict"      // caches disagree on the phase of the same transition
+	cachePersistentConflict = "persistent_conflict" // reconciler cache has been behind for too long
+)
+
 // Cached AppWrapper
 type CachedAppWrapper struct {
 	// AppWrapper phase
@@ -48,16 +69,87 @@ type CachedAppWrapper struct {
 
 	// First conflict detected between reconciler cache and our cache if not nil
 	Conflict *time.Time
+
+	// AppWrapper paused because of a persistent conflict
+	Paused bool
+}
+
+// ConflictPolicy is the response to persistent conflicts between the reconciler cache and our cache
+type ConflictPolicy string
+
+const (
+	// Drop the cache entry and trust the reconciler cache
+	DropCacheEntry ConflictPolicy = "Drop"
+
+	// Keep the cache entry and stop acting on the AppWrapper until the reconciler cache catches up
+	PauseAppWrapper ConflictPolicy = "Pause"
+
+	// Drop the cache entry and emit a warning event on the AppWrapper
+	AlertConflict ConflictPolicy = "Alert"
+)
+
+// Parse conflict policy name
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(s); p {
+	case DropCacheEntry, PauseAppWrapper, AlertConflict:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid conflict policy %q", s)
+}
+
+// Return the time after which a conflict is persistent
+func (r *AppWrapperReconciler) conflictTimeout() time.Duration {
+	if r.Config.CacheConflictTimeout > 0 {
+		return r.Config.CacheConflictTimeout
+	}
+	return cacheConflictTimeout
+}
+
+// Respond to a persistent conflict according to the conflict policy
+func (r *AppWrapperReconciler) persistentConflict(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, cached *CachedAppWrapper) {
+	switch r.Config.ConflictPolicy {
+	case PauseAppWrapper:
+		if !cached.Paused {
+			cacheChecks.WithLabelValues(cachePersistentConflict).Inc()
+			cached.Paused = true
+			log.FromContext(ctx).Error(errors.New("cache timeout"), "Pausing AppWrapper")
+			r.Recorder.Event(appWrapper, v1.EventTypeWarning, cacheConflictReason,
+				"Paused until the reconciler cache reflects the last status update")
+		}
+	case AlertConflict:
+		cacheChecks.WithLabelValues(cachePersistentConflict).Inc()
+		endConflict(cached)
+		r.deleteCachedPhase(appWrapper)
+		log.FromContext(ctx).Error(errors.New("cache timeout"), "Internal error")
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, cacheConflictReason,
+			"Reconciler cache did not reflect the last status update, dropped cached phase")
+	default:
+		cacheChecks.WithLabelValues(cachePersistentConflict).Inc()
+		endConflict(cached)
+		r.deleteCachedPhase(appWrapper)
+		log.FromContext(ctx).Error(errors.New("cache timeout"), "Internal error")
+	}
 }
 
 // Add AppWrapper to cache
 func (r *AppWrapperReconciler) addCachedPhase(appWrapper *mcadv1beta1.AppWrapper) {
 	r.Cache[appWrapper.UID] = &CachedAppWrapper{Phase: appWrapper.Status.Phase, Step: appWrapper.Status.Step, TransitionCount: appWrapper.Status.TransitionCount}
+	cacheEntries.Set(float64(len(r.Cache)))
 }
 
 // Remove AppWrapper from cache
 func (r *AppWrapperReconciler) deleteCachedPhase(appWrapper *mcadv1beta1.AppWrapper) {
 	delete(r.Cache, appWrapper.UID)
+	cacheEntries.Set(float64(len(r.Cache)))
+}
+
+// Record the end of a conflict if any
+func endConflict(cached *CachedAppWrapper) {
+	if cached.Conflict != nil {
+		cacheConflictSeconds.Observe(time.Since(*cached.Conflict).Seconds())
+		cached.Conflict = nil // clear conflict timestamp
+	}
+	cached.Paused = false
 }
 
 // Get AppWrapper phase from cache if available or from AppWrapper if not
@@ -75,33 +167,57 @@ func (r *AppWrapperReconciler) isStale(ctx context.Context, appWrapper *mcadv1be
 		// check number of transitions
 		if cached.TransitionCount < status.TransitionCount {
 			// our cache is behind, update our cache, this is ok
+			cacheChecks.WithLabelValues(cacheStalePhase).Inc()
 			r.Cache[appWrapper.UID] = &CachedAppWrapper{Phase: status.Phase, TransitionCount: status.TransitionCount}
-			cached.Conflict = nil // clear conflict timestamp
+			endConflict(cached)
 			return false
 		}
 		if cached.TransitionCount > status.TransitionCount {
 			// reconciler cache appears to be behind
 			if cached.Conflict != nil {
-				if time.Now().After(cached.Conflict.Add(cacheConflictTimeout)) {
+				if time.Now().After(cached.Conflict.Add(r.conflictTimeout())) {
 					// this has been going on for a while, assume something is wrong with our cache
-					delete(r.Cache, appWrapper.UID)
-					log.FromContext(ctx).Error(errors.New("cache timeout"), "Internal error")
+					r.persistentConflict(ctx, appWrapper, cached)
 					return true
 				}
 			} else {
 				now := time.Now()
 				cached.Conflict = &now // remember when conflict started
 			}
+			cacheChecks.WithLabelValues(cacheStaleReconciler).Inc()
 			return true
 		}
 		if cached.Phase != status.Phase || cached.Step != status.Step {
 			// assume something is wrong with our cache
-			delete(r.Cache, appWrapper.UID)
+			cacheChecks.WithLabelValues(cachePhaseConflict).Inc()
+			r.deleteCachedPhase(appWrapper)
 			log.FromContext(ctx).Error(errors.New("cache conflict"), "Internal error")
 			return true
 		}
 		// caches appear to be in sync
-		cached.Conflict = nil // clear conflict timestamp
+		cacheChecks.WithLabelValues(cacheInSync).Inc()
+		endConflict(cached)
 	}
 	return false
 }
+
+// Entry of the cache dump
+type cacheDumpEntry struct {
+	UID types.UID `json:"uid"`
+	CachedAppWrapper
+}
+
+// Serve the contents of the AppWrapper phase cache as JSON
+func (r *AppWrapperReconciler) serveCache(w http.ResponseWriter, _ *http.Request) {
+	r.mutex.Lock()
+	entries := make([]cacheDumpEntry, 0, len(r.Cache))
+	for uid, cached := range r.Cache {
+		entries = append(entries, cacheDumpEntry{UID: uid, CachedAppWrapper: *cached})
+	}
+	r.mutex.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].UID < entries[j].UID })
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		mcadLog.Error(err, "Cache dump error")
+	}
+}
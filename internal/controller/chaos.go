@@ -0,0 +1,139 @@
+//go:build chaos
+
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Fault injection is enabled by building with -tags chaos
+// Fault rates are configured using environment variables:
+// MCAD_CHAOS_ERROR_RATE is the probability of failing a write request (default 0.05)
+// MCAD_CHAOS_DROP_RATE is the probability of dropping a dispatch trigger (default 0.1)
+// MCAD_CHAOS_MAX_DELAY is the maximum delay of a status update (default 1s)
+
+var (
+	chaosErrorRate = envFloat("MCAD_CHAOS_ERROR_RATE", 0.05)
+	chaosDropRate  = envFloat("MCAD_CHAOS_DROP_RATE", 0.1)
+	chaosMaxDelay  = envDuration("MCAD_CHAOS_MAX_DELAY", time.Second)
+)
+
+func envFloat(name string, value float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil {
+		return v
+	}
+	return value
+}
+
+func envDuration(name string, value time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+	return value
+}
+
+// Return a random error with probability chaosErrorRate
+func injectFault() error {
+	if rand.Float64() < chaosErrorRate {
+		return apierrors.NewServiceUnavailable("injected fault")
+	}
+	return nil
+}
+
+// Sleep for a random duration up to chaosMaxDelay
+func injectDelay() {
+	if chaosMaxDelay > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(chaosMaxDelay))))
+	}
+}
+
+// Check whether to drop a dispatch trigger
+func dropEvent() bool {
+	return rand.Float64() < chaosDropRate
+}
+
+// Wrap client to inject faults into write requests
+func WithFaultInjection(c client.Client) client.Client {
+	return &chaosClient{Client: c}
+}
+
+// Client injecting faults into write requests
+type chaosClient struct {
+	client.Client
+}
+
+func (c *chaosClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *chaosClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *chaosClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *chaosClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *chaosClient) Status() client.SubResourceWriter {
+	return &chaosStatusWriter{SubResourceWriter: c.Client.Status()}
+}
+
+// Status writer delaying status updates and injecting faults
+type chaosStatusWriter struct {
+	client.SubResourceWriter
+}
+
+func (w *chaosStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	injectDelay()
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *chaosStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	injectDelay()
+	if err := injectFault(); err != nil {
+		return err
+	}
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
@@ -0,0 +1,35 @@
+//go:build !chaos
+
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Fault injection is disabled unless building with -tags chaos
+
+// Return client as is
+func WithFaultInjection(c client.Client) client.Client {
+	return c
+}
+
+// Never drop dispatch triggers
+func dropEvent() bool {
+	return false
+}
@@ -0,0 +1,179 @@
+//go:build chaos
+
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Scenarios run against envtest with fault injection enabled:
+// KUBEBUILDER_ASSETS=... go test -tags chaos ./internal/controller
+
+// Make an AppWrapper requesting cpus and wrapping a ConfigMap
+func chaosAppWrapper(name string, priority int32, cpus string) *mcadv1beta1.AppWrapper {
+	return &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: mcadv1beta1.AppWrapperSpec{
+			Priority: priority,
+			Resources: mcadv1beta1.AppWrapperResources{
+				GenericItems: []mcadv1beta1.GenericItem{{
+					CustomPodResources: []mcadv1beta1.CustomPodResource{{
+						Replicas: 1,
+						Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpus)},
+					}},
+					GenericTemplate: runtime.RawExtension{
+						Raw: []byte(fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"%s"}}`, name)),
+					},
+				}},
+			},
+		},
+	}
+}
+
+// Check that the transitions of an AppWrapper follow the expected state machine
+func validTransitions(appWrapper *mcadv1beta1.AppWrapper) error {
+	if appWrapper.Status.TransitionCount < int32(len(appWrapper.Status.Transitions)) {
+		return fmt.Errorf("transition count %d lower than %d recorded transitions",
+			appWrapper.Status.TransitionCount, len(appWrapper.Status.Transitions))
+	}
+	for i := 1; i < len(appWrapper.Status.Transitions); i++ {
+		prev := appWrapper.Status.Transitions[i-1]
+		next := appWrapper.Status.Transitions[i]
+		if prev.Phase == next.Phase && prev.Step == next.Step {
+			return fmt.Errorf("duplicate transition to %s/%s", next.Phase, next.Step)
+		}
+		if next.Phase == mcadv1beta1.Running && next.Step == mcadv1beta1.Creating && prev.Phase != mcadv1beta1.Queued {
+			return fmt.Errorf("dispatch from %s/%s", prev.Phase, prev.Step)
+		}
+	}
+	return nil
+}
+
+// ConfigMap used to resume dispatch once all AppWrappers are queued
+var chaosConfig = types.NamespacedName{Namespace: "default", Name: "chaos-config"}
+
+var _ = Describe("Fault injection", Ordered, func() {
+	var cancel context.CancelFunc
+	var node *v1.Node
+
+	BeforeAll(func() {
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+
+		By("creating a node with 4 cpus")
+		node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "chaos-node"}}
+		Expect(k8sClient.Create(ctx, node)).To(Succeed())
+		node.Status.Capacity = v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}
+		node.Status.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}
+		Expect(k8sClient.Status().Update(ctx, node)).To(Succeed())
+
+		By("starting the controller with fault injection and dispatch paused")
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect((&AppWrapperReconciler{
+			Client:   WithFaultInjection(mgr.GetClient()),
+			Scheme:   mgr.GetScheme(),
+			Cache:    map[types.UID]*CachedAppWrapper{},
+			Events:   make(chan event.GenericEvent, 1),
+			Recorder: mgr.GetEventRecorderFor("mcad"),
+			Config:   Config{PauseDispatch: true, ConfigMap: chaosConfig},
+		}).SetupWithManager(mgr)).To(Succeed())
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(ctx)).To(Succeed())
+		}()
+	})
+
+	AfterAll(func() {
+		cancel()
+		Expect(k8sClient.Delete(context.Background(), node)).To(Succeed())
+		Expect(k8sClient.Delete(context.Background(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: chaosConfig.Namespace, Name: chaosConfig.Name}})).To(Succeed())
+	})
+
+	It("dispatches by priority without exceeding capacity", func(ctx SpecContext) {
+		By("queuing AppWrappers that each require the whole node")
+		for i := int32(0); i < 4; i++ {
+			Expect(k8sClient.Create(ctx, chaosAppWrapper(fmt.Sprintf("chaos-%d", i), i, "4"))).To(Succeed())
+		}
+		Eventually(func() (int, error) {
+			appWrappers := &mcadv1beta1.AppWrapperList{}
+			err := k8sClient.List(ctx, appWrappers, client.InNamespace("default"))
+			queued := 0
+			for _, appWrapper := range appWrappers.Items {
+				if appWrapper.Status.Phase == mcadv1beta1.Queued {
+					queued += 1
+				}
+			}
+			return queued, err
+		}, time.Minute, time.Second).Should(Equal(4))
+
+		By("resuming dispatch")
+		Expect(k8sClient.Create(ctx, &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: chaosConfig.Namespace, Name: chaosConfig.Name},
+			Data:       map[string]string{"pause-dispatch": "false"},
+		})).To(Succeed())
+
+		By("checking the highest priority AppWrapper is dispatched")
+		Eventually(func() (mcadv1beta1.AppWrapperStep, error) {
+			appWrapper := &mcadv1beta1.AppWrapper{}
+			err := k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "chaos-3"}, appWrapper)
+			return appWrapper.Status.Step, err
+		}, time.Minute, time.Second).Should(Equal(mcadv1beta1.Created))
+
+		By("checking capacity is never exceeded and transitions remain valid")
+		Consistently(func() error {
+			appWrappers := &mcadv1beta1.AppWrapperList{}
+			if err := k8sClient.List(ctx, appWrappers, client.InNamespace("default")); err != nil {
+				return err
+			}
+			dispatched := 0
+			for i := range appWrappers.Items {
+				appWrapper := &appWrappers.Items[i]
+				if err := validTransitions(appWrapper); err != nil {
+					return fmt.Errorf("%s: %w", appWrapper.Name, err)
+				}
+				if appWrapper.Status.Phase == mcadv1beta1.Running {
+					dispatched += 1
+				}
+			}
+			if dispatched > 1 {
+				return fmt.Errorf("%d AppWrappers dispatched on a single node", dispatched)
+			}
+			return nil
+		}, 10*time.Second, time.Second).Should(Succeed())
+	})
+})
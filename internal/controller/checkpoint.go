@@ -0,0 +1,132 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Checkpoint/restore contract with wrapped pods:
+// - before requeuing, running pods are annotated with the checkpoint location and given a grace period to write a checkpoint,
+// pods observe their annotations in file /etc/mcad-checkpoint/annotations using the downward API
+// - when dispatching again, pods are annotated with the location of the last checkpoint
+// and the MCAD_RESTORE_PATH environment variable is set to this location
+
+const (
+	checkpointAnnotation = "workload.codeflare.dev/checkpoint"   // where to write a checkpoint now
+	restoreAnnotation    = "workload.codeflare.dev/restore-from" // where to restore from
+	restoreEnv           = "MCAD_RESTORE_PATH"
+	checkpointVolume     = "mcad-checkpoint"
+	checkpointMountPath  = "/etc/mcad-checkpoint"
+)
+
+// Request running pods to checkpoint before requeuing and wait for the grace period
+// Return true once wrapped resources may be deleted, immediately if the target has failed
+func (r *AppWrapperReconciler) checkpoint(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	spec := appWrapper.Spec.Checkpoint
+	if spec == nil || r.failedTarget(appWrapper) != "" {
+		return true, ctrl.Result{}, nil
+	}
+	// wait for grace period if checkpoint already requested for this requeuing
+	if !appWrapper.Status.CheckpointTimestamp.Before(&appWrapper.Status.RequeueTimestamp) {
+		remaining := time.Until(appWrapper.Status.CheckpointTimestamp.Add(time.Duration(spec.GracePeriodInSeconds) * time.Second))
+		if remaining > 0 {
+			return false, ctrl.Result{RequeueAfter: remaining}, nil
+		}
+		return true, ctrl.Result{}, nil
+	}
+	c, err := r.targetClient(appWrapper)
+	if err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if c == nil {
+		return true, ctrl.Result{}, nil // checkpoints require direct access to the target
+	}
+	path := strings.TrimSuffix(spec.Path, "/") + "/" + string(appWrapper.UID) + "/" + strconv.Itoa(int(appWrapper.Status.Restarts))
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods,
+		client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	requested := false
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != v1.PodRunning || pod.Labels[auxiliaryLabel] == "true" {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[checkpointAnnotation] = path
+		if err := c.Patch(ctx, pod, patch); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		requested = true
+	}
+	// keep previous checkpoint location if no pod could checkpoint
+	if requested {
+		appWrapper.Status.CheckpointPath = path
+		log.FromContext(ctx).Info("Checkpoint requested", "path", path)
+	}
+	appWrapper.Status.CheckpointTimestamp = metav1.Now()
+	if err := r.saveStatus(ctx, appWrapper); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if !requested {
+		return true, ctrl.Result{}, nil
+	}
+	return false, ctrl.Result{RequeueAfter: time.Duration(spec.GracePeriodInSeconds) * time.Second}, nil
+}
+
+// Expose pod annotations to containers and point to the last checkpoint if any
+func injectCheckpoint(appWrapper *mcadv1beta1.AppWrapper, metadata map[string]interface{}, spec map[string]interface{}) {
+	if appWrapper.Spec.Checkpoint == nil {
+		return
+	}
+	appendUnique(spec, "volumes", map[string]interface{}{
+		"name": checkpointVolume,
+		"downwardAPI": map[string]interface{}{"items": []interface{}{map[string]interface{}{
+			"path":     "annotations",
+			"fieldRef": map[string]interface{}{"fieldPath": "metadata.annotations"},
+		}}},
+	})
+	path := appWrapper.Status.CheckpointPath
+	if path != "" {
+		setNestedString(metadata, "annotations", restoreAnnotation, path)
+	}
+	containers, _ := spec["containers"].([]interface{})
+	for _, container := range containers {
+		if container, ok := container.(map[string]interface{}); ok {
+			appendUnique(container, "volumeMounts", map[string]interface{}{"name": checkpointVolume, "mountPath": checkpointMountPath, "readOnly": true})
+			if path != "" {
+				appendUnique(container, "env", map[string]interface{}{"name": restoreEnv, "value": path})
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const clusterInfoName = "mcad" // name of the ClusterInfo object publishing the dispatcher ledger
+
+// Publish dispatcher ledger to ClusterInfo object, creating the object if necessary
+// Errors are logged but do not prevent dispatch
+func (r *AppWrapperReconciler) publishClusterInfo(ctx context.Context, requests map[int]Weights, available map[int]Weights,
+	allocations []mcadv1beta1.AllocationStatus, queue []*mcadv1beta1.AppWrapper) {
+	clusterInfo := &mcadv1beta1.ClusterInfo{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clusterInfoName}, clusterInfo); err != nil {
+		if !errors.IsNotFound(err) {
+			mcadLog.Error(err, "ClusterInfo error")
+			return
+		}
+		clusterInfo = &mcadv1beta1.ClusterInfo{ObjectMeta: metav1.ObjectMeta{Name: clusterInfoName}}
+		if err := r.Create(ctx, clusterInfo); err != nil {
+			mcadLog.Error(err, "ClusterInfo error")
+			return
+		}
+	}
+	reservations := []mcadv1beta1.ReservationStatus{}
+	for priority, request := range requests {
+		reservations = append(reservations, mcadv1beta1.ReservationStatus{Priority: int32(priority),
+			Reserved: request.AsResources(), Free: available[priority].AsResources()})
+	}
+	sort.Slice(reservations, func(i, j int) bool { return reservations[i].Priority > reservations[j].Priority })
+	clusterInfo.Status = mcadv1beta1.ClusterInfoStatus{
+		Time:         metav1.Now(),
+		Capacity:     r.ClusterCapacity.AsResources(),
+		Reservations: reservations,
+		Allocations:  allocations,
+		Namespaces:   r.fairnessReport(allocations, queue),
+	}
+	if len(r.Targets) > 0 {
+		clusterInfo.Status.Targets, clusterInfo.Status.AggregateCapacity = r.targetStatuses()
+	}
+	updateQueueMetrics(allocations, queue)
+	if err := r.Status().Update(ctx, clusterInfo); err != nil {
+		mcadLog.Error(err, "ClusterInfo error")
+	}
+}
+
+// Report the capacity of the local cluster and each dispatch target as well as the aggregate capacity
+func (r *AppWrapperReconciler) targetStatuses() ([]mcadv1beta1.TargetStatus, v1.ResourceList) {
+	aggregate := Weights{}
+	aggregate.Add(r.ClusterCapacity)
+	updateTargetMetrics("", r.ClusterCapacity)
+	statuses := []mcadv1beta1.TargetStatus{{Time: metav1.Now(), Capacity: r.ClusterCapacity.AsResources(), Nodes: int32(len(r.Nodes)), Healthy: true}}
+	for _, target := range r.Targets {
+		capacity, nodes, time, err := target.Capacity()
+		status := mcadv1beta1.TargetStatus{Name: target.Name, Time: metav1.NewTime(time), Capacity: capacity.AsResources(), Nodes: int32(len(nodes)), Healthy: err == nil}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		aggregate.Add(capacity)
+		statuses = append(statuses, status)
+	}
+	updateAggregateMetrics(aggregate)
+	return statuses, aggregate.AsResources()
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Config holds the installation-wide settings of the AppWrapper controller
+type Config struct {
+	// ConfigMap overriding settings at runtime if any
+	ConfigMap types.NamespacedName
+
+	// Stop dispatching queued AppWrappers
+	PauseDispatch bool
+
+	// Inject the PriorityClass matching the AppWrapper priority into wrapped pods
+	InjectPriorityClass bool
+
+	// Period of the inventory of leaked resources, never if zero
+	OrphanSweepPeriod time.Duration
+
+	// Period of the full resync of AppWrappers, never if zero
+	ResyncPeriod time.Duration
+
+	// Set owner references on wrapped resources created in the namespace of their AppWrapper on the local cluster
+	OwnerReferences bool
+
+	// Requeue running AppWrappers when cluster capacity shrinks below their requests
+	RequeueOnCapacityShrink bool
+
+	// Capacity withheld from dispatch to absorb fragmentation
+	SafetyMargins map[v1.ResourceName]Margin
+
+	// Time after which conflicts between the reconciler cache and our cache are persistent, default if zero
+	CacheConflictTimeout time.Duration
+
+	// Response to persistent cache conflicts
+	ConflictPolicy ConflictPolicy
+
+	// Record dispatch decisions in the DispatchLog object before acting and recover pending decisions on startup
+	DispatchLog bool
+
+	// Requeue lower-priority AppWrappers to make room for queued AppWrappers instead of overcommitting the local cluster
+	Preemption bool
+
+	// Time after dispatch during which AppWrappers cannot be preempted
+	PreemptionProtection time.Duration
+
+	// Resources that participate in fit and quota decisions, all resources if empty
+	FitResources []v1.ResourceName
+
+	// Require every pod of an AppWrapper to fit the free capacity of some node
+	BinPacking bool
+
+	// Maximum number of GPUs of each type allocated to AppWrappers
+	GPUQuotas map[string]int64
+
+	// Order of queued AppWrappers with equal priorities
+	TieBreaker TieBreaker
+
+	// Priority bands by decreasing minimum priority, all priorities are strictly ordered if empty
+	PriorityBands []PriorityBand
+
+	// Maximum number of queued AppWrappers per namespace, unlimited if zero
+	MaxQueuedPerNamespace int
+
+	// Maximum number of queued AppWrappers per queue, unlimited if zero
+	MaxQueuedPerQueue int
+
+	// Max number of queued AppWrappers per submitter, unlimited if zero
+	MaxQueuedPerUser int
+
+	// Defaults injected into the wrapped pods of AppWrappers in matching namespaces or queues
+	InjectionProfiles []InjectionProfile
+
+	// Public keys verifying the signatures of resource templates, templates are not verified if empty
+	PayloadKeys []crypto.PublicKey
+
+	// Submit the rendered wrapped resources of new AppWrappers to admission in dry-run mode and reject violations
+	PolicyDryRun bool
+
+	// Refuse wrapped resources outside of the AppWrapper namespace, cluster-scoped resources, and reserved labels
+	StrictIsolation bool
+
+	// Record the submitter annotation set by the admission webhook in the status of new AppWrappers
+	RecordSubmitter bool
+
+	// Maximum size in bytes of an inline resource template, unlimited if zero
+	MaxTemplateSize int
+
+	// Offload oversized resource templates to ConfigMaps instead of rejecting the AppWrapper
+	OffloadTemplates bool
+
+	// Time after which AppWrappers creating or deleting resources are considered stuck, never if zero
+	StuckTimeout time.Duration
+
+	// Response to stuck AppWrappers
+	StuckPolicy StuckPolicy
+
+	// Treatment of terminating pods in resource accounting
+	TerminatingPods TerminatingPodPolicy
+
+	// Time after which finalizers blocking the deletion of wrapped resources are removed, never if zero
+	FinalizerRemovalTimeout time.Duration
+
+	// Finalizers that may be removed from wrapped resources, "*" matches all finalizers
+	StrippableFinalizers []string
+
+	// Time after which AppWrappers with unschedulable pods are requeued, never if zero
+	UnschedulableTimeout time.Duration
+
+	// Honor the quota exemption annotation, which must be policed by the validating webhook
+	QuotaExemption bool
+
+	// Order of eligible dispatch targets with equal placement scores
+	TargetPolicy TargetPolicy
+
+	// Points added to the placement score of a dispatch target per free GPU, free capacity is left to the target policy if zero
+	FreeGPUWeight float64
+
+	// URL of the external placement scorer if any
+	PlacementScorer string
+
+	// URL of the external secret resolver for secret placeholders in wrapped resources if any
+	SecretResolver string
+
+	// Prefixes of the URLs allowed for webhook hooks, webhook hooks fail if empty
+	HookURLPrefixes []string
+
+	// Placement properties of the local cluster
+	LocalTarget TargetProperties
+
+	// Time after which AppWrappers running on an unhealthy dispatch target are requeued, never if zero
+	TargetOutageTimeout time.Duration
+
+	// Time after which running AppWrappers without healthy pods observed bypassing the informer cache are requeued, never if zero
+	HeartbeatTimeout time.Duration
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const (
+	cronLabel               = "workload.codeflare.dev/cronappwrapper" // label naming the CronAppWrapper of a generated AppWrapper
+	scheduledTimeAnnotation = "workload.codeflare.dev/scheduled-time" // scheduled time of a generated AppWrapper
+
+	maxMissedRuns = 100 // maximum number of missed runs before skipping to the most recent run
+
+	defaultSuccessfulHistoryLimit = 3 // succeeded AppWrappers to retain if unspecified
+	defaultFailedHistoryLimit     = 1 // failed AppWrappers to retain if unspecified
+)
+
+// CronAppWrapperReconciler creates AppWrappers on a schedule and garbage-collects completed AppWrappers
+type CronAppWrapperReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// Reconcile one CronAppWrapper
+func (r *CronAppWrapperReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	cronAppWrapper := &mcadv1beta1.CronAppWrapper{}
+	if err := r.Get(ctx, req.NamespacedName, cronAppWrapper); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err) // generated AppWrappers are garbage collected
+	}
+	if !cronAppWrapper.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.InNamespace(cronAppWrapper.Namespace),
+		client.MatchingLabels{cronLabel: cronAppWrapper.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	// classify AppWrappers
+	active := []*mcadv1beta1.AppWrapper{}
+	succeeded := []*mcadv1beta1.AppWrapper{}
+	failed := []*mcadv1beta1.AppWrapper{}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if !appWrapper.DeletionTimestamp.IsZero() {
+			continue
+		}
+		switch appWrapper.Status.Phase {
+		case mcadv1beta1.Succeeded:
+			succeeded = append(succeeded, appWrapper)
+		case mcadv1beta1.Failed, mcadv1beta1.Rejected:
+			failed = append(failed, appWrapper)
+		default:
+			active = append(active, appWrapper)
+		}
+	}
+	// garbage-collect old AppWrappers beyond history limits
+	if err := r.deleteOldest(ctx, succeeded, historyLimit(cronAppWrapper.Spec.SuccessfulHistoryLimit, defaultSuccessfulHistoryLimit)); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.deleteOldest(ctx, failed, historyLimit(cronAppWrapper.Spec.FailedHistoryLimit, defaultFailedHistoryLimit)); err != nil {
+		return ctrl.Result{}, err
+	}
+	// report active AppWrappers
+	names := []string{}
+	for _, appWrapper := range active {
+		names = append(names, appWrapper.Name)
+	}
+	sort.Strings(names)
+	if fmt.Sprint(names) != fmt.Sprint(cronAppWrapper.Status.Active) {
+		cronAppWrapper.Status.Active = names
+		if err := r.Status().Update(ctx, cronAppWrapper); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if cronAppWrapper.Spec.Suspend {
+		return ctrl.Result{}, nil
+	}
+	schedule, err := cron.ParseStandard(cronAppWrapper.Spec.Schedule)
+	if err != nil {
+		log.Error(err, "Invalid schedule", "schedule", cronAppWrapper.Spec.Schedule)
+		return ctrl.Result{}, nil // do not retry until the schedule is updated
+	}
+	// find most recent missed run if any
+	now := time.Now()
+	last := cronAppWrapper.CreationTimestamp.Time
+	if !cronAppWrapper.Status.LastScheduleTime.IsZero() {
+		last = cronAppWrapper.Status.LastScheduleTime.Time
+	}
+	if deadline := cronAppWrapper.Spec.StartingDeadlineSeconds; deadline != nil {
+		if earliest := now.Add(-time.Duration(*deadline) * time.Second); earliest.After(last) {
+			last = earliest // runs missed past the deadline are skipped
+		}
+	}
+	missed, skipped := mostRecentRun(schedule, last, now)
+	if skipped {
+		log.Info("Too many missed runs, skipping to most recent run", "time", missed)
+	}
+	next := ctrl.Result{RequeueAfter: time.Until(schedule.Next(now))}
+	if missed.IsZero() {
+		return next, nil
+	}
+	// apply concurrency policy
+	switch cronAppWrapper.Spec.ConcurrencyPolicy {
+	case mcadv1beta1.ForbidConcurrent:
+		if len(active) > 0 {
+			log.Info("Skipping run, previous run is still active", "time", missed)
+			cronAppWrapper.Status.LastScheduleTime = metav1.NewTime(missed)
+			if err := r.Status().Update(ctx, cronAppWrapper); err != nil {
+				return ctrl.Result{}, err
+			}
+			return next, nil
+		}
+	case mcadv1beta1.ReplaceConcurrent:
+		for _, appWrapper := range active {
+			if err := r.Delete(ctx, appWrapper, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	appWrapper, err := r.newRun(cronAppWrapper, missed)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, appWrapper); err != nil && !apierrors.IsAlreadyExists(err) {
+		return ctrl.Result{}, err
+	}
+	log.Info("Created run", "appwrapper", appWrapper.Name, "time", missed)
+	cronAppWrapper.Status.LastScheduleTime = metav1.NewTime(missed)
+	if err := r.Status().Update(ctx, cronAppWrapper); err != nil {
+		return ctrl.Result{}, err
+	}
+	return next, nil
+}
+
+// Return the history limit or the default if nil
+func historyLimit(limit *int32, defaultLimit int) int {
+	if limit == nil {
+		return defaultLimit
+	}
+	return int(*limit)
+}
+
+// Return the most recent run scheduled after last and no later than now, zero if none
+// Report whether more than maxMissedRuns runs were skipped to find it
+func mostRecentRun(schedule cron.Schedule, last time.Time, now time.Time) (time.Time, bool) {
+	var missed time.Time
+	count := 0
+	for t := schedule.Next(last); !t.After(now); t = schedule.Next(t) {
+		missed = t
+		if count++; count > maxMissedRuns {
+			// search windows ending now of doubling length for the most recent run
+			for window := time.Minute; ; window *= 2 {
+				start := now.Add(-window)
+				if start.Before(missed) {
+					start = missed
+				}
+				recent := missed
+				for t := schedule.Next(start); !t.After(now); t = schedule.Next(t) {
+					recent = t
+				}
+				if recent.After(missed) || start.Equal(missed) {
+					return recent, true
+				}
+			}
+		}
+	}
+	return missed, false
+}
+
+// Delete oldest AppWrappers in excess of the history limit
+func (r *CronAppWrapperReconciler) deleteOldest(ctx context.Context, appWrappers []*mcadv1beta1.AppWrapper, limit int) error {
+	sort.Slice(appWrappers, func(i, j int) bool {
+		return appWrappers[i].CreationTimestamp.Before(&appWrappers[j].CreationTimestamp)
+	})
+	for i := 0; i < len(appWrappers)-limit; i++ {
+		if err := r.Delete(ctx, appWrappers[i], client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate the AppWrapper for the run scheduled at the given time
+func (r *CronAppWrapperReconciler) newRun(cronAppWrapper *mcadv1beta1.CronAppWrapper, scheduled time.Time) (*mcadv1beta1.AppWrapper, error) {
+	labels := map[string]string{}
+	for k, v := range cronAppWrapper.Spec.Template.Labels {
+		labels[k] = v
+	}
+	labels[cronLabel] = cronAppWrapper.Name
+	annotations := map[string]string{}
+	for k, v := range cronAppWrapper.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	annotations[scheduledTimeAnnotation] = scheduled.Format(time.RFC3339)
+	appWrapper := &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   cronAppWrapper.Namespace,
+			Name:        cronAppWrapper.Name + "-" + strconv.FormatInt(scheduled.Unix()/60, 10), // deterministic name per run
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *cronAppWrapper.Spec.Template.Spec.DeepCopy(),
+	}
+	if err := controllerutil.SetControllerReference(cronAppWrapper, appWrapper, r.Scheme); err != nil {
+		return nil, err
+	}
+	return appWrapper, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronAppWrapperReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mcadv1beta1.CronAppWrapper{}).
+		Owns(&mcadv1beta1.AppWrapper{}).
+		Complete(r)
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestMostRecentRun(t *testing.T) {
+	schedule, err := cron.ParseStandard("*/5 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 6, 1, 12, 7, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		last    time.Time
+		missed  time.Time
+		skipped bool
+	}{
+		{"none missed", now.Add(-time.Minute), time.Time{}, false},
+		{"few missed", now.Add(-time.Hour), time.Date(2023, 6, 1, 12, 5, 0, 0, time.UTC), false},
+		{"many missed", now.Add(-30 * 24 * time.Hour), time.Date(2023, 6, 1, 12, 5, 0, 0, time.UTC), true},
+	} {
+		missed, skipped := mostRecentRun(schedule, tc.last, now)
+		if !missed.Equal(tc.missed) || skipped != tc.skipped {
+			t.Errorf("%s: got %v, %v, want %v, %v", tc.name, missed, skipped, tc.missed, tc.skipped)
+		}
+	}
+}
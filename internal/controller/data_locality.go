@@ -0,0 +1,179 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Node constraints derived from the node selector, tolerations, GPU type, and data dependencies of an AppWrapper
+type nodeConstraints struct {
+	// Labels required on nodes, injected into wrapped pods
+	nodeSelector map[string]string
+
+	// Node affinity of the bound persistent volumes, each entry is a set of alternative terms
+	nodeAffinity [][]v1.NodeSelectorTerm
+
+	// Tolerations required for all NoSchedule and NoExecute taints of a node, ignored if nil
+	tolerations []v1.Toleration
+}
+
+// Compute node constraints from the node selector, tolerations, GPU type, and data dependencies of an AppWrapper
+// Return nil if there are no constraints
+func (r *AppWrapperReconciler) getNodeConstraints(ctx context.Context, c client.Reader, appWrapper *mcadv1beta1.AppWrapper) (*nodeConstraints, error) {
+	data := appWrapper.Spec.Data
+	if data == nil && appWrapper.Spec.NodeSelector == nil && appWrapper.Spec.Tolerations == nil && appWrapper.Spec.GPUType == "" {
+		return nil, nil
+	}
+	constraints := &nodeConstraints{nodeSelector: map[string]string{}}
+	for k, v := range appWrapper.Spec.NodeSelector {
+		constraints.nodeSelector[k] = v
+	}
+	if appWrapper.Spec.GPUType != "" {
+		constraints.nodeSelector[gpuProductLabel] = appWrapper.Spec.GPUType
+	}
+	if appWrapper.Spec.NodeSelector != nil || appWrapper.Spec.Tolerations != nil {
+		constraints.tolerations = append([]v1.Toleration{}, appWrapper.Spec.Tolerations...) // non-nil
+	}
+	if data == nil {
+		return constraints, nil
+	}
+	for k, v := range data.NodeSelector {
+		constraints.nodeSelector[k] = v
+	}
+	if c == nil {
+		return constraints, nil // volumes are not visible
+	}
+	for _, name := range data.PersistentVolumeClaims {
+		pvc := &v1.PersistentVolumeClaim{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: appWrapper.Namespace, Name: name}, pvc); err != nil {
+			return nil, err
+		}
+		if pvc.Spec.VolumeName == "" {
+			continue // claim is not bound yet, the scheduler will take care of it
+		}
+		pv := &v1.PersistentVolume{}
+		if err := c.Get(ctx, types.NamespacedName{Name: pvc.Spec.VolumeName}, pv); err != nil {
+			return nil, err
+		}
+		if zone, ok := pv.Labels[v1.LabelTopologyZone]; ok {
+			constraints.nodeSelector[v1.LabelTopologyZone] = zone
+		}
+		if pv.Spec.NodeAffinity != nil && pv.Spec.NodeAffinity.Required != nil {
+			constraints.nodeAffinity = append(constraints.nodeAffinity, pv.Spec.NodeAffinity.Required.NodeSelectorTerms)
+		}
+	}
+	return constraints, nil
+}
+
+// Check whether node satisfies constraints
+func (c *nodeConstraints) matches(name string, node *NodeInfo) bool {
+	for k, v := range c.nodeSelector {
+		if node.Labels[k] != v {
+			return false
+		}
+	}
+	if c.tolerations != nil {
+		for i := range node.Taints {
+			if !tolerates(c.tolerations, &node.Taints[i]) {
+				return false
+			}
+		}
+	}
+	for _, terms := range c.nodeAffinity {
+		if !matchNodeSelectorTerms(name, node.Labels, terms) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether taint is tolerated, ignoring PreferNoSchedule taints
+func tolerates(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	if taint.Effect == v1.TaintEffectPreferNoSchedule {
+		return true
+	}
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether node satisfies at least one of the node selector terms
+func matchNodeSelectorTerms(name string, nodeLabels map[string]string, terms []v1.NodeSelectorTerm) bool {
+	for _, term := range terms {
+		if matchNodeSelectorTerm(name, nodeLabels, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether node satisfies all the requirements of a node selector term
+func matchNodeSelectorTerm(name string, nodeLabels map[string]string, term v1.NodeSelectorTerm) bool {
+	if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+		return false // empty terms match no objects
+	}
+	for _, field := range term.MatchFields {
+		// metadata.name is the only supported field
+		if !matchRequirement(field, labels.Set{"metadata.name": name}) {
+			return false
+		}
+	}
+	for _, expression := range term.MatchExpressions {
+		if !matchRequirement(expression, labels.Set(nodeLabels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether a set of labels satisfies a node selector requirement
+func matchRequirement(requirement v1.NodeSelectorRequirement, set labels.Set) bool {
+	var op selection.Operator
+	switch requirement.Operator {
+	case v1.NodeSelectorOpIn:
+		op = selection.In
+	case v1.NodeSelectorOpNotIn:
+		op = selection.NotIn
+	case v1.NodeSelectorOpExists:
+		op = selection.Exists
+	case v1.NodeSelectorOpDoesNotExist:
+		op = selection.DoesNotExist
+	case v1.NodeSelectorOpGt:
+		op = selection.GreaterThan
+	case v1.NodeSelectorOpLt:
+		op = selection.LessThan
+	default:
+		return false
+	}
+	r, err := labels.NewRequirement(requirement.Key, op, requirement.Values)
+	if err != nil {
+		return false
+	}
+	return r.Matches(set)
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// DispatchControl actions are applied by the AppWrapper reconciler to preserve a single writer for AppWrapper status
+// The DispatchControl reconciler tracks progress and triggers the reconciliation of affected AppWrappers
+
+// Check whether the action of the DispatchControl has yet to be applied to the AppWrapper
+func pendingAction(control *mcadv1beta1.DispatchControl, appWrapper *mcadv1beta1.AppWrapper) bool {
+	if control.Spec.Namespace != "" && control.Spec.Namespace != appWrapper.Namespace ||
+		control.Spec.Name != "" && control.Spec.Name != appWrapper.Name || !control.DeletionTimestamp.IsZero() {
+		return false
+	}
+	status := appWrapper.Status
+	switch control.Spec.Action {
+	case mcadv1beta1.RequeueFailed:
+		return status.Phase == mcadv1beta1.Failed && status.Step != mcadv1beta1.Deleting && failedBefore(appWrapper, control.CreationTimestamp)
+	case mcadv1beta1.Drain:
+		return status.Phase == mcadv1beta1.Running && status.Step != mcadv1beta1.Deleting
+	case mcadv1beta1.Flush:
+		return status.Phase == mcadv1beta1.Queued && status.Step == mcadv1beta1.Idle && appWrapper.CreationTimestamp.Before(&control.CreationTimestamp)
+	case mcadv1beta1.Expedite:
+		return status.Phase == mcadv1beta1.Queued && status.ExpeditedBy == "" && appWrapper.CreationTimestamp.Before(&control.CreationTimestamp) &&
+			!dispatchedSince(appWrapper, control.CreationTimestamp)
+	}
+	return false
+}
+
+// Check whether the AppWrapper last failed before the given time
+func failedBefore(appWrapper *mcadv1beta1.AppWrapper, timestamp metav1.Time) bool {
+	for i := len(appWrapper.Status.Transitions) - 1; i >= 0; i-- {
+		if transition := appWrapper.Status.Transitions[i]; transition.Phase == mcadv1beta1.Failed {
+			return transition.Time.Before(&timestamp)
+		}
+	}
+	return true // failed so long ago the transition was dropped from the log
+}
+
+// Check whether the AppWrapper was dispatched since the given time
+func dispatchedSince(appWrapper *mcadv1beta1.AppWrapper, timestamp metav1.Time) bool {
+	for _, record := range appWrapper.Status.DispatchHistory {
+		if record.Action == mcadv1beta1.Dispatched && !record.Time.Before(&timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply pending DispatchControl action to AppWrapper if any
+// Return true if the AppWrapper status was updated
+func (r *AppWrapperReconciler) applyDispatchControls(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	controls := &mcadv1beta1.DispatchControlList{}
+	if err := r.List(ctx, controls); err != nil {
+		return true, ctrl.Result{}, err
+	}
+	for i := range controls.Items {
+		control := &controls.Items[i]
+		if !pendingAction(control, appWrapper) {
+			continue
+		}
+		reason := string(control.Spec.Action) + " requested by DispatchControl " + control.Name
+		switch control.Spec.Action {
+		case mcadv1beta1.RequeueFailed:
+			appWrapper.Status.Restarts = 0
+			appWrapper.Status.RequeueTimestamp = metav1.Now()
+			if appWrapper.Status.Step == mcadv1beta1.Idle {
+				r.triggerDispatch()
+				result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Queued, mcadv1beta1.Idle, reason)
+				return true, result, err
+			}
+			// delete remaining resources before requeuing
+			result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, reason)
+			return true, result, err
+		case mcadv1beta1.Drain:
+			appWrapper.Status.RequeueTimestamp = metav1.Now()
+			appWrapper.Status.Drained = true
+			result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, reason)
+			return true, result, err
+		case mcadv1beta1.Flush:
+			appWrapper.Status.FailureReason = mcadv1beta1.Flushed
+			result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Idle, reason)
+			return true, result, err
+		case mcadv1beta1.Expedite:
+			// phase is unchanged, reason is recorded in dispatch history upon dispatch
+			appWrapper.Status.ExpeditedBy = control.Name
+			if err := r.saveStatus(ctx, appWrapper); err != nil {
+				return true, ctrl.Result{}, err
+			}
+			r.addCachedPhase(appWrapper)
+			log.FromContext(ctx).Info("Expedited", "control", control.Name)
+			r.Recorder.Event(appWrapper, v1.EventTypeNormal, "Expedited", reason)
+			r.triggerDispatch()
+			return true, ctrl.Result{}, nil
+		}
+	}
+	return false, ctrl.Result{}, nil
+}
+
+// List namespaces held by Drain actions, "" means all namespaces
+func (r *AppWrapperReconciler) drainedNamespaces(ctx context.Context) (map[string]bool, error) {
+	controls := &mcadv1beta1.DispatchControlList{}
+	if err := r.List(ctx, controls); err != nil {
+		return nil, err
+	}
+	drained := map[string]bool{}
+	for _, control := range controls.Items {
+		if control.Spec.Action == mcadv1beta1.Drain && control.DeletionTimestamp.IsZero() {
+			drained[control.Spec.Namespace] = true
+		}
+	}
+	return drained, nil
+}
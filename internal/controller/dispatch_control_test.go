@@ -0,0 +1,77 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestDrainIsNotARestart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	appWrapper := &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aw", UID: types.UID("aw")},
+		Status: mcadv1beta1.AppWrapperStatus{Phase: mcadv1beta1.Running, Step: mcadv1beta1.Created,
+			DispatchTimestamp: metav1.Now(), Target: localTarget, Restarts: 1},
+	}
+	appWrapper.Spec.Scheduling.Requeuing.MaxNumRequeuings = 2
+	control := &mcadv1beta1.DispatchControl{
+		ObjectMeta: metav1.ObjectMeta{Name: "drain"},
+		Spec:       mcadv1beta1.DispatchControlSpec{Action: mcadv1beta1.Drain, Namespace: "default"},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appWrapper, control).WithStatusSubresource(appWrapper, control).Build()
+	r := &AppWrapperReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Cache:    map[types.UID]*CachedAppWrapper{},
+		Events:   make(chan event.GenericEvent, 1),
+		Recorder: record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(appWrapper)}
+	// drain then requeue once resources are deleted
+	for _, step := range []mcadv1beta1.AppWrapperStep{mcadv1beta1.Deleting, mcadv1beta1.Idle} {
+		if _, err := r.reconcile(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Get(ctx, req.NamespacedName, appWrapper); err != nil {
+			t.Fatal(err)
+		}
+		if appWrapper.Status.Step != step {
+			t.Fatalf("step %s, want %s", appWrapper.Status.Step, step)
+		}
+	}
+	if appWrapper.Status.Phase != mcadv1beta1.Queued || appWrapper.Status.Restarts != 1 || appWrapper.Status.Drained {
+		t.Errorf("status %s, restarts %d, drained %v, want %s, 1, false",
+			appWrapper.Status.Phase, appWrapper.Status.Restarts, appWrapper.Status.Drained, mcadv1beta1.Queued)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Each dispatch decision is recorded in the DispatchLog object before the AppWrapper status is updated
+// and resolved once the update succeeds or fails
+// On startup, pending transactions are checked against the AppWrapper statuses before dispatching again
+// so that a crash between recording and acting neither dispatches an AppWrapper twice nor loses an allocation
+// The log is kept in memory between updates to avoid conflicts with the lagging reconciler cache
+// and reloaded and recovered after a failed update
+
+const (
+	dispatchLogName       = "mcad" // name of the DispatchLog object
+	maxDispatchLogEntries = 100    // maximum number of resolved transactions kept in the log
+)
+
+// Load the dispatch log, creating the object if necessary
+func (r *AppWrapperReconciler) loadDispatchLog(ctx context.Context) error {
+	dispatchLog := &mcadv1beta1.DispatchLog{}
+	if err := r.Get(ctx, types.NamespacedName{Name: dispatchLogName}, dispatchLog); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		dispatchLog = &mcadv1beta1.DispatchLog{ObjectMeta: metav1.ObjectMeta{Name: dispatchLogName}}
+		if err := r.Create(ctx, dispatchLog); err != nil {
+			return err
+		}
+	}
+	r.dispatchLog = dispatchLog
+	return nil
+}
+
+// Write the dispatch log, dropping the oldest resolved transactions beyond the bound
+func (r *AppWrapperReconciler) writeDispatchLog(ctx context.Context, dispatchLog *mcadv1beta1.DispatchLog) error {
+	entries := dispatchLog.Status.Entries
+	for len(entries) > maxDispatchLogEntries && entries[0].State != mcadv1beta1.DispatchPending {
+		entries = entries[1:]
+	}
+	dispatchLog.Status.Entries = entries
+	if err := r.Status().Update(ctx, dispatchLog); err != nil {
+		r.dispatchLog = nil // reload from server next time
+		return err
+	}
+	r.dispatchLog = dispatchLog
+	return nil
+}
+
+// Resolve pending transactions left by a previous instance of the dispatcher
+func (r *AppWrapperReconciler) recoverDispatchLog(ctx context.Context) error {
+	if err := r.loadDispatchLog(ctx); err != nil {
+		return err
+	}
+	dispatchLog := r.dispatchLog.DeepCopy()
+	recovered := false
+	for i := range dispatchLog.Status.Entries {
+		entry := &dispatchLog.Status.Entries[i]
+		if entry.State != mcadv1beta1.DispatchPending {
+			continue
+		}
+		// the transaction committed if the AppWrapper status reflects the dispatch
+		entry.State = mcadv1beta1.DispatchAborted
+		appWrapper := &mcadv1beta1.AppWrapper{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: entry.Namespace, Name: entry.Name}, appWrapper); err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+		} else if appWrapper.UID == entry.UID && appWrapper.Status.TransitionCount >= entry.TransitionCount &&
+			appWrapper.Status.Phase != mcadv1beta1.Queued {
+			entry.State = mcadv1beta1.DispatchCommitted
+		}
+		mcadLog.Info("Recovered dispatch transaction", "sequence", entry.Sequence, "namespace", entry.Namespace,
+			"name", entry.Name, "uid", entry.UID, "state", entry.State)
+		recovered = true
+	}
+	if recovered {
+		return r.writeDispatchLog(ctx, dispatchLog)
+	}
+	return nil
+}
+
+// Record a pending dispatch transaction for the AppWrapper and return its sequence number
+func (r *AppWrapperReconciler) beginDispatch(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (int64, error) {
+	if r.dispatchLog == nil {
+		if err := r.loadDispatchLog(ctx); err != nil {
+			return 0, err
+		}
+	}
+	dispatchLog := r.dispatchLog.DeepCopy()
+	dispatchLog.Status.Sequence++
+	dispatchLog.Status.Entries = append(dispatchLog.Status.Entries, mcadv1beta1.DispatchLogEntry{
+		Sequence:        dispatchLog.Status.Sequence,
+		Time:            metav1.Now(),
+		UID:             appWrapper.UID,
+		Namespace:       appWrapper.Namespace,
+		Name:            appWrapper.Name,
+		Submitter:       appWrapper.Status.Submitter,
+		Target:          appWrapper.Status.Target,
+		Allocated:       aggregateRequests(appWrapper).AsResources(),
+		TransitionCount: appWrapper.Status.TransitionCount + 1,
+		State:           mcadv1beta1.DispatchPending,
+	})
+	if err := r.writeDispatchLog(ctx, dispatchLog); err != nil {
+		return 0, err
+	}
+	return dispatchLog.Status.Sequence, nil
+}
+
+// Resolve the dispatch transaction with the given sequence number
+func (r *AppWrapperReconciler) endDispatch(ctx context.Context, sequence int64, state mcadv1beta1.DispatchLogState) error {
+	if r.dispatchLog == nil {
+		return nil // pending transaction is resolved by recovery
+	}
+	dispatchLog := r.dispatchLog.DeepCopy()
+	for i := range dispatchLog.Status.Entries {
+		if dispatchLog.Status.Entries[i].Sequence == sequence {
+			dispatchLog.Status.Entries[i].State = state
+		}
+	}
+	return r.writeDispatchLog(ctx, dispatchLog)
+}
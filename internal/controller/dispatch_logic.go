@@ -22,85 +22,142 @@ import (
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
 )
 
-// Compute available cluster capacity
-func (r *AppWrapperReconciler) computeCapacity(ctx context.Context) (Weights, error) {
-	capacity := Weights{}
-	// add allocatable capacity for each schedulable node
+// Schedulable node
+type NodeInfo struct {
+	// Node labels
+	Labels map[string]string
+
+	// Node taints
+	Taints []v1.Taint
+
+	// Allocatable capacity minus requests of all non-terminated pods on the node
+	Free Weights
+}
+
+// Compute available cluster capacity and free capacity of each schedulable node
+func (r *AppWrapperReconciler) computeCapacity(ctx context.Context) (Weights, map[string]*NodeInfo, error) {
 	nodes := &v1.NodeList{}
 	if err := r.List(ctx, nodes, client.UnsafeDisableDeepCopy); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	podsByNode := map[string][]v1.Pod{}
 	for _, node := range nodes.Items {
-		// skip unschedulable nodes
 		if node.Spec.Unschedulable {
 			continue
 		}
-		// add allocatable capacity on the node
-		capacity.Add(NewWeights(node.Status.Allocatable))
-		// subtract requests from non-AppWrapper, non-terminated pods on this node
 		fieldSelector, err := fields.ParseSelector(specNodeName + "=" + node.Name)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		pods := &v1.PodList{}
 		if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
 			client.MatchingFieldsSelector{Selector: fieldSelector}); err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		for _, pod := range pods.Items {
-			if _, ok := pod.GetLabels()[nameLabel]; !ok && pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodSucceeded {
+		podsByNode[node.Name] = pods.Items
+	}
+	capacity, nodeInfos := nodeCapacity(nodes.Items, podsByNode, r.Config.TerminatingPods)
+	return capacity, nodeInfos, nil
+}
+
+// Compute available capacity and free capacity of each schedulable node given the pods on each node
+func nodeCapacity(nodes []v1.Node, podsByNode map[string][]v1.Pod, policy TerminatingPodPolicy) (Weights, map[string]*NodeInfo) {
+	capacity := Weights{}
+	nodeInfos := map[string]*NodeInfo{}
+	for _, node := range nodes {
+		// skip unschedulable nodes
+		if node.Spec.Unschedulable {
+			continue
+		}
+		// add allocatable capacity on the node
+		gpuType := node.Labels[gpuProductLabel]
+		capacity.Add(addGPUType(NewWeights(node.Status.Allocatable), gpuType))
+		nodeInfo := &NodeInfo{Labels: node.Labels, Taints: node.Spec.Taints, Free: addGPUType(NewWeights(node.Status.Allocatable), gpuType)}
+		nodeInfos[node.Name] = nodeInfo
+		// subtract requests from non-terminated pods on this node from node free capacity
+		// subtract requests from non-AppWrapper, non-terminated pods on this node from cluster capacity
+		for _, pod := range podsByNode[node.Name] {
+			if consumesResources(&pod, policy) {
 				for _, container := range pod.Spec.Containers {
-					capacity.Sub(NewWeights(container.Resources.Requests))
+					nodeInfo.Free.Sub(addGPUType(NewWeights(container.Resources.Requests), gpuType))
+					if _, ok := pod.GetLabels()[nameLabel]; !ok {
+						capacity.Sub(addGPUType(NewWeights(container.Resources.Requests), gpuType))
+					}
 				}
 			}
 		}
 	}
-	return capacity, nil
+	return capacity, nodeInfos
 }
 
-// Compute resources reserved by AppWrappers at every priority level for the specified cluster
+// Compute resources reserved by AppWrappers at every priority level for each dispatch target
 // Sort queued AppWrappers in dispatch order
+// Report resources allocated to each dispatched AppWrapper
 // AppWrappers in output queue must be cloned if mutated
-func (r *AppWrapperReconciler) listAppWrappers(ctx context.Context) (map[int]Weights, []*mcadv1beta1.AppWrapper, error) {
+func (r *AppWrapperReconciler) listAppWrappers(ctx context.Context) (map[string]map[int]Weights, []*mcadv1beta1.AppWrapper, []mcadv1beta1.AllocationStatus, error) {
 	appWrappers := &mcadv1beta1.AppWrapperList{}
 	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
-	requests := map[int]Weights{}        // total request per priority level
-	queue := []*mcadv1beta1.AppWrapper{} // queued appWrappers
+	drained, err := r.drainedNamespaces(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	requests := map[string]map[int]Weights{localTarget: {}} // total request per target and priority level
+	for _, target := range r.Targets {
+		requests[target.Name] = map[int]Weights{}
+	}
+	queue := []*mcadv1beta1.AppWrapper{}            // queued appWrappers
+	allocations := []mcadv1beta1.AllocationStatus{} // allocated resources per AppWrapper
 	for _, appWrapper := range appWrappers.Items {
+		if isAssigned(&appWrapper) {
+			continue // AppWrappers assigned to pull-based agents are accounted for by their parents
+		}
 		// get phase from cache if available as reconciler cache may be lagging
 		phase, step := r.getCachedPhase(&appWrapper)
 		// make sure to initialize weights for every known priority level
-		if requests[int(appWrapper.Spec.Priority)] == nil {
-			requests[int(appWrapper.Spec.Priority)] = Weights{}
+		for _, targetRequests := range requests {
+			if targetRequests[int(appWrapper.Spec.Priority)] == nil {
+				targetRequests[int(appWrapper.Spec.Priority)] = Weights{}
+			}
 		}
-		if step != mcadv1beta1.Idle {
+		// hibernated AppWrappers that released their capacity are queued until woken up
+		released := phase == mcadv1beta1.Queued && step == mcadv1beta1.Hibernated
+		if step != mcadv1beta1.Idle && !released {
 			// use max request among AppWrapper request and total request of non-terminated AppWrapper pods
+			// pods of AppWrappers dispatched to remote targets are not watched, use AppWrapper request
 			awRequest := aggregateRequests(&appWrapper)
-			podRequest := Weights{}
-			pods := &v1.PodList{}
-			if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
-				client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
-				return nil, nil, err
-			}
-			for _, pod := range pods.Items {
-				if pod.Spec.NodeName != "" && pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodSucceeded {
-					for _, container := range pod.Spec.Containers {
-						podRequest.Add(NewWeights(container.Resources.Requests))
-					}
+			target := appWrapper.Status.Target
+			if target == localTarget {
+				podRequest, err := r.podRequest(ctx, &appWrapper)
+				if err != nil {
+					return nil, nil, nil, err
 				}
+				if step == mcadv1beta1.Deleting {
+					// only count resources actually created and pods not yet terminated
+					awRequest = r.deletingRequest(&appWrapper, awRequest)
+				}
+				awRequest = r.chargeGPUQuotas(&appWrapper, awRequest)
+				// compute max
+				awRequest.Max(podRequest)
+			}
+			// ignore targets no longer configured
+			if targetRequests, ok := requests[target]; ok {
+				targetRequests[int(appWrapper.Spec.Priority)].Add(awRequest)
 			}
-			// compute max
-			awRequest.Max(podRequest)
-			requests[int(appWrapper.Spec.Priority)].Add(awRequest)
-		} else if phase == mcadv1beta1.Queued &&
+			allocations = append(allocations, mcadv1beta1.AllocationStatus{Namespace: appWrapper.Namespace, Name: appWrapper.Name,
+				Priority: appWrapper.Spec.Priority, Queue: appWrapper.Labels[queueLabel],
+				Submitter: appWrapper.Status.Submitter, Target: target, Allocated: awRequest.AsResources()})
+		} else if phase == mcadv1beta1.Queued && (!released || !appWrapper.Spec.Hibernation.Hibernate) &&
+			!drained[""] && !drained[appWrapper.Namespace] &&
 			time.Now().After(appWrapper.Status.RequeueTimestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.PauseTimeInSeconds)*time.Second)) {
 			// add AppWrapper to queue
 			copy := appWrapper // must copy appWrapper before taking a reference, shallow copy ok
@@ -108,77 +165,274 @@ func (r *AppWrapperReconciler) listAppWrappers(ctx context.Context) (map[int]Wei
 		}
 	}
 	// propagate reservations at all priority levels to all levels below
-	assertPriorities(requests)
-	// order AppWrapper queue based on priority and precedence (creation time)
-	sort.Slice(queue, func(i, j int) bool {
-		if queue[i].Spec.Priority > queue[j].Spec.Priority {
-			return true
-		}
-		if queue[i].Spec.Priority < queue[j].Spec.Priority {
-			return false
+	for _, targetRequests := range requests {
+		assertPriorities(targetRequests)
+	}
+	// order AppWrapper queue based on priority and tie breaker
+	sortQueue(queue, r.Config.TieBreaker)
+	orderBands(queue, r.Config.PriorityBands, allocations, r.ClusterCapacity)
+	return requests, queue, allocations, nil
+}
+
+// Compute total request of the non-terminated AppWrapper pods bound to local nodes
+func (r *AppWrapperReconciler) podRequest(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (Weights, error) {
+	podRequest := Weights{}
+	pods := &v1.PodList{}
+	if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
+		client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" && consumesResources(&pod, r.Config.TerminatingPods) {
+			for _, container := range pod.Spec.Containers {
+				podRequest.Add(addGPUType(NewWeights(container.Resources.Requests), r.nodeGPUType(pod.Spec.NodeName)))
+			}
 		}
-		return queue[i].CreationTimestamp.Before(&queue[j].CreationTimestamp)
-	})
-	return requests, queue, nil
+	}
+	return podRequest, nil
 }
 
 // Find next AppWrapper to dispatch in queue order
 func (r *AppWrapperReconciler) selectForDispatch(ctx context.Context) (*mcadv1beta1.AppWrapper, error) {
-	expired := time.Now().After(r.NextSync)
+	// refresh capacity periodically or soon after non-AppWrapper pods changed
+	expired := time.Now().After(r.NextSync) ||
+		r.podsChanged.Load() && time.Now().After(r.NextSync.Add(capacityRefreshDelay-clusterInfoTimeout))
 	if expired {
-		capacity, err := r.computeCapacity(ctx)
+		r.podsChanged.Store(false)
+		capacity, nodes, err := r.computeCapacity(ctx)
+		r.health.capacityFailing.Store(err != nil)
 		if err != nil {
 			return nil, err
 		}
+		applyMargins(capacity, r.Config.SafetyMargins)
+		r.applyPhantomCapacity(capacity)
+		r.gpuWithheld = applyGPUQuotas(capacity, r.Config.GPUQuotas)
+		if err := r.reserveUnboundPods(ctx, nodes); err != nil {
+			return nil, err
+		}
 		r.ClusterCapacity = capacity
+		r.Nodes = nodes
 		r.NextSync = time.Now().Add(clusterInfoTimeout)
+		r.health.lastCapacitySync.Store(time.Now().UnixNano())
 		mcadLog.Info("Total capacity", "capacity", capacity)
 	}
-	requests, queue, err := r.listAppWrappers(ctx)
+	requests, queue, allocations, err := r.listAppWrappers(ctx)
 	if err != nil {
 		return nil, err
 	}
-	// compute available cluster capacity at each priority level
-	// available cluster capacity = total capacity reported in cluster info - capacity reserved by AppWrappers
-	available := map[int]Weights{}
-	for priority, request := range requests {
-		// copy capacity before subtracting request
-		available[priority] = Weights{}
-		available[priority].Add(r.ClusterCapacity)
-		available[priority].Sub(request)
-		if expired {
-			mcadLog.Info("Available capacity", "priority", priority, "capacity", available)
+	// requeue AppWrappers running on targets that have been unhealthy for too long
+	if expired && r.Config.TargetOutageTimeout > 0 {
+		if err := r.evacuateTargets(ctx); err != nil {
+			return nil, err
+		}
+	}
+	// requeue running AppWrappers if capacity no longer covers their requests
+	if expired && r.Config.RequeueOnCapacityShrink {
+		if err := r.requeueExcess(ctx, requests[localTarget]); err != nil {
+			return nil, err
+		}
+	}
+	// compute available capacity of each target at each priority level
+	// available capacity = total capacity reported in cluster info - capacity reserved by AppWrappers
+	usage := targetUsage(allocations)
+	candidates := []*candidate{{name: localTarget, properties: r.Config.LocalTarget, client: r.Client,
+		available: availableCapacity(r.ClusterCapacity, requests[localTarget]), nodes: r.Nodes, usage: usage[localTarget]}}
+	for i, target := range r.Targets {
+		capacity, nodes, _, err := target.Capacity()
+		if err != nil {
+			continue // unhealthy targets are not eligible for new dispatches
+		}
+		// copy capacity before applying margins
+		adjusted := Weights{}
+		adjusted.Add(capacity)
+		applyMargins(adjusted, r.Config.SafetyMargins)
+		candidates = append(candidates, &candidate{name: target.Name, properties: target.TargetProperties, client: target.Transport.Client(),
+			available: availableCapacity(adjusted, requests[target.Name]), nodes: nodes, usage: usage[target.Name], rank: i + 1})
+	}
+	// move AppWrappers that spilled over back to preferred targets with enough capacity
+	if expired {
+		if err := r.reclaimSpilled(ctx, candidates); err != nil {
+			return nil, err
 		}
 	}
+	available := candidates[0].available
 	if expired {
+		for priority, capacity := range available {
+			mcadLog.Info("Available capacity", "priority", priority, "capacity", capacity)
+		}
+		r.publishClusterInfo(ctx, requests[localTarget], available, allocations, queue)
 		pretty := make([]string, len(queue))
 		for i, appWrapper := range queue {
 			pretty[i] = appWrapper.Namespace + "/" + appWrapper.Name + ":" + string(appWrapper.UID)
 		}
 		mcadLog.Info("Queue", "queue", pretty)
 	}
-	// return first AppWrapper that fits if any
+	// with explicit preemption, only dispatch to the free capacity of the local cluster
+	if r.Config.Preemption {
+		candidates[0].available = freeCapacity(available)
+	}
+	// return first AppWrapper that fits some target if any
 	for _, appWrapper := range queue {
-		request := aggregateRequests(appWrapper)
-		if request.Fits(available[int(appWrapper.Spec.Priority)]) {
-			return appWrapper.DeepCopy(), nil // deep copy AppWrapper
+		request := r.fitRequest(aggregateRequests(appWrapper))
+		if target, scores, ok := r.selectTarget(ctx, appWrapper, request, candidates); ok {
+			appWrapper = appWrapper.DeepCopy() // deep copy AppWrapper
+			appWrapper.Status.Target = target
+			appWrapper.Status.PlacementScores = scores
+			return appWrapper, nil
+		}
+		// start elastic AppWrapper at its minimum if permitted
+		if minimum := startAtMinimum(appWrapper); minimum != nil {
+			if target, scores, ok := r.selectTarget(ctx, minimum, r.fitRequest(aggregateRequests(minimum)), candidates); ok {
+				minimum.Status.Target = target
+				minimum.Status.PlacementScores = scores
+				return minimum, nil
+			}
+		}
+		if r.Config.Preemption {
+			// make room for the AppWrapper and hold lower-priority AppWrappers until the capacity is released
+			if waiting, err := r.preempt(ctx, appWrapper, request, candidates[0], available); err != nil || waiting {
+				return nil, err
+			}
+		}
+	}
+	// grow shrunk elastic AppWrappers back if capacity is left
+	if expired {
+		if err := r.growShrunk(ctx, candidates[0].available[lowestPriority(candidates[0].available)]); err != nil {
+			return nil, err
 		}
 	}
 	// no queued AppWrapper fits
 	return nil, nil
 }
 
-// Aggregate requests
+// Compute available capacity at each priority level given capacity and reservations
+func availableCapacity(capacity Weights, requests map[int]Weights) map[int]Weights {
+	available := map[int]Weights{}
+	for priority, request := range requests {
+		// copy capacity before subtracting request
+		available[priority] = Weights{}
+		available[priority].Add(capacity)
+		available[priority].Sub(request)
+	}
+	return available
+}
+
+// Requeue running AppWrappers in order of increasing priority and decreasing dispatch time
+// until the requests of the remaining AppWrappers fit the cluster capacity
+func (r *AppWrapperReconciler) requeueExcess(ctx context.Context, requests map[int]Weights) error {
+	// total request is the request at the lowest priority level
+	demand := Weights{} // copy request before subtracting requeued requests
+	demand.Add(r.fitRequest(requests[lowestPriority(requests)]))
+	if demand.Fits(r.ClusterCapacity) {
+		return nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return err
+	}
+	running := []*mcadv1beta1.AppWrapper{}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if appWrapper.Status.Target != localTarget {
+			continue
+		}
+		phase, step := r.getCachedPhase(appWrapper)
+		if phase == mcadv1beta1.Running && step == mcadv1beta1.Created {
+			running = append(running, appWrapper)
+		} else if phase == mcadv1beta1.Running && step == mcadv1beta1.Deleting {
+			// requeuing AppWrappers are already releasing their resources, do not choose further victims for them
+			demand.Sub(r.fitRequest(aggregateRequests(appWrapper)))
+		}
+	}
+	if demand.Fits(r.ClusterCapacity) {
+		return nil
+	}
+	sort.Slice(running, func(i, j int) bool {
+		if running[i].Spec.Priority != running[j].Spec.Priority {
+			return running[i].Spec.Priority < running[j].Spec.Priority
+		}
+		return running[j].Status.DispatchTimestamp.Before(&running[i].Status.DispatchTimestamp)
+	})
+	for _, victim := range running {
+		if demand.Fits(r.ClusterCapacity) {
+			break
+		}
+		appWrapper := victim.DeepCopy() // deep copy AppWrapper before mutating
+		ctx := withAppWrapper(ctx, appWrapper)
+		if r.isStale(ctx, appWrapper) {
+			continue
+		}
+		appWrapper.Status.RequeueTimestamp = metav1.Now()
+		if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, "insufficient capacity"); err != nil {
+			return err
+		}
+		demand.Sub(r.fitRequest(aggregateRequests(appWrapper)))
+	}
+	return nil
+}
+
+// Check whether request fits the free capacity of the target nodes satisfying the AppWrapper constraints
+// If bin packing is enabled, check that every pod fits some node and reserve the node capacity
+func (r *AppWrapperReconciler) fitsNodes(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, request Weights,
+	c client.Reader, targetNodes map[string]*NodeInfo) bool {
+	if targetNodes == nil {
+		return true // node-level capacity is not visible
+	}
+	constraints, err := r.getNodeConstraints(ctx, c, appWrapper)
+	if err != nil {
+		// do not block the queue, retry at next dispatch
+		log.FromContext(withAppWrapper(ctx, appWrapper)).Error(err, "Data dependency error")
+		return false
+	}
+	if constraints == nil && !r.Config.BinPacking {
+		return true
+	}
+	nodes := map[string]*NodeInfo{}
+	for name, node := range targetNodes {
+		if constraints == nil || constraints.matches(name, node) {
+			nodes[name] = node
+		}
+	}
+	if r.Config.BinPacking {
+		free := packPods(appWrapper, nodes, r.fitRequest)
+		if free == nil {
+			return false
+		}
+		// account for placement until next capacity refresh
+		for name, weights := range free {
+			nodes[name].Free = weights
+		}
+		return true
+	}
+	free := Weights{}
+	for _, node := range nodes {
+		free.Add(node.Free)
+	}
+	return request.Fits(free)
+}
+
+// Aggregate requests, taking shrunk elastic resources into account
 func aggregateRequests(appWrapper *mcadv1beta1.AppWrapper) Weights {
 	request := Weights{}
-	for _, r := range appWrapper.Spec.Resources.GenericItems {
-		for _, cpr := range r.CustomPodResources {
-			request.AddProd(cpr.Replicas, NewWeights(cpr.Requests))
-		}
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		request.Add(itemRequests(appWrapper, i))
 	}
 	return request
 }
 
+// Aggregate requests of the wrapped resource with the given index, taking shrinking into account
+func itemRequests(appWrapper *mcadv1beta1.AppWrapper, index int) Weights {
+	request := Weights{}
+	for _, cpr := range appWrapper.Spec.Resources.GenericItems[index].CustomPodResources {
+		replicas := cpr.Replicas
+		if shrunk, ok := shrunkReplicas(appWrapper, index); ok {
+			replicas = shrunk
+		}
+		request.AddProd(replicas, NewWeights(cpr.Requests))
+	}
+	return addGPUType(request, appWrapper.Spec.GPUType)
+}
+
 // Propagate reservations at all priority levels to all levels below
 func assertPriorities(w map[int]Weights) {
 	keys := make([]int, len(w))
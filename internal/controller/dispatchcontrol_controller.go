@@ -0,0 +1,90 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// DispatchControlReconciler tracks the progress of DispatchControl actions
+type DispatchControlReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	AppWrappers *AppWrapperReconciler // AppWrapper reconciler applying the actions
+}
+
+// Reconcile one DispatchControl
+// Trigger reconciliation of affected AppWrappers and report number of AppWrappers still to process
+func (r *DispatchControlReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	control := &mcadv1beta1.DispatchControl{}
+	if err := r.Get(ctx, req.NamespacedName, control); err != nil {
+		// held AppWrappers may be dispatchable again
+		r.AppWrappers.triggerDispatch()
+		return ctrl.Result{}, nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers); err != nil {
+		return ctrl.Result{}, err
+	}
+	remaining := int32(0)
+	full := false // event channel full, remaining AppWrappers are triggered at the next reconciliation
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if pendingAction(control, appWrapper) {
+			remaining++
+			if !full {
+				// never block on the event channel shared with the dispatch loop
+				select {
+				case r.AppWrappers.Events <- event.GenericEvent{Object: appWrapper}:
+				default:
+					full = true
+				}
+			}
+		}
+	}
+	if remaining != control.Status.Remaining || remaining == 0 && !control.Status.Completed {
+		control.Status.Remaining = remaining
+		if remaining == 0 {
+			control.Status.Completed = true
+			control.Status.CompletionTimestamp = metav1.Now()
+			log.FromContext(ctx).Info("Completed", "action", control.Spec.Action, "namespace", control.Spec.Namespace, "name", control.Spec.Name)
+		}
+		if err := r.Status().Update(ctx, control); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if remaining > 0 {
+		return ctrl.Result{RequeueAfter: dispatchControlDelay}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DispatchControlReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&mcadv1beta1.DispatchControl{}).
+		Complete(r)
+}
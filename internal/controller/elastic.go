@@ -0,0 +1,246 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Elastic wrapped resources declare a minimum replica count
+// Preemption shrinks elastic resources of running AppWrappers down to their minimum replica counts
+// before requeuing AppWrappers, shrunk resources grow back once the released capacity is free again
+// AppWrappers may also start with their elastic resources at their minimum replica counts if the total does not fit
+
+const (
+	shrunkCondition     = "Shrunk"     // condition type for AppWrappers with shrunk elastic resources
+	preemptionCondition = "Preemption" // condition type for AppWrappers that preempted other AppWrappers
+)
+
+// Check whether wrapped resource may be shrunk
+func isElastic(resource *mcadv1beta1.GenericItem) bool {
+	return resource.MinReplicas > 0 && len(resource.CustomPodResources) == 1 &&
+		resource.MinReplicas < resource.CustomPodResources[0].Replicas
+}
+
+// Return the replica count of the shrunk wrapped resource with the given index if any
+func shrunkReplicas(appWrapper *mcadv1beta1.AppWrapper, index int) (int32, bool) {
+	for _, shrunk := range appWrapper.Status.Shrunk {
+		if int(shrunk.Index) == index {
+			return shrunk.Replicas, true
+		}
+	}
+	return 0, false
+}
+
+// Check whether shrunk resource record matches an elastic wrapped resource
+func validShrink(appWrapper *mcadv1beta1.AppWrapper, shrunk mcadv1beta1.ShrunkResource) bool {
+	return int(shrunk.Index) < len(appWrapper.Spec.Resources.GenericItems) &&
+		len(appWrapper.Spec.Resources.GenericItems[shrunk.Index].CustomPodResources) == 1
+}
+
+// Compute the replica count of each elastic wrapped resource that may still shrink at maximum shrinkage
+// and the capacity released by shrinking them
+func shrinkage(appWrapper *mcadv1beta1.AppWrapper) (map[int]int32, Weights) {
+	replicas := map[int]int32{}
+	release := Weights{}
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		resource := &appWrapper.Spec.Resources.GenericItems[i]
+		if !isElastic(resource) {
+			continue
+		}
+		current := resource.CustomPodResources[0].Replicas
+		if shrunk, ok := shrunkReplicas(appWrapper, i); ok {
+			current = shrunk
+		}
+		if current > resource.MinReplicas {
+			replicas[i] = resource.MinReplicas
+			release.AddProd(current-resource.MinReplicas, addGPUType(NewWeights(resource.CustomPodResources[0].Requests), appWrapper.Spec.GPUType))
+		}
+	}
+	return replicas, release
+}
+
+// Return a copy of the AppWrapper with its elastic resources shrunk to their minimum replica counts
+// Return nil if the AppWrapper may not start at its minimum or has no elastic resources
+func startAtMinimum(appWrapper *mcadv1beta1.AppWrapper) *mcadv1beta1.AppWrapper {
+	if !appWrapper.Spec.Scheduling.StartAtMinimum {
+		return nil
+	}
+	shrink, _ := shrinkage(appWrapper)
+	if len(shrink) == 0 {
+		return nil
+	}
+	minimum := appWrapper.DeepCopy() // deep copy AppWrapper before mutating
+	minimum.Status.Shrunk = nil
+	names := []string{}
+	for i := range minimum.Spec.Resources.GenericItems {
+		if n, ok := shrink[i]; ok {
+			minimum.Status.Shrunk = append(minimum.Status.Shrunk, mcadv1beta1.ShrunkResource{Index: int32(i), Replicas: n})
+			names = append(names, fmt.Sprintf("GenericItems[%d] at %d replicas", i, n))
+		}
+	}
+	meta.SetStatusCondition(&minimum.Status.Conditions, metav1.Condition{Type: shrunkCondition, Status: metav1.ConditionTrue,
+		Reason: "StartedAtMinimum", Message: "Started " + strings.Join(names, ", ")})
+	return minimum
+}
+
+// Set the replica counts of shrunk elastic resources in the parsed wrapped resources before creating them
+func applyShrunk(appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) {
+	for _, shrunk := range appWrapper.Status.Shrunk {
+		if !validShrink(appWrapper, shrunk) {
+			continue
+		}
+		if obj, ok := objects[shrunk.Index].(*unstructured.Unstructured); ok {
+			_ = unstructured.SetNestedField(obj.Object, int64(shrunk.Replicas), "spec", "replicas")
+		}
+	}
+}
+
+// Set the replica count of an existing wrapped resource
+func (r *AppWrapperReconciler) scaleResource(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, index int, replicas int32) error {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return err
+	}
+	obj, err := parseResource(appWrapper, &appWrapper.Spec.Resources.GenericItems[index])
+	if err != nil {
+		return err
+	}
+	if err := t.Get(ctx, appWrapper, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if _, ok := obj.GetAnnotations()[replicasAnnotation]; ok {
+		// resource is hibernated, update the replica count restored upon waking up
+		annotations := obj.GetAnnotations()
+		annotations[replicasAnnotation] = fmt.Sprint(replicas)
+		obj.SetAnnotations(annotations)
+	} else {
+		_ = unstructured.SetNestedField(obj.Object, int64(replicas), "spec", "replicas")
+	}
+	return t.Update(ctx, appWrapper, obj)
+}
+
+// Shrink the elastic resources of a running AppWrapper to the given replica counts to make room for the preemptor
+func (r *AppWrapperReconciler) shrink(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, replicas map[int]int32, preemptor string) error {
+	names := []string{}
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		n, ok := replicas[i]
+		if !ok {
+			continue
+		}
+		if err := r.scaleResource(ctx, appWrapper, i, n); err != nil {
+			return err
+		}
+		shrunk := mcadv1beta1.ShrunkResource{Index: int32(i), Replicas: n, PreemptedBy: preemptor}
+		found := false
+		for j := range appWrapper.Status.Shrunk {
+			if int(appWrapper.Status.Shrunk[j].Index) == i {
+				appWrapper.Status.Shrunk[j] = shrunk
+				found = true
+			}
+		}
+		if !found {
+			appWrapper.Status.Shrunk = append(appWrapper.Status.Shrunk, shrunk)
+		}
+		names = append(names, fmt.Sprintf("GenericItems[%d] to %d replicas", i, n))
+	}
+	meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: shrunkCondition, Status: metav1.ConditionTrue,
+		Reason: preemptionReason, Message: "Shrunk " + strings.Join(names, ", ") + " for " + preemptor})
+	return r.saveStatus(ctx, appWrapper)
+}
+
+// Record the AppWrappers shrunk and requeued to make room for the preemptor in its conditions
+func (r *AppWrapperReconciler) recordPreemption(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, shrunk []string, requeued []string) error {
+	messages := []string{}
+	if len(shrunk) > 0 {
+		messages = append(messages, "shrunk "+strings.Join(shrunk, ", "))
+	}
+	if len(requeued) > 0 {
+		messages = append(messages, "requeued "+strings.Join(requeued, ", "))
+	}
+	appWrapper = appWrapper.DeepCopy() // deep copy AppWrapper before mutating
+	meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: preemptionCondition, Status: metav1.ConditionTrue,
+		Reason: "VictimsSelected", Message: "Preempted lower-priority AppWrappers: " + strings.Join(messages, "; ")})
+	return r.saveStatus(ctx, appWrapper)
+}
+
+// Grow shrunk elastic resources of AppWrappers running on the local cluster back if their requests fit the free capacity
+func (r *AppWrapperReconciler) growShrunk(ctx context.Context, free Weights) error {
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return err
+	}
+	available := Weights{} // copy free capacity before subtracting restored requests
+	available.Add(free)
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if len(appWrapper.Status.Shrunk) == 0 || appWrapper.Status.Target != localTarget {
+			continue
+		}
+		if phase, step := r.getCachedPhase(appWrapper); phase != mcadv1beta1.Running || step != mcadv1beta1.Created {
+			continue
+		}
+		restore := Weights{}
+		for _, shrunk := range appWrapper.Status.Shrunk {
+			if !validShrink(appWrapper, shrunk) {
+				continue
+			}
+			cpr := appWrapper.Spec.Resources.GenericItems[shrunk.Index].CustomPodResources[0]
+			restore.AddProd(cpr.Replicas-shrunk.Replicas, addGPUType(NewWeights(cpr.Requests), appWrapper.Spec.GPUType))
+		}
+		if !r.fitRequest(restore).Fits(available) {
+			continue
+		}
+		appWrapper = appWrapper.DeepCopy() // deep copy AppWrapper before mutating
+		ctx := withAppWrapper(ctx, appWrapper)
+		if r.isStale(ctx, appWrapper) {
+			continue
+		}
+		for _, shrunk := range appWrapper.Status.Shrunk {
+			if !validShrink(appWrapper, shrunk) {
+				continue
+			}
+			resource := &appWrapper.Spec.Resources.GenericItems[shrunk.Index]
+			if err := r.scaleResource(ctx, appWrapper, int(shrunk.Index), resource.CustomPodResources[0].Replicas); err != nil {
+				return err
+			}
+		}
+		appWrapper.Status.Shrunk = nil
+		meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: shrunkCondition, Status: metav1.ConditionFalse,
+			Reason: "Restored", Message: "Elastic resources restored to their full replica counts"})
+		if err := r.saveStatus(ctx, appWrapper); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("Restored shrunk resources")
+		available.Sub(restore)
+	}
+	return nil
+}
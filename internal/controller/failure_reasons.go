@@ -0,0 +1,60 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Failed AppWrappers carry a failure reason code in their status and on the transition to the Failed phase
+// so automation can branch on the cause of the failure rather than on the free-form reason
+// A failure caused by exhausting max requeuings is reported as such, the original cause remains in the reason
+
+// Error tagged with the failure reason code to report if the error is fatal
+type reasonError struct {
+	code mcadv1beta1.FailureReason
+	err  error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+// Tag error with a failure reason code
+func withReason(code mcadv1beta1.FailureReason, err error) error {
+	return &reasonError{code: code, err: err}
+}
+
+// Return the failure reason code of an error, forbidden requests are reported as such, default to fallback
+func failureReason(err error, fallback mcadv1beta1.FailureReason) mcadv1beta1.FailureReason {
+	var e *reasonError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	if apierrors.IsForbidden(err) {
+		return mcadv1beta1.CreationForbidden
+	}
+	return fallback
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/inf.v0"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Queuing time statistics for one namespace
+type waitStats struct {
+	count int64
+	total time.Duration
+}
+
+// Record time spent queued by a dispatched AppWrapper
+func (r *AppWrapperReconciler) recordWait(appWrapper *mcadv1beta1.AppWrapper) {
+	queued := appWrapper.CreationTimestamp
+	if queued.Before(&appWrapper.Status.RequeueTimestamp) {
+		queued = appWrapper.Status.RequeueTimestamp
+	}
+	wait := appWrapper.Status.DispatchTimestamp.Sub(queued.Time)
+	dispatchWaitSeconds.WithLabelValues(appWrapper.Namespace, strconv.Itoa(int(appWrapper.Spec.Priority))).Observe(wait.Seconds())
+	if r.waits == nil {
+		r.waits = map[string]*waitStats{}
+	}
+	if r.waits[appWrapper.Namespace] == nil {
+		r.waits[appWrapper.Namespace] = &waitStats{}
+	}
+	r.waits[appWrapper.Namespace].count++
+	r.waits[appWrapper.Namespace].total += wait
+}
+
+// Compare the resources allocated to each active namespace to an even share of the cluster capacity
+// Update the corresponding metrics
+func (r *AppWrapperReconciler) fairnessReport(allocations []mcadv1beta1.AllocationStatus, queue []*mcadv1beta1.AppWrapper) []mcadv1beta1.NamespaceStatus {
+	allocated := map[string]Weights{}
+	byUser := map[string]Weights{}
+	queued := map[string]int32{}
+	for _, allocation := range allocations {
+		if allocated[allocation.Namespace] == nil {
+			allocated[allocation.Namespace] = Weights{}
+		}
+		allocated[allocation.Namespace].Add(NewWeights(allocation.Allocated))
+		if allocation.Submitter != "" {
+			if byUser[allocation.Submitter] == nil {
+				byUser[allocation.Submitter] = Weights{}
+			}
+			byUser[allocation.Submitter].Add(NewWeights(allocation.Allocated))
+		}
+	}
+	for _, appWrapper := range queue {
+		if allocated[appWrapper.Namespace] == nil {
+			allocated[appWrapper.Namespace] = Weights{}
+		}
+		queued[appWrapper.Namespace]++
+	}
+	// divide capacity evenly among active namespaces
+	fairShare := Weights{}
+	if len(allocated) > 0 {
+		for k, v := range r.ClusterCapacity {
+			fairShare[k] = new(inf.Dec).QuoRound(v, inf.NewDec(int64(len(allocated)), 0), 3, inf.RoundDown)
+		}
+	}
+	allocatedResources.Reset()
+	userAllocatedResources.Reset()
+	fairShareResources.Reset()
+	for user, weights := range byUser {
+		for k, v := range weights.AsResources() {
+			userAllocatedResources.WithLabelValues(user, string(k)).Set(v.AsApproximateFloat64())
+		}
+	}
+	report := []mcadv1beta1.NamespaceStatus{}
+	for namespace, weights := range allocated {
+		status := mcadv1beta1.NamespaceStatus{
+			Namespace: namespace,
+			Allocated: weights.AsResources(),
+			FairShare: fairShare.AsResources(),
+			Queued:    queued[namespace],
+		}
+		if stats := r.waits[namespace]; stats != nil && stats.count > 0 {
+			status.AverageWaitSeconds = int64(stats.total.Seconds()) / stats.count
+		}
+		report = append(report, status)
+		for k, v := range status.Allocated {
+			allocatedResources.WithLabelValues(namespace, string(k)).Set(v.AsApproximateFloat64())
+		}
+		for k, v := range status.FairShare {
+			fairShareResources.WithLabelValues(namespace, string(k)).Set(v.AsApproximateFloat64())
+		}
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Namespace < report[j].Namespace })
+	return report
+}
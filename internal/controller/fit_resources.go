@@ -0,0 +1,68 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Admins may restrict the resources that participate in fit and quota decisions
+// Requests for other resources are still reserved and reported but never prevent dispatching an AppWrapper
+// The typed GPU resources derived from nvidia.com/gpu participate if nvidia.com/gpu does
+
+// Parse comma-separated list of resource names
+func ParseResourceNames(s string) ([]v1.ResourceName, error) {
+	names := []v1.ResourceName{}
+	for _, name := range strings.Split(s, ",") {
+		if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid resource name %q: %s", name, strings.Join(errs, ", "))
+		}
+		names = append(names, v1.ResourceName(name))
+	}
+	return names, nil
+}
+
+// Check whether resource name participates in fit decisions
+func (r *AppWrapperReconciler) isFitResource(name v1.ResourceName) bool {
+	if len(r.Config.FitResources) == 0 {
+		return true // all resources participate by default
+	}
+	for _, fit := range r.Config.FitResources {
+		if name == fit || fit == nvidiaGpu && strings.HasPrefix(string(name), nvidiaGpu+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the part of the request that participates in fit decisions
+func (r *AppWrapperReconciler) fitRequest(request Weights) Weights {
+	if len(r.Config.FitResources) == 0 {
+		return request
+	}
+	fit := Weights{}
+	for name, quantity := range request {
+		if r.isFitResource(name) {
+			fit[name] = quantity
+		}
+	}
+	return fit
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"flag"
+)
+
+// Define the flags of the dispatch policy settings shared by the controller and the replay tool
+// Set the default tie breaker
+func DispatchPolicyFlags(fs *flag.FlagSet, config *Config) {
+	config.TieBreaker = CreationTime
+	fs.Func("tie-breaker", "Order of queued AppWrappers with equal priorities: CreationTime (default), LeastRequested, RoundRobin, or Random.",
+		func(s string) (err error) {
+			config.TieBreaker, err = ParseTieBreaker(s)
+			return
+		})
+	fs.Func("priority-bands", "Priority bands by decreasing minimum priority with Strict, FairShare, or BestEffort semantics, e.g., Strict=1000,FairShare=100,BestEffort.",
+		func(s string) (err error) {
+			config.PriorityBands, err = ParsePriorityBands(s)
+			return
+		})
+	fs.Func("gpu-quota", "Maximum number of GPUs of each type allocated to AppWrappers, e.g., Tesla-T4=16,NVIDIA-A100-SXM4-80GB=8. "+
+		"GPUs of AppWrappers without GPU type count against every type with a quota.",
+		func(s string) (err error) {
+			config.GPUQuotas, err = ParseGPUQuotas(s)
+			return
+		})
+	fs.Func("fit-resources", "Comma-separated list of resources that participate in fit and quota decisions, e.g., nvidia.com/gpu,memory, all resources by default.",
+		func(s string) (err error) {
+			config.FitResources, err = ParseResourceNames(s)
+			return
+		})
+	fs.BoolVar(&config.BinPacking, "bin-packing", false,
+		"Only dispatch AppWrappers whose pods can be packed onto the free capacity of individual nodes.")
+	fs.Func("safety-margin", "Capacity withheld from dispatch per resource, as absolute quantities or percentages of cluster capacity, e.g., cpu=2,nvidia.com/gpu=10%.",
+		func(s string) (err error) {
+			config.SafetyMargins, err = ParseMargins(s)
+			return
+		})
+}
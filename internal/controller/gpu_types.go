@@ -0,0 +1,120 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/inf.v0"
+
+	v1 "k8s.io/api/core/v1"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// GPUs of each type are tracked as an additional resource in Weights, e.g., "nvidia.com/gpu.Tesla-T4"
+// so that reservations, priorities, and fit checks apply to each GPU type
+
+const gpuProductLabel = "nvidia.com/gpu.product" // node label for GPU type
+
+// Resource name for GPUs of a given type
+func gpuTypeResource(gpuType string) v1.ResourceName {
+	return v1.ResourceName(nvidiaGpu + "." + gpuType)
+}
+
+// Account GPUs in weights as GPUs of the given type too, return weights
+func addGPUType(w Weights, gpuType string) Weights {
+	if gpu, ok := w[nvidiaGpu]; ok && gpuType != "" {
+		w[gpuTypeResource(gpuType)] = new(inf.Dec).Set(gpu)
+	}
+	return w
+}
+
+// Get GPU type of node, "" if unknown
+func (r *AppWrapperReconciler) nodeGPUType(name string) string {
+	if node, ok := r.Nodes[name]; ok {
+		return node.Labels[gpuProductLabel]
+	}
+	return ""
+}
+
+// Parse comma-separated list of GPU quotas, for example "Tesla-T4=16,NVIDIA-A100-SXM4-80GB=8"
+func ParseGPUQuotas(s string) (map[string]int64, error) {
+	quotas := map[string]int64{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry == "" {
+			continue
+		}
+		gpuType, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid GPU quota %q", entry)
+		}
+		quota, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || quota < 0 {
+			return nil, fmt.Errorf("invalid GPU quota %q", entry)
+		}
+		quotas[gpuType] = quota
+	}
+	return quotas, nil
+}
+
+// Cap the capacity for each GPU type to the quota for this type, GPU types absent from the cluster have no capacity
+// Return the capacity withheld for each GPU type
+func applyGPUQuotas(capacity Weights, quotas map[string]int64) Weights {
+	withheld := Weights{}
+	for gpuType, quota := range quotas {
+		name := gpuTypeResource(gpuType)
+		if q := inf.NewDec(quota, 0); capacity[name] != nil && capacity[name].Cmp(q) > 0 {
+			withheld[name] = new(inf.Dec).Sub(capacity[name], q)
+			capacity[name] = q
+		}
+	}
+	return withheld
+}
+
+// Discount the capacity withheld by GPU quotas from the request of a quota-exempt AppWrapper
+// The request is checked against the capacity of each GPU type irrespective of the quota for this type
+func (r *AppWrapperReconciler) exemptGPUQuotas(request Weights) Weights {
+	exempt := request.Clone()
+	for name, withheld := range r.gpuWithheld {
+		if v := exempt[name]; v != nil {
+			if v = new(inf.Dec).Sub(v, withheld); v.Sign() < 0 {
+				v = inf.NewDec(0, 0)
+			}
+			exempt[name] = v
+		}
+	}
+	return exempt
+}
+
+// Charge the GPUs of an AppWrapper without GPU type to every GPU type with a quota on the local cluster
+// The pods of such an AppWrapper may be placed on nodes of any type, charging every type enforces the quotas
+func (r *AppWrapperReconciler) chargeGPUQuotas(appWrapper *mcadv1beta1.AppWrapper, request Weights) Weights {
+	gpu, ok := request[nvidiaGpu]
+	if !ok || appWrapper.Spec.GPUType != "" || len(r.Config.GPUQuotas) == 0 {
+		return request
+	}
+	charged := request.Clone()
+	for gpuType := range r.Config.GPUQuotas {
+		if name := gpuTypeResource(gpuType); r.ClusterCapacity[name] != nil {
+			charged[name] = new(inf.Dec).Set(gpu)
+		}
+	}
+	return charged
+}
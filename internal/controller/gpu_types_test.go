@@ -0,0 +1,44 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"gopkg.in/inf.v0"
+)
+
+func TestExemptGPUQuotas(t *testing.T) {
+	a100 := gpuTypeResource("A100")
+	h100 := gpuTypeResource("H100")
+	capacity := Weights{a100: inf.NewDec(8, 0), h100: inf.NewDec(4, 0)}
+	r := &AppWrapperReconciler{}
+	r.gpuWithheld = applyGPUQuotas(capacity, map[string]int64{"A100": 2, "H100": 8})
+	if capacity[a100].Cmp(inf.NewDec(2, 0)) != 0 || capacity[h100].Cmp(inf.NewDec(4, 0)) != 0 {
+		t.Fatalf("capped capacity: got %v", capacity)
+	}
+	request := Weights{a100: inf.NewDec(8, 0)}
+	if !r.exemptGPUQuotas(request).Fits(capacity) {
+		t.Error("exempt request should fit the capacity withheld by the quota")
+	}
+	if request.Fits(capacity) {
+		t.Error("request should not fit the quota")
+	}
+	if r.exemptGPUQuotas(Weights{a100: inf.NewDec(9, 0)}).Fits(capacity) {
+		t.Error("exempt request should not exceed the capacity")
+	}
+}
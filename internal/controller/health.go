@@ -0,0 +1,81 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// The health and readiness probes reflect the state of the dispatch subsystem
+// The liveness probe fails if dispatch has not been evaluated for too long, e.g., because a reconciliation is wedged
+// The readiness probe fails if informers are not synced, cluster capacity is stale, or the event channel is saturated
+// Capacity is only stale if refreshing it fails, so pausing dispatch does not fail the probe
+// Probes pass until the first dispatch evaluation, so standby replicas waiting for leader election stay healthy
+
+// Timestamps of the dispatch subsystem in Unix nanoseconds
+type healthState struct {
+	lastDispatch     atomic.Int64 // last dispatch evaluation
+	lastCapacitySync atomic.Int64 // last cluster capacity refresh
+	capacityFailing  atomic.Bool  // last cluster capacity refresh attempt failed
+	eventsFullSince  atomic.Int64 // since when the event channel has been full, zero if not full
+}
+
+// Return time elapsed since timestamp, zero if timestamp is not set
+func since(timestamp *atomic.Int64) time.Duration {
+	if t := timestamp.Load(); t != 0 {
+		return time.Since(time.Unix(0, t))
+	}
+	return 0
+}
+
+// Liveness check failing if dispatch has not been evaluated for too long
+func (r *AppWrapperReconciler) checkLiveness(_ *http.Request) error {
+	if elapsed := since(&r.health.lastDispatch); elapsed > dispatchLivenessTimeout {
+		return fmt.Errorf("no dispatch evaluation for %v", elapsed.Round(time.Second))
+	}
+	return nil
+}
+
+// Return readiness check failing if informers are not synced, capacity is stale, or the event channel is saturated
+func (r *AppWrapperReconciler) readinessCheck(informers cache.Cache) func(*http.Request) error {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+		if !informers.WaitForCacheSync(ctx) {
+			return errors.New("informers not synced")
+		}
+		if elapsed := since(&r.health.lastCapacitySync); elapsed > capacityStaleTimeout && r.health.capacityFailing.Load() {
+			return fmt.Errorf("cluster capacity not refreshed for %v", elapsed.Round(time.Second))
+		}
+		if len(r.Events) < cap(r.Events) {
+			r.health.eventsFullSince.Store(0)
+		} else {
+			r.health.eventsFullSince.CompareAndSwap(0, time.Now().UnixNano())
+			if elapsed := since(&r.health.eventsFullSince); elapsed > eventSaturationTimeout {
+				return fmt.Errorf("event channel saturated for %v", elapsed.Round(time.Second))
+			}
+		}
+		return nil
+	}
+}
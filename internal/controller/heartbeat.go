@@ -0,0 +1,109 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Running AppWrappers carry a Heartbeat condition recording the last time their pods were observed healthy
+// Pods are periodically counted bypassing the informer cache so a silently broken pod watch cannot fake a heartbeat
+// A count disagreeing with the informer cache is reported with a warning event
+// AppWrappers without a heartbeat for longer than the heartbeat timeout are requeued
+
+const heartbeatCondition = "Heartbeat" // condition type for the last healthy observation of the pods
+
+var podListKind = v1.SchemeGroupVersion.WithKind("PodList")
+
+// Count the pods of an AppWrapper bypassing the informer cache
+func (r *AppWrapperReconciler) countPodsUncached(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (*PodCounts, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(podListKind) // unstructured objects are not cached
+	if err := c.List(ctx, list, client.MatchingLabels{nameLabel: appWrapper.Name}); err != nil {
+		return nil, err
+	}
+	pods := make([]v1.Pod, len(list.Items))
+	for i := range list.Items {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &pods[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tallyPods(appWrapper, pods, r.Config.TerminatingPods), nil
+}
+
+// Refresh the heartbeat of a running AppWrapper or requeue it if the heartbeat is missing for too long
+// The timestamp starts the pod count clock, i.e., dispatch time or the end of the image pre-pull
+// The heartbeat is not checked before the initial waiting time for pods has elapsed
+// Return true if the reconciliation is complete
+func (r *AppWrapperReconciler) heartbeat(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts, statuses []*ResourceStatus,
+	timestamp metav1.Time) (bool, ctrl.Result, error) {
+	timeout := r.Config.HeartbeatTimeout
+	if timeout <= 0 || appWrapper.Spec.Scheduling.MinAvailable <= 0 || !r.observesPods(appWrapper) ||
+		!metav1.Now().After(timestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds)*time.Second)) {
+		return false, ctrl.Result{}, nil
+	}
+	// the heartbeat starts with the pod count clock
+	last := timestamp
+	if condition := meta.FindStatusCondition(appWrapper.Status.Conditions, heartbeatCondition); condition != nil && last.Before(&condition.LastTransitionTime) {
+		last = condition.LastTransitionTime
+	}
+	interval := timeout / 4
+	if interval < runDelay {
+		interval = runDelay
+	}
+	if time.Since(last.Time) < interval {
+		return false, ctrl.Result{}, nil
+	}
+	// count pods bypassing the informer cache
+	observed, err := r.countPodsUncached(ctx, appWrapper)
+	if err != nil {
+		return true, ctrl.Result{}, err
+	}
+	if observed.Running != counts.Running || observed.Succeeded != counts.Succeeded || observed.Failed != counts.Failed {
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, "StalePodCache", "pods observed from the API server do not match the informer cache")
+		log.FromContext(ctx).Info("Stale pod cache", "cached", counts.Running, "observed", observed.Running)
+	}
+	healthy := healthyReplicas(appWrapper, observed, statuses) + initializingPods(appWrapper, observed, timestamp)
+	if isReady(statuses) || healthy >= int(appWrapper.Spec.Scheduling.MinAvailable) {
+		meta.RemoveStatusCondition(&appWrapper.Status.Conditions, heartbeatCondition)
+		meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: heartbeatCondition, Status: metav1.ConditionTrue,
+			Reason: "PodsHealthy", Message: strconv.Itoa(healthy) + " healthy pods observed"})
+		return true, ctrl.Result{RequeueAfter: runDelay}, r.saveStatus(ctx, appWrapper)
+	}
+	if time.Since(last.Time) > timeout {
+		result, err := r.requeueOrFail(ctx, appWrapper, false, mcadv1beta1.PodsFailed, "no healthy pods observed since "+last.Format(time.RFC3339))
+		return true, result, err
+	}
+	return false, ctrl.Result{}, nil
+}
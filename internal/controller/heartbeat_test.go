@@ -0,0 +1,75 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestHeartbeatWaitsForPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	now := time.Now()
+	running := func(name string, dispatched time.Time, initialWait int64) *mcadv1beta1.AppWrapper {
+		appWrapper := &mcadv1beta1.AppWrapper{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)},
+			Status: mcadv1beta1.AppWrapperStatus{Phase: mcadv1beta1.Running, Step: mcadv1beta1.Created,
+				DispatchTimestamp: metav1.NewTime(dispatched), Target: localTarget},
+		}
+		appWrapper.Spec.Scheduling.MinAvailable = 1
+		appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds = initialWait
+		return appWrapper
+	}
+	for _, tc := range []struct {
+		name       string
+		appWrapper *mcadv1beta1.AppWrapper
+		timestamp  time.Time // start of the pod count clock
+		requeued   bool
+	}{
+		{"pre-pulled", running("pre-pulled", now.Add(-2*time.Hour), 60), now.Add(-30 * time.Second), false},
+		{"slow start", running("slow-start", now.Add(-20*time.Minute), 3600), now.Add(-20 * time.Minute), false},
+		{"no pods", running("no-pods", now.Add(-2*time.Hour), 60), now.Add(-2 * time.Hour), true},
+	} {
+		r := &AppWrapperReconciler{
+			Client:   fake.NewClientBuilder().WithScheme(scheme).WithObjects(tc.appWrapper).WithStatusSubresource(tc.appWrapper).Build(),
+			Scheme:   scheme,
+			Cache:    map[types.UID]*CachedAppWrapper{},
+			Recorder: record.NewFakeRecorder(10),
+			Config:   Config{HeartbeatTimeout: 10 * time.Minute},
+		}
+		done, _, err := r.heartbeat(context.Background(), tc.appWrapper, &PodCounts{}, nil, metav1.NewTime(tc.timestamp))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if requeued := done && tc.appWrapper.Status.Step == mcadv1beta1.Deleting; requeued != tc.requeued {
+			t.Errorf("%s: requeued %v, want %v", tc.name, requeued, tc.requeued)
+		}
+	}
+}
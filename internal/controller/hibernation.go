@@ -0,0 +1,99 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const replicasAnnotation = "workload.codeflare.dev/replicas" // replica count of hibernated resource
+
+// Scale wrapped resources with a replica count to zero replicas, remembering the replica counts
+func (r *AppWrapperReconciler) hibernateResources(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	return r.forEachScalableResource(ctx, appWrapper, func(obj *unstructured.Unstructured, replicas int64) bool {
+		if _, ok := obj.GetAnnotations()[replicasAnnotation]; ok || replicas == 0 {
+			return false // already hibernated
+		}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[replicasAnnotation] = strconv.FormatInt(replicas, 10)
+		obj.SetAnnotations(annotations)
+		_ = unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas")
+		return true
+	})
+}
+
+// Restore the replica counts of hibernated wrapped resources
+func (r *AppWrapperReconciler) wakeResources(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	return r.forEachScalableResource(ctx, appWrapper, func(obj *unstructured.Unstructured, _ int64) bool {
+		annotations := obj.GetAnnotations()
+		value, ok := annotations[replicasAnnotation]
+		if !ok {
+			return false // not hibernated
+		}
+		replicas, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			replicas = 1 // should not happen
+		}
+		delete(annotations, replicasAnnotation)
+		obj.SetAnnotations(annotations)
+		_ = unstructured.SetNestedField(obj.Object, replicas, "spec", "replicas")
+		return true
+	})
+}
+
+// Apply mutation to existing wrapped resources with a replica count, update resources if mutated
+func (r *AppWrapperReconciler) forEachScalableResource(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper,
+	mutate func(obj *unstructured.Unstructured, replicas int64) bool) error {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return err
+	}
+	for _, resource := range appWrapper.Spec.Resources.GenericItems {
+		obj, err := parseResource(appWrapper, &resource)
+		if err != nil {
+			return err
+		}
+		if _, ok, _ := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas"); !ok {
+			continue // template does not specify a replica count
+		}
+		if err := t.Get(ctx, appWrapper, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		replicas, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		if !ok {
+			continue
+		}
+		if mutate(obj, replicas) {
+			if err := t.Update(ctx, appWrapper, obj); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
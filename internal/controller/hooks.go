@@ -0,0 +1,323 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Hooks are Jobs run by MCAD in the namespace of the AppWrapper on the local cluster or webhooks called by MCAD
+// The pre-dispatch hook runs at each dispatch, before wrapped resources are created
+// The completion hook runs once the AppWrapper succeeds or fails, before its wrapped resources are deleted if any
+// AppWrappers failed with zero min available run the completion hook but keep their resources
+// AppWrappers failed before dispatch, e.g., flushed or exceeding their lifetime while queued, do not run the completion hook
+// The outcome of a hook is recorded in a condition of the AppWrapper and the hook Job is deleted once the condition is persisted
+// Failed hooks, including hooks exceeding their timeout, are ignored or fail the AppWrapper
+// Failed pre-dispatch hooks requeue the AppWrapper if the failure is not ignored
+
+const (
+	hookLabel                = "workload.codeflare.dev/hook" // label for hook Jobs naming the hook
+	preDispatchHook          = "pre-dispatch"                // name of the pre-dispatch hook
+	preDispatchHookCondition = "PreDispatchHook"             // condition type for the outcome of the pre-dispatch hook
+	completionHook           = "completion"                  // name of the completion hook
+	completionHookCondition  = "CompletionHook"              // condition type for the outcome of the completion hook
+	hookDelay                = 5 * time.Second               // delay between checks of running hooks
+	defaultWebhookTimeout    = 10 * time.Second              // default timeout of webhook calls
+	maxWebhookFailureMessage = 256                           // max length of webhook response included in failure message
+)
+
+// Request sent to webhook hooks
+type HookRequest struct {
+	Hook      string            `json:"hook"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	UID       string            `json:"uid"`
+	Phase     string            `json:"phase"`
+	Target    string            `json:"target,omitempty"` // target cluster
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+var jobKind = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+
+// Client for webhook hooks, redirects are not followed so calls stay within the allowed URLs
+var hookClient = &http.Client{
+	Timeout: maxWebhookHookTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Return the name of the hook Job
+func hookJobName(appWrapper *mcadv1beta1.AppWrapper, hook string) string {
+	return appWrapper.Name + "-" + hook + "-hook"
+}
+
+// Create the hook Job if missing and check its completion or call the webhook
+// Hook Jobs created before the given time are left over from an earlier run and deleted
+// Return true once the hook has completed with an empty message if successful and a failure message if not
+func (r *AppWrapperReconciler) runHook(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, hook string, spec *mcadv1beta1.HookSpec,
+	since metav1.Time) (bool, string, error) {
+	if spec.URL != "" {
+		done, failure := r.callWebhook(ctx, appWrapper, hook, spec)
+		return done, failure, nil
+	}
+	job := &unstructured.Unstructured{}
+	job.SetGroupVersionKind(jobKind)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: appWrapper.Namespace, Name: hookJobName(appWrapper, hook)}, job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, "", err
+		}
+		// create hook Job
+		if _, _, err := unstructured.UnstructuredJSONScheme.Decode(spec.Template.Raw, nil, job); err != nil {
+			return true, "invalid hook template: " + err.Error(), nil
+		}
+		if job.GroupVersionKind() != jobKind {
+			return true, "hook template is not a batch/v1 Job", nil
+		}
+		job.SetName(hookJobName(appWrapper, hook))
+		job.SetNamespace(appWrapper.Namespace)
+		labels := job.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[hookLabel] = hook
+		job.SetLabels(labels)
+		if spec.TimeoutInSeconds > 0 {
+			_ = unstructured.SetNestedField(job.Object, spec.TimeoutInSeconds, "spec", "activeDeadlineSeconds")
+		}
+		if err := controllerutil.SetOwnerReference(appWrapper, job, r.Scheme); err != nil {
+			return false, "", err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+				return true, "invalid hook template: " + err.Error(), nil
+			}
+			return false, "", err
+		}
+		log.FromContext(ctx).Info("Hook started", "hook", hook)
+		return false, "", nil
+	}
+	if created := job.GetCreationTimestamp(); created.Before(&since) {
+		return false, "", r.deleteHookJob(ctx, job)
+	}
+	// check Job conditions, the Job is deleted once its outcome is recorded
+	conditions, _, _ := unstructured.NestedSlice(job.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["status"] != string(metav1.ConditionTrue) {
+			continue
+		}
+		switch condition["type"] {
+		case "Complete":
+			return true, "", nil
+		case "Failed":
+			return true, fmt.Sprintf("%v: %v", condition["reason"], condition["message"]), nil
+		}
+	}
+	return false, "", nil
+}
+
+// Call the webhook of a hook
+// Status 202 indicates the hook is still running and the webhook is called again later, other 2xx statuses indicate success
+// Errors, other statuses, and URLs without an allowed prefix are failures
+func (r *AppWrapperReconciler) callWebhook(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, hook string, spec *mcadv1beta1.HookSpec) (bool, string) {
+	if !mcadv1beta1.HookURLAllowed(spec.URL, r.Config.HookURLPrefixes) {
+		return true, "hook url not allowed: " + spec.URL
+	}
+	timeout := defaultWebhookTimeout
+	if spec.TimeoutInSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutInSeconds) * time.Second
+	}
+	if timeout > maxWebhookHookTimeout {
+		timeout = maxWebhookHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	data, err := json.Marshal(HookRequest{
+		Hook:      hook,
+		Namespace: appWrapper.Namespace,
+		Name:      appWrapper.Name,
+		UID:       string(appWrapper.UID),
+		Phase:     string(appWrapper.Status.Phase),
+		Target:    scorerName(appWrapper.Status.Target),
+		Labels:    appWrapper.Labels,
+	})
+	if err != nil {
+		return true, err.Error()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, spec.URL, bytes.NewReader(data))
+	if err != nil {
+		return true, "invalid hook url: " + err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hookClient.Do(req)
+	if err != nil {
+		return true, err.Error()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusAccepted {
+		return false, ""
+	}
+	if resp.StatusCode/100 == 2 {
+		return true, ""
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookFailureMessage))
+	return true, strings.TrimSpace(fmt.Sprintf("webhook returned status %d %s", resp.StatusCode, message))
+}
+
+// Delete completed hook Job and its pods
+func (r *AppWrapperReconciler) deleteHookJob(ctx context.Context, job *unstructured.Unstructured) error {
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete the hook Job if any once the outcome of the hook is persisted
+func (r *AppWrapperReconciler) cleanupHook(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, hook string, spec *mcadv1beta1.HookSpec) error {
+	if spec.URL != "" {
+		return nil
+	}
+	job := &unstructured.Unstructured{}
+	job.SetGroupVersionKind(jobKind)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: appWrapper.Namespace, Name: hookJobName(appWrapper, hook)}, job); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	return r.deleteHookJob(ctx, job)
+}
+
+// Record the outcome of a hook in a condition of the AppWrapper and an event
+// The condition is replaced so its transition time records the last run of the hook
+func (r *AppWrapperReconciler) recordHook(appWrapper *mcadv1beta1.AppWrapper, conditionType string, hook string, failure string) {
+	condition := metav1.Condition{Type: conditionType, Status: metav1.ConditionTrue, Reason: "Succeeded", Message: "Hook succeeded"}
+	eventType := v1.EventTypeNormal
+	if failure != "" {
+		condition = metav1.Condition{Type: conditionType, Status: metav1.ConditionFalse, Reason: "Failed", Message: failure}
+		eventType = v1.EventTypeWarning
+	}
+	meta.RemoveStatusCondition(&appWrapper.Status.Conditions, conditionType)
+	meta.SetStatusCondition(&appWrapper.Status.Conditions, condition)
+	r.Recorder.Event(appWrapper, eventType, conditionType, hook+" hook "+condition.Message)
+}
+
+// Run the pre-dispatch hook of a dispatched AppWrapper before creating its wrapped resources
+// Return true once wrapped resources may be created
+func (r *AppWrapperReconciler) runPreDispatchHook(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	if appWrapper.Spec.Hooks == nil || appWrapper.Spec.Hooks.PreDispatch == nil {
+		return true, ctrl.Result{}, nil
+	}
+	spec := appWrapper.Spec.Hooks.PreDispatch
+	// run once per dispatch
+	if condition := meta.FindStatusCondition(appWrapper.Status.Conditions, preDispatchHookCondition); condition != nil &&
+		!condition.LastTransitionTime.Before(&appWrapper.Status.DispatchTimestamp) {
+		if err := r.cleanupHook(ctx, appWrapper, preDispatchHook, spec); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		return true, ctrl.Result{}, nil
+	}
+	done, failure, err := r.runHook(ctx, appWrapper, preDispatchHook, spec, appWrapper.Status.DispatchTimestamp)
+	if err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if !done {
+		return false, ctrl.Result{RequeueAfter: hookDelay}, nil
+	}
+	r.recordHook(appWrapper, preDispatchHookCondition, preDispatchHook, failure)
+	log.FromContext(ctx).Info("Hook completed", "hook", preDispatchHook, "failure", failure)
+	if failure != "" && spec.FailurePolicy == mcadv1beta1.FailOnHookFailure {
+		// requeue or fail, the hook runs again at the next dispatch
+		result, err := r.requeueOrFail(ctx, appWrapper, false, mcadv1beta1.HookFailed, "pre-dispatch hook failed: "+failure)
+		if err != nil {
+			return false, result, err
+		}
+		return false, result, r.cleanupHook(ctx, appWrapper, preDispatchHook, spec)
+	}
+	if err := r.saveStatus(ctx, appWrapper); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if err := r.cleanupHook(ctx, appWrapper, preDispatchHook, spec); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	return true, ctrl.Result{}, nil
+}
+
+// Check whether AppWrapper has a completion hook
+func hasCompletionHook(appWrapper *mcadv1beta1.AppWrapper) bool {
+	return appWrapper.Spec.Hooks != nil && appWrapper.Spec.Hooks.OnCompletion != nil
+}
+
+// Run the completion hook of a succeeded or failed AppWrapper before deleting its wrapped resources
+// Return true once wrapped resources may be deleted
+func (r *AppWrapperReconciler) runCompletionHook(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	if !hasCompletionHook(appWrapper) {
+		return true, ctrl.Result{}, nil
+	}
+	spec := appWrapper.Spec.Hooks.OnCompletion
+	// run once per completion
+	if condition := meta.FindStatusCondition(appWrapper.Status.Conditions, completionHookCondition); condition != nil &&
+		!condition.LastTransitionTime.Before(&appWrapper.Status.RequeueTimestamp) {
+		if err := r.cleanupHook(ctx, appWrapper, completionHook, spec); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		return true, ctrl.Result{}, nil
+	}
+	done, failure, err := r.runHook(ctx, appWrapper, completionHook, spec, appWrapper.Status.RequeueTimestamp)
+	if err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if !done {
+		return false, ctrl.Result{RequeueAfter: hookDelay}, nil
+	}
+	r.recordHook(appWrapper, completionHookCondition, completionHook, failure)
+	log.FromContext(ctx).Info("Hook completed", "hook", completionHook, "failure", failure)
+	if failure != "" && spec.FailurePolicy == mcadv1beta1.FailOnHookFailure && appWrapper.Status.Phase == mcadv1beta1.Succeeded {
+		// set failed/deleting status, the hook does not run again
+		appWrapper.Status.FailureReason = mcadv1beta1.HookFailed
+		result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Deleting, "completion hook failed: "+failure)
+		if err != nil {
+			return false, result, err
+		}
+		return false, result, r.cleanupHook(ctx, appWrapper, completionHook, spec)
+	}
+	if err := r.saveStatus(ctx, appWrapper); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	if err := r.cleanupHook(ctx, appWrapper, completionHook, spec); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	return true, ctrl.Result{}, nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestCallWebhookAllowedURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/allowed/redirect" {
+			http.Redirect(w, req, "/other", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	r := &AppWrapperReconciler{Config: Config{HookURLPrefixes: []string{server.URL + "/allowed/"}}}
+	appWrapper := &mcadv1beta1.AppWrapper{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aw"}}
+	for _, tc := range []struct {
+		url     string
+		success bool
+	}{
+		{server.URL + "/allowed/hook", true},
+		{server.URL + "/other", false},
+		{server.URL + "/allowed/../other", false},
+		{server.URL + "/allowed/redirect", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+	} {
+		done, failure := r.callWebhook(context.Background(), appWrapper, preDispatchHook, &mcadv1beta1.HookSpec{URL: tc.url, TimeoutInSeconds: 3600})
+		if !done || (failure == "") != tc.success {
+			t.Errorf("%s: done %v, failure %q, want success %v", tc.url, done, failure, tc.success)
+		}
+	}
+}
+
+func TestHookJobDeletedOnceOutcomeIsPersisted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	dispatched := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	for _, tc := range []struct {
+		name        string
+		created     metav1.Time // creation time of the hook Job
+		writeFails  bool
+		done        bool
+		jobDeleted  bool
+		conditioned bool
+	}{
+		{"persisted", metav1.Now(), false, true, true, true},
+		{"write failure", metav1.Now(), true, false, false, false},
+		{"earlier run", metav1.NewTime(dispatched.Add(-time.Hour)), false, false, true, false},
+	} {
+		appWrapper := &mcadv1beta1.AppWrapper{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aw", UID: types.UID("aw")},
+			Spec: mcadv1beta1.AppWrapperSpec{Hooks: &mcadv1beta1.HooksSpec{
+				PreDispatch: &mcadv1beta1.HookSpec{FailurePolicy: mcadv1beta1.FailOnHookFailure}}},
+			Status: mcadv1beta1.AppWrapperStatus{Phase: mcadv1beta1.Running, Step: mcadv1beta1.Creating,
+				DispatchTimestamp: dispatched, Target: localTarget},
+		}
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: hookJobName(appWrapper, preDispatchHook), CreationTimestamp: tc.created},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: v1.ConditionTrue}}},
+		}
+		fail := func() error {
+			if tc.writeFails {
+				return apierrors.NewServiceUnavailable("injected")
+			}
+			return nil
+		}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appWrapper, job).WithStatusSubresource(appWrapper).
+			WithInterceptorFuncs(interceptor.Funcs{
+				SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return c.SubResource(subResource).Update(ctx, obj, opts...)
+				},
+				SubResourcePatch: func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+					if err := fail(); err != nil {
+						return err
+					}
+					return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+				},
+			}).Build()
+		r := &AppWrapperReconciler{
+			Client:   c,
+			Scheme:   scheme,
+			Cache:    map[types.UID]*CachedAppWrapper{},
+			Recorder: record.NewFakeRecorder(10),
+		}
+		done, _, err := r.runPreDispatchHook(context.Background(), appWrapper)
+		if done != tc.done || (err != nil) != tc.writeFails {
+			t.Errorf("%s: done %v, error %v", tc.name, done, err)
+		}
+		err = c.Get(context.Background(), client.ObjectKeyFromObject(job), &batchv1.Job{})
+		if jobDeleted := apierrors.IsNotFound(err); jobDeleted != tc.jobDeleted {
+			t.Errorf("%s: job deleted %v, want %v", tc.name, jobDeleted, tc.jobDeleted)
+		}
+		persisted := &mcadv1beta1.AppWrapper{}
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(appWrapper), persisted); err != nil {
+			t.Fatal(err)
+		}
+		if conditioned := meta.IsStatusConditionTrue(persisted.Status.Conditions, preDispatchHookCondition); conditioned != tc.conditioned {
+			t.Errorf("%s: condition persisted %v, want %v", tc.name, conditioned, tc.conditioned)
+		}
+	}
+}
+
+func TestCompletionHookOnFailure(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	template := []byte(`{"apiVersion":"batch/v1","kind":"Job","spec":{"template":{"spec":{"restartPolicy":"Never","containers":[{"name":"hook","image":"busybox"}]}}}}`)
+	for _, tc := range []struct {
+		name         string
+		phase        mcadv1beta1.AppWrapperPhase
+		step         mcadv1beta1.AppWrapperStep
+		minAvailable int32
+		step2        mcadv1beta1.AppWrapperStep // step after failure
+		hook         bool                       // completion hook runs
+	}{
+		{"running", mcadv1beta1.Running, mcadv1beta1.Created, 1, mcadv1beta1.Deleting, true},
+		{"zero min available", mcadv1beta1.Running, mcadv1beta1.Created, 0, mcadv1beta1.Created, true},
+		{"queued", mcadv1beta1.Queued, mcadv1beta1.Idle, 1, mcadv1beta1.Idle, false},
+	} {
+		appWrapper := &mcadv1beta1.AppWrapper{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aw", UID: types.UID("aw")},
+			Spec: mcadv1beta1.AppWrapperSpec{Hooks: &mcadv1beta1.HooksSpec{
+				OnCompletion: &mcadv1beta1.HookSpec{Template: runtime.RawExtension{Raw: template}}}},
+			Status: mcadv1beta1.AppWrapperStatus{Phase: tc.phase, Step: tc.step, Target: localTarget},
+		}
+		appWrapper.Spec.Scheduling.MinAvailable = tc.minAvailable
+		appWrapper.Spec.RetryPolicy = mcadv1beta1.RetryNever
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appWrapper).WithStatusSubresource(appWrapper).Build()
+		r := &AppWrapperReconciler{
+			Client:   c,
+			Scheme:   scheme,
+			Cache:    map[types.UID]*CachedAppWrapper{},
+			Events:   make(chan event.GenericEvent, 1),
+			Recorder: record.NewFakeRecorder(10),
+		}
+		ctx := context.Background()
+		if tc.phase == mcadv1beta1.Queued {
+			// flushed
+			appWrapper.Status.FailureReason = mcadv1beta1.Flushed
+			if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Idle); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := r.requeueOrFail(ctx, appWrapper, true, mcadv1beta1.PodsFailed, "failed"); err != nil {
+			t.Fatal(err)
+		}
+		if appWrapper.Status.Phase != mcadv1beta1.Failed || appWrapper.Status.Step != tc.step2 {
+			t.Errorf("%s: status %s/%s, want %s/%s", tc.name, appWrapper.Status.Phase, appWrapper.Status.Step, mcadv1beta1.Failed, tc.step2)
+		}
+		if _, err := r.reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(appWrapper)}); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Get(ctx, client.ObjectKey{Namespace: "default", Name: hookJobName(appWrapper, completionHook)}, &batchv1.Job{})
+		if hook := err == nil; hook != tc.hook {
+			t.Errorf("%s: completion hook run %v, want %v", tc.name, hook, tc.hook)
+		}
+	}
+}
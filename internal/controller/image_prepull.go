@@ -0,0 +1,158 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const (
+	prePullLabel = "workload.codeflare.dev/prepull" // label for image pre-pull pods
+	pauseImage   = "registry.k8s.io/pause:3.9"      // image for long-running placeholder containers
+)
+
+// Name of image pre-pull DaemonSet
+func prePullName(appWrapper *mcadv1beta1.AppWrapper) string {
+	return appWrapper.Name + "-prepull"
+}
+
+// Collect container images of all wrapped pod templates
+func collectImages(appWrapper *mcadv1beta1.AppWrapper) []string {
+	set := map[string]bool{}
+	for _, resource := range appWrapper.Spec.Resources.GenericItems {
+		obj, err := parseResource(appWrapper, &resource)
+		if err != nil {
+			continue
+		}
+		forEachPodTemplate(obj.UnstructuredContent(), func(_ map[string]interface{}, spec map[string]interface{}) {
+			for _, field := range []string{"initContainers", "containers"} {
+				containers, _ := spec[field].([]interface{})
+				for _, container := range containers {
+					if container, ok := container.(map[string]interface{}); ok {
+						if image, ok := container["image"].(string); ok {
+							set[image] = true
+						}
+					}
+				}
+			}
+		})
+	}
+	images := []string{}
+	for image := range set {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// Generate DaemonSet pulling AppWrapper images on candidate nodes
+// Each image is pulled in parallel by a container that exits immediately if the image has a shell
+// Pulling does not depend on the container starting successfully, as images without a shell cannot run the command
+func newPrePullDaemonSet(appWrapper *mcadv1beta1.AppWrapper, nodeSelector map[string]string) *appsv1.DaemonSet {
+	labels := map[string]string{prePullLabel: appWrapper.Name}
+	containers := []v1.Container{}
+	for i, image := range collectImages(appWrapper) {
+		containers = append(containers, v1.Container{
+			Name:            "prepull-" + strconv.Itoa(i),
+			Image:           image,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Command:         []string{"sh", "-c", "exit 0"},
+		})
+	}
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: prePullName(appWrapper), Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers:         containers,
+					NodeSelector:       nodeSelector,
+					Tolerations:        appWrapper.Spec.Tolerations,
+					ServiceAccountName: appWrapper.Spec.ServiceAccountName,
+					ImagePullSecrets:   appWrapper.Spec.ImagePullSecrets,
+				},
+			},
+		},
+	}
+}
+
+// Check whether the images have been pulled on all candidate nodes
+// Pull progress is only observable on targets with direct access, on other targets images are never reported as pulled
+func (r *AppWrapperReconciler) isPrePulled(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, error) {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return false, err
+	}
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: prePullName(appWrapper)}}
+	if err := t.Get(ctx, appWrapper, daemonSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	status := daemonSet.Status
+	if status.ObservedGeneration < daemonSet.Generation || status.DesiredNumberScheduled == 0 ||
+		status.CurrentNumberScheduled < status.DesiredNumberScheduled {
+		return false, nil
+	}
+	c := t.Client()
+	if c == nil {
+		return false, nil
+	}
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.UnsafeDisableDeepCopy, client.InNamespace(appWrapper.Namespace),
+		client.MatchingLabels{prePullLabel: appWrapper.Name}); err != nil {
+		return false, err
+	}
+	pulled := 0
+	for i := range pods.Items {
+		if isPulled(&pods.Items[i]) {
+			pulled++
+		}
+	}
+	return pulled >= int(status.DesiredNumberScheduled), nil
+}
+
+// Check whether the node of the pre-pull pod is done pulling every image
+// An image is done once its container has been created, irrespective of the outcome, or its pull failed
+func isPulled(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.ImageID != "" {
+			continue
+		}
+		if waiting := status.State.Waiting; waiting != nil &&
+			(waiting.Reason == "ErrImagePull" || waiting.Reason == "ImagePullBackOff" || waiting.Reason == "InvalidImageName") {
+			continue // the wrapped pods will report the same error
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestIsPulled(t *testing.T) {
+	pod := func(statuses ...v1.ContainerStatus) *v1.Pod {
+		return &v1.Pod{
+			Spec:   v1.PodSpec{NodeName: "node", Containers: []v1.Container{{Name: "prepull-0"}, {Name: "prepull-1"}}},
+			Status: v1.PodStatus{ContainerStatuses: statuses},
+		}
+	}
+	waiting := func(reason string) v1.ContainerStatus {
+		return v1.ContainerStatus{State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}}
+	}
+	// container of an image without shell fails to start but the image is pulled
+	startError := v1.ContainerStatus{ImageID: "sha256:a", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}}
+	completed := v1.ContainerStatus{ImageID: "sha256:b", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{}}}
+	for _, tc := range []struct {
+		name   string
+		pod    *v1.Pod
+		pulled bool
+	}{
+		{"no status", pod(), false},
+		{"pulling", pod(completed, waiting("ContainerCreating")), false},
+		{"pulled", pod(completed, startError), true},
+		{"pull failed", pod(completed, waiting("ImagePullBackOff")), true},
+	} {
+		if pulled := isPulled(tc.pod); pulled != tc.pulled {
+			t.Errorf("%s: got %v, want %v", tc.name, pulled, tc.pulled)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Pods running init containers, e.g., downloading data, are progressing rather than missing
+// They count toward the minimum number of healthy pods until the init time of the AppWrapper has elapsed
+
+// Check whether a scheduled pending pod is running its init containers
+func isInitializing(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodPending || len(pod.Spec.InitContainers) == 0 {
+		return false
+	}
+	scheduled, initialized := false, false
+	for _, condition := range pod.Status.Conditions {
+		switch condition.Type {
+		case v1.PodScheduled:
+			scheduled = condition.Status == v1.ConditionTrue
+		case v1.PodInitialized:
+			initialized = condition.Status == v1.ConditionTrue
+		}
+	}
+	return scheduled && !initialized
+}
+
+// Count pods running init containers that still count as progressing
+func initializingPods(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts, timestamp metav1.Time) int {
+	initTime := appWrapper.Spec.Scheduling.Requeuing.InitTimeInSeconds
+	if initTime > 0 && time.Now().After(timestamp.Add(time.Duration(initTime)*time.Second)) {
+		return 0
+	}
+	return counts.Initializing
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Admins may define injection profiles attached to namespaces or queues
+// MCAD injects the matching profiles into the pod templates of wrapped resources at dispatch time
+// Profiles only provide defaults: settings of the wrapped pods and settings injected by MCAD take precedence
+// and earlier profiles take precedence over later profiles
+
+// Defaults injected into the wrapped pods of AppWrappers in the given namespaces or queues
+type InjectionProfile struct {
+	// Name of the profile
+	Name string `json:"name"`
+
+	// Namespaces the profile applies to
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Queues the profile applies to
+	Queues []string `json:"queues,omitempty"`
+
+	// Tolerations added to pods
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+
+	// Node selector entries added to pods unless already specified
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Runtime class of pods unless already specified
+	RuntimeClassName string `json:"runtimeClassName,omitempty"`
+
+	// Labels added to pods unless already specified
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Environment variables added to containers unless already specified
+	Env []v1.EnvVar `json:"env,omitempty"`
+}
+
+// Load injection profiles from file
+func LoadInjectionProfiles(path string) ([]InjectionProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := []InjectionProfile{}
+	if err := yaml.UnmarshalStrict(data, &profiles); err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		for label := range profile.Labels {
+			if isReservedLabel(label) {
+				return nil, fmt.Errorf("profile %s: label %s is reserved", profile.Name, label)
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// Check whether profile applies to AppWrapper
+func profileMatches(profile *InjectionProfile, appWrapper *mcadv1beta1.AppWrapper) bool {
+	for _, namespace := range profile.Namespaces {
+		if namespace == appWrapper.Namespace {
+			return true
+		}
+	}
+	if queue, ok := appWrapper.Labels[queueLabel]; ok {
+		for _, q := range profile.Queues {
+			if q == queue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Inject matching profiles into all pod templates of wrapped resource
+func (r *AppWrapperReconciler) injectProfiles(appWrapper *mcadv1beta1.AppWrapper, obj *unstructured.Unstructured) {
+	for i := range r.Config.InjectionProfiles {
+		profile := &r.Config.InjectionProfiles[i]
+		if !profileMatches(profile, appWrapper) {
+			continue
+		}
+		forEachPodTemplate(obj.UnstructuredContent(), func(metadata map[string]interface{}, spec map[string]interface{}) {
+			for k, v := range profile.Labels {
+				if _, ok := nestedMap(metadata, "labels")[k]; !ok {
+					setNestedString(metadata, "labels", k, v)
+				}
+			}
+			for _, toleration := range profile.Tolerations {
+				if u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&toleration); err == nil {
+					appendUnique(spec, "tolerations", u)
+				}
+			}
+			for k, v := range profile.NodeSelector {
+				if _, ok := nestedMap(spec, "nodeSelector")[k]; !ok {
+					setNestedString(spec, "nodeSelector", k, v)
+				}
+			}
+			if _, ok := spec["runtimeClassName"]; !ok && profile.RuntimeClassName != "" {
+				spec["runtimeClassName"] = profile.RuntimeClassName
+			}
+			for _, field := range []string{"initContainers", "containers"} {
+				containers, _ := spec[field].([]interface{})
+				for _, c := range containers {
+					if container, ok := c.(map[string]interface{}); ok {
+						injectEnv(container, profile.Env)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Add environment variables to container unless already specified
+func injectEnv(container map[string]interface{}, env []v1.EnvVar) {
+	for _, envVar := range env {
+		existing, _ := container["env"].([]interface{})
+		found := false
+		for _, e := range existing {
+			if e, ok := e.(map[string]interface{}); ok && e["name"] == envVar.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&envVar); err == nil {
+				container["env"] = append(existing, u)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// In strict isolation mode, MCAD refuses wrapped resources that could affect other tenants
+// Wrapped resources must be namespaced kinds known to the local cluster and live in the namespace of the AppWrapper
+// Wrapped resources and their pod templates must not carry the labels reserved for MCAD
+// so tenants cannot impersonate other AppWrappers or queues in quota, tracking, and cleanup decisions
+// AppWrappers are checked when queued and again when dispatched
+
+// Prefixes of the labels reserved for MCAD
+var reservedLabelPrefixes = []string{nameLabel, "workload.codeflare.dev/"}
+
+// Check whether label is reserved for MCAD
+func isReservedLabel(label string) bool {
+	for _, prefix := range reservedLabelPrefixes {
+		if strings.HasPrefix(label, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check wrapped resources against strict isolation rules
+// Return the reason for refusing the AppWrapper if any
+func (r *AppWrapperReconciler) checkIsolation(appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) string {
+	if !r.Config.StrictIsolation {
+		return ""
+	}
+	for _, obj := range objects {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		namespaced, err := r.IsObjectNamespaced(obj)
+		if err != nil {
+			return "unknown kind " + kind + " in strict isolation mode"
+		}
+		if !namespaced {
+			return "cluster-scoped kind " + kind + " in strict isolation mode"
+		}
+		if obj.GetNamespace() != appWrapper.Namespace {
+			return kind + " " + obj.GetName() + " targets namespace " + obj.GetNamespace() + " in strict isolation mode"
+		}
+		u := obj.(*unstructured.Unstructured)
+		if u.GroupVersionKind().GroupKind() != appWrapperGroupKind { // nested AppWrappers inherit MCAD labels from their parent
+			for label := range u.GetLabels() {
+				if isReservedLabel(label) {
+					return kind + " " + obj.GetName() + " sets reserved label " + label + " in strict isolation mode"
+				}
+			}
+		}
+		reason := ""
+		forEachPodTemplate(u.Object, func(metadata map[string]interface{}, _ map[string]interface{}) {
+			labels, _ := metadata["labels"].(map[string]interface{})
+			for label := range labels {
+				if isReservedLabel(label) && reason == "" {
+					reason = "pod template of " + kind + " " + obj.GetName() + " sets reserved label " + label + " in strict isolation mode"
+				}
+			}
+		})
+		if reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
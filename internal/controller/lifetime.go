@@ -0,0 +1,79 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// AppWrappers may cap their lifetime since creation, covering queuing, running, and requeuings
+// An AppWrapper exceeding its max lifetime fails and its wrapped resources are deleted,
+// so forgotten AppWrappers do not hold quota and queue slots indefinitely
+
+const lifetimeExceededReason = "LifetimeExceeded" // event reason for AppWrappers exceeding their max lifetime
+
+// Remaining lifetime of an admitted AppWrapper that has not completed, false if unlimited or not applicable
+func remainingLifetime(appWrapper *mcadv1beta1.AppWrapper) (time.Duration, bool) {
+	maxLifetime := time.Duration(appWrapper.Spec.MaxLifetimeSeconds) * time.Second
+	if maxLifetime <= 0 {
+		return 0, false
+	}
+	switch appWrapper.Status.Phase {
+	case mcadv1beta1.Admitting, mcadv1beta1.Queued, mcadv1beta1.Running:
+		return time.Until(appWrapper.CreationTimestamp.Add(maxLifetime)), true
+	}
+	return 0, false
+}
+
+// Fail AppWrapper exceeding its max lifetime, deleting wrapped resources if any
+// Return true if the reconciliation is complete
+func (r *AppWrapperReconciler) checkLifetime(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	if remaining, ok := remainingLifetime(appWrapper); !ok || remaining > 0 {
+		return false, ctrl.Result{}, nil
+	}
+	message := fmt.Sprintf("max lifetime of %ds exceeded", appWrapper.Spec.MaxLifetimeSeconds)
+	log.FromContext(ctx).Info("Lifetime exceeded", "maxLifetimeSeconds", appWrapper.Spec.MaxLifetimeSeconds)
+	r.Recorder.Event(appWrapper, v1.EventTypeWarning, lifetimeExceededReason, message)
+	appWrapper.Status.FailureReason = mcadv1beta1.LifetimeExceeded
+	if appWrapper.Status.Step == mcadv1beta1.Idle {
+		// nothing to delete, queue slot is released
+		r.triggerDispatch()
+		result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Idle, message)
+		return true, result, err
+	}
+	// set failed/deleting status (request deletion of wrapped resources)
+	appWrapper.Status.RequeueTimestamp = metav1.Now()
+	result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Failed, mcadv1beta1.Deleting, message)
+	return true, result, err
+}
+
+// Requeue reconciliation no later than the end of the lifetime of the AppWrapper
+func withinLifetime(appWrapper *mcadv1beta1.AppWrapper, result ctrl.Result) ctrl.Result {
+	if remaining, ok := remainingLifetime(appWrapper); ok && remaining > 0 && (result.RequeueAfter <= 0 || remaining < result.RequeueAfter) {
+		result.RequeueAfter = remaining
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Admins may override a subset of the settings in a ConfigMap watched by the controller
+// The keys of the ConfigMap are the names of the corresponding command-line flags
+// Settings missing from the ConfigMap revert to their command-line values
+// Changes are applied in a special "*/config" reconciliation serialized with dispatching and trigger a dispatch
+// Invalid ConfigMaps are reported and ignored, the current settings remain in effect
+
+const configRequestName = "config" // name of the "*/config" reconciliation request
+
+// Settings that may be changed at runtime by flag name
+var liveSettings = map[string]func(config *Config, value string) error{
+	"pause-dispatch": func(c *Config, s string) (err error) {
+		c.PauseDispatch, err = strconv.ParseBool(s)
+		return
+	},
+	"preemption": func(c *Config, s string) (err error) {
+		c.Preemption, err = strconv.ParseBool(s)
+		return
+	},
+	"preemption-protection": func(c *Config, s string) (err error) {
+		c.PreemptionProtection, err = time.ParseDuration(s)
+		return
+	},
+	"max-queued-per-namespace": func(c *Config, s string) (err error) {
+		c.MaxQueuedPerNamespace, err = strconv.Atoi(s)
+		return
+	},
+	"max-queued-per-queue": func(c *Config, s string) (err error) {
+		c.MaxQueuedPerQueue, err = strconv.Atoi(s)
+		return
+	},
+	"max-queued-per-user": func(c *Config, s string) (err error) {
+		c.MaxQueuedPerUser, err = strconv.Atoi(s)
+		return
+	},
+	"stuck-timeout": func(c *Config, s string) (err error) {
+		c.StuckTimeout, err = time.ParseDuration(s)
+		return
+	},
+	"stuck-policy": func(c *Config, s string) (err error) {
+		c.StuckPolicy, err = ParseStuckPolicy(s)
+		return
+	},
+	"terminating-pods": func(c *Config, s string) (err error) {
+		c.TerminatingPods, err = ParseTerminatingPodPolicy(s)
+		return
+	},
+	"unschedulable-timeout": func(c *Config, s string) (err error) {
+		c.UnschedulableTimeout, err = time.ParseDuration(s)
+		return
+	},
+	"tie-breaker": func(c *Config, s string) (err error) {
+		c.TieBreaker, err = ParseTieBreaker(s)
+		return
+	},
+	"priority-bands": func(c *Config, s string) (err error) {
+		c.PriorityBands, err = ParsePriorityBands(s)
+		return
+	},
+	"gpu-quota": func(c *Config, s string) (err error) {
+		c.GPUQuotas, err = ParseGPUQuotas(s)
+		return
+	},
+	"fit-resources": func(c *Config, s string) (err error) {
+		c.FitResources, err = ParseResourceNames(s)
+		return
+	},
+	"safety-margin": func(c *Config, s string) (err error) {
+		c.SafetyMargins, err = ParseMargins(s)
+		return
+	},
+	"bin-packing": func(c *Config, s string) (err error) {
+		c.BinPacking, err = strconv.ParseBool(s)
+		return
+	},
+	"target-outage-timeout": func(c *Config, s string) (err error) {
+		c.TargetOutageTimeout, err = time.ParseDuration(s)
+		return
+	},
+	"target-policy": func(c *Config, s string) (err error) {
+		c.TargetPolicy, err = ParseTargetPolicy(s)
+		return
+	},
+	"free-gpu-weight": func(c *Config, s string) (err error) {
+		c.FreeGPUWeight, err = strconv.ParseFloat(s, 64)
+		return
+	},
+	"placement-scorer": func(c *Config, s string) error {
+		c.PlacementScorer = s
+		return nil
+	},
+	"policy-dry-run": func(c *Config, s string) (err error) {
+		c.PolicyDryRun, err = strconv.ParseBool(s)
+		return
+	},
+}
+
+// Apply settings by flag name to config
+func ApplySettings(config *Config, data map[string]string) error {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		apply, ok := liveSettings[key]
+		if !ok {
+			return fmt.Errorf("setting %s cannot be changed at runtime", key)
+		}
+		if err := apply(config, data[key]); err != nil {
+			return fmt.Errorf("invalid value for setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Map the watched ConfigMap to the "*/config" request
+func (r *AppWrapperReconciler) configMapFunc(ctx context.Context, obj client.Object) []reconcile.Request {
+	if client.ObjectKeyFromObject(obj) != r.Config.ConfigMap {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "*", Name: configRequestName}}}
+}
+
+// Reload settings from the watched ConfigMap, caller must hold mutex
+func (r *AppWrapperReconciler) reloadConfig(ctx context.Context) error {
+	configMap := &v1.ConfigMap{}
+	if err := r.Get(ctx, r.Config.ConfigMap, configMap); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	config := r.baseConfig
+	if err := ApplySettings(&config, configMap.Data); err != nil {
+		mcadLog.Error(err, "Invalid configuration, keeping current settings", "configmap", r.Config.ConfigMap.String())
+		return nil
+	}
+	if reflect.DeepEqual(config, r.Config) {
+		return nil
+	}
+	r.Config = config
+	mcadLog.Info("Configuration reloaded", "configmap", r.Config.ConfigMap.String(), "settings", configMap.Data)
+	r.triggerDispatch() // re-evaluate the queue with the new settings
+	return nil
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Prometheus metrics exported by MCAD on the controller-runtime metrics endpoint
+
+var (
+	allocatedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_namespace_allocated_resources",
+		Help: "Resources allocated to dispatched AppWrappers per namespace",
+	}, []string{"namespace", "resource"})
+
+	userAllocatedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_user_allocated_resources",
+		Help: "Resources allocated to dispatched AppWrappers per recorded submitter",
+	}, []string{"user", "resource"})
+
+	fairShareResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_namespace_fair_share_resources",
+		Help: "Fair share of cluster capacity per active namespace",
+	}, []string{"namespace", "resource"})
+
+	queuedAppWrappers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_queued_appwrappers",
+		Help: "Queued AppWrappers per namespace, priority, and queue",
+	}, []string{"namespace", "priority", "queue"})
+
+	queuedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_queued_resources",
+		Help: "Resources requested by queued AppWrappers per namespace, priority, and queue",
+	}, []string{"namespace", "priority", "queue", "resource"})
+
+	runningResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_running_resources",
+		Help: "Resources allocated to dispatched AppWrappers per namespace, priority, and queue",
+	}, []string{"namespace", "priority", "queue", "resource"})
+
+	queueSLOViolations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcad_queue_slo_violations_total",
+		Help: "AppWrappers queued for longer than their maximum queue time per namespace and queue",
+	}, []string{"namespace", "queue"})
+
+	targetCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_target_capacity_resources",
+		Help: "Capacity available to MCAD per dispatch target, empty target for the local cluster",
+	}, []string{"target", "resource"})
+
+	targetHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_target_healthy",
+		Help: "Whether each remote dispatch target is reachable and has ready nodes",
+	}, []string{"target"})
+
+	aggregateCapacity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_aggregate_capacity_resources",
+		Help: "Capacity available to MCAD across the local cluster and all dispatch targets",
+	}, []string{"resource"})
+
+	dispatchWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcad_dispatch_wait_seconds",
+		Help:    "Time spent queued before dispatch per namespace and priority",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10),
+	}, []string{"namespace", "priority"})
+
+	cacheChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcad_cache_checks_total",
+		Help: "Consistency checks of the AppWrapper phase cache per outcome",
+	}, []string{"outcome"})
+
+	cacheConflictSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mcad_cache_conflict_seconds",
+		Help:    "Duration of conflicts between the reconciler cache and the AppWrapper phase cache",
+		Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+	})
+
+	cacheEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mcad_cache_entries",
+		Help: "AppWrappers in the AppWrapper phase cache",
+	})
+
+	dispatchTriggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcad_dispatch_triggers_total",
+		Help: "Dispatch triggers per outcome: sent, coalesced with a pending trigger, deferred while the event channel was full, or dropped by fault injection",
+	}, []string{"outcome"})
+
+	resourceDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcad_resource_deletions_total",
+		Help: "Deletion requests for wrapped resources per kind and outcome",
+	}, []string{"kind", "outcome"})
+
+	orphanedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_orphaned_resources",
+		Help: "Leaked resources found by the last orphan sweep per kind, namespace, and reason",
+	}, []string{"kind", "namespace", "reason"})
+
+	resyncAnomalies = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcad_resync_anomalies",
+		Help: "AppWrappers flagged by the last periodic resync per anomaly",
+	}, []string{"anomaly"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(allocatedResources, userAllocatedResources, fairShareResources, queuedAppWrappers, queuedResources,
+		runningResources, queueSLOViolations, targetCapacity, targetHealthy, aggregateCapacity, dispatchWaitSeconds,
+		cacheChecks, cacheConflictSeconds, cacheEntries, dispatchTriggers, resourceDeletions, orphanedResources,
+		resyncAnomalies)
+}
+
+// Labels of queue metrics
+type queueKey struct {
+	namespace string
+	priority  string
+	queue     string
+}
+
+// Update queued and running gauges per namespace, priority, and queue
+func updateQueueMetrics(allocations []mcadv1beta1.AllocationStatus, queue []*mcadv1beta1.AppWrapper) {
+	running := map[queueKey]Weights{}
+	for _, allocation := range allocations {
+		key := queueKey{allocation.Namespace, strconv.Itoa(int(allocation.Priority)), allocation.Queue}
+		if running[key] == nil {
+			running[key] = Weights{}
+		}
+		running[key].Add(NewWeights(allocation.Allocated))
+	}
+	counts := map[queueKey]int{}
+	queued := map[queueKey]Weights{}
+	for _, appWrapper := range queue {
+		key := queueKey{appWrapper.Namespace, strconv.Itoa(int(appWrapper.Spec.Priority)), appWrapper.Labels[queueLabel]}
+		if queued[key] == nil {
+			queued[key] = Weights{}
+		}
+		counts[key]++
+		queued[key].Add(aggregateRequests(appWrapper))
+	}
+	queuedAppWrappers.Reset()
+	queuedResources.Reset()
+	runningResources.Reset()
+	for key, count := range counts {
+		queuedAppWrappers.WithLabelValues(key.namespace, key.priority, key.queue).Set(float64(count))
+	}
+	for key, weights := range queued {
+		for k, v := range weights.AsResources() {
+			queuedResources.WithLabelValues(key.namespace, key.priority, key.queue, string(k)).Set(v.AsApproximateFloat64())
+		}
+	}
+	for key, weights := range running {
+		for k, v := range weights.AsResources() {
+			runningResources.WithLabelValues(key.namespace, key.priority, key.queue, string(k)).Set(v.AsApproximateFloat64())
+		}
+	}
+}
+
+// Update capacity gauges of one dispatch target
+func updateTargetMetrics(target string, capacity Weights) {
+	targetCapacity.DeletePartialMatch(prometheus.Labels{"target": target})
+	for k, v := range capacity.AsResources() {
+		targetCapacity.WithLabelValues(target, string(k)).Set(v.AsApproximateFloat64())
+	}
+}
+
+// Update aggregate capacity gauges
+func updateAggregateMetrics(capacity Weights) {
+	aggregateCapacity.Reset()
+	for k, v := range capacity.AsResources() {
+		aggregateCapacity.WithLabelValues(string(k)).Set(v.AsApproximateFloat64())
+	}
+}
+
+// Update health gauge of one dispatch target
+func updateTargetHealthMetric(target string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	targetHealthy.WithLabelValues(target).Set(value)
+}
+
+// Update orphan gauges from the last orphan sweep
+func updateOrphanMetrics(orphans []Orphan) {
+	orphanedResources.Reset()
+	for _, orphan := range orphans {
+		orphanedResources.WithLabelValues(orphan.Kind, orphan.Namespace, orphan.Reason).Inc()
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// A running AppWrapper is migrated when an operator annotates it or when its target is under maintenance
+// Migrating AppWrappers are checkpointed and requeued, then dispatched to a different target
+// Migrations do not count against the requeuing budget and the dispatch history is preserved
+
+const (
+	migrateAnnotation = "workload.codeflare.dev/migrate-to" // destination target requested by an operator, empty for any other target
+	migrationReason   = "Migration"                         // event reason for migrated AppWrappers
+	localTargetName   = "local"                             // name designating the local cluster as a migration destination
+)
+
+// Return the properties of the target with the given name if any
+func (r *AppWrapperReconciler) targetProperties(name string) (TargetProperties, bool) {
+	if name == localTarget || name == localTargetName {
+		return r.Config.LocalTarget, true
+	}
+	if target := r.lookupTarget(name); target != nil {
+		return target.TargetProperties, true
+	}
+	return TargetProperties{}, false
+}
+
+// Return a short description of a target for messages
+func targetDescription(name string) string {
+	if name == localTarget {
+		return "local cluster"
+	}
+	return "target " + name
+}
+
+// Check whether the AppWrapper may be dispatched to the target given a pending migration
+func migrationAllows(appWrapper *mcadv1beta1.AppWrapper, name string) bool {
+	migration := appWrapper.Status.Migration
+	if migration == nil {
+		return true
+	}
+	if name == migration.From {
+		return false
+	}
+	return migration.To == "" || migration.To == name || migration.To == localTargetName && name == localTarget
+}
+
+// Initiate the migration of a running AppWrapper if requested by an operator or if its target is under maintenance
+// Return true if the AppWrapper status was updated
+func (r *AppWrapperReconciler) migrateIfRequested(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, ctrl.Result, error) {
+	to, requested := appWrapper.Annotations[migrateAnnotation]
+	reason := ""
+	if requested {
+		// consume the request, patch metadata only as offloaded templates have been loaded
+		patch := client.MergeFromWithOptions(appWrapper.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		delete(appWrapper.Annotations, migrateAnnotation)
+		spec := appWrapper.Spec
+		if err := r.Patch(ctx, appWrapper, patch); err != nil {
+			return true, ctrl.Result{}, err
+		}
+		appWrapper.Spec = spec // the patched AppWrapper does not include loaded templates
+		if _, ok := r.targetProperties(to); to != "" && !ok {
+			r.Recorder.Event(appWrapper, v1.EventTypeWarning, migrationReason, "Ignoring migration request to unknown target "+to)
+			return false, ctrl.Result{}, nil
+		}
+		if to == appWrapper.Status.Target || to == localTargetName && appWrapper.Status.Target == localTarget {
+			r.Recorder.Event(appWrapper, v1.EventTypeWarning, migrationReason, "Ignoring migration request to current target")
+			return false, ctrl.Result{}, nil
+		}
+		reason = "migration requested"
+	} else if properties, ok := r.targetProperties(appWrapper.Status.Target); ok && properties.Maintenance {
+		reason = targetDescription(appWrapper.Status.Target) + " under maintenance"
+	} else {
+		return false, ctrl.Result{}, nil
+	}
+	log.FromContext(ctx).Info("Migrating", "from", appWrapper.Status.Target, "to", to, "reason", reason)
+	r.Recorder.Event(appWrapper, v1.EventTypeNormal, migrationReason, "Migrating AppWrapper from "+targetDescription(appWrapper.Status.Target)+": "+reason)
+	appWrapper.Status.Migration = &mcadv1beta1.MigrationStatus{From: appWrapper.Status.Target, To: to, Reason: reason, Timestamp: metav1.Now()}
+	appWrapper.Status.RequeueTimestamp = metav1.Now()
+	result, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, "migrating: "+reason)
+	return true, result, err
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// AppWrappers may wrap other AppWrappers
+// Child AppWrappers are queued and dispatched independently but cannot escape the scheduling policy of the parent:
+// they are created in the namespace of the parent, with the priority and queue of the parent
+// The status of the children rolls up into the status of the parent like the status of other known resource kinds
+// The children are attributed to the submitter of the parent for per-user limits and allocations
+// The parent should not request resources for its children to avoid double counting
+
+var appWrapperGroupKind = schema.GroupKind{Group: mcadv1beta1.GroupVersion.Group, Kind: "AppWrapper"}
+
+const parentUIDAnnotation = "workload.codeflare.dev/parent-uid" // UID of the parent of a wrapped AppWrapper
+
+// Propagate priority, queue, and namespace of parent AppWrapper to wrapped AppWrapper
+func inheritFromParent(parent *mcadv1beta1.AppWrapper, obj *unstructured.Unstructured) {
+	if obj.GroupVersionKind().GroupKind() != appWrapperGroupKind {
+		return
+	}
+	obj.SetNamespace(parent.Namespace)
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[namespaceLabel] = parent.Namespace
+	labels[nameLabel] = parent.Name
+	if queue, ok := parent.Labels[queueLabel]; ok {
+		labels[queueLabel] = queue
+	} else {
+		delete(labels, queueLabel)
+	}
+	obj.SetLabels(labels)
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[parentUIDAnnotation] = string(parent.UID)
+	obj.SetAnnotations(annotations)
+	_ = unstructured.SetNestedField(obj.Object, int64(parent.Spec.Priority), "spec", "priority")
+}
+
+// Return the parent of a wrapped AppWrapper, nil if none
+// The parent must match the recorded UID and wrap an AppWrapper with the name of the child
+// so that labels and annotations alone cannot attribute an AppWrapper to another parent
+func (r *AppWrapperReconciler) parentAppWrapper(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (*mcadv1beta1.AppWrapper, error) {
+	uid, ok := appWrapper.Annotations[parentUIDAnnotation]
+	name := appWrapper.Labels[nameLabel]
+	if !ok || name == "" || appWrapper.Labels[namespaceLabel] != appWrapper.Namespace {
+		return nil, nil
+	}
+	parent := &mcadv1beta1.AppWrapper{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: appWrapper.Namespace, Name: name}, parent); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if string(parent.UID) != uid {
+		return nil, nil
+	}
+	if err := r.loadTemplates(ctx, parent); err != nil {
+		return nil, err
+	}
+	objects, err := parseResources(parent)
+	if err != nil {
+		return nil, nil
+	}
+	for _, obj := range objects {
+		if obj.GetObjectKind().GroupVersionKind().GroupKind() == appWrapperGroupKind && obj.GetName() == appWrapper.Name {
+			return parent, nil
+		}
+	}
+	return nil, nil
+}
+
+// Derive status of a wrapped AppWrapper from its phase
+func appWrapperStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+	status := &ResourceStatus{Completable: true}
+	switch mcadv1beta1.AppWrapperPhase(phase) {
+	case mcadv1beta1.Running:
+		status.Ready = true
+	case mcadv1beta1.Succeeded:
+		status.Succeeded = true
+	case mcadv1beta1.Failed, mcadv1beta1.Rejected:
+		status.Failed = true
+		status.Message = "AppWrapper " + obj.GetName() + " failed"
+		if code, _, _ := unstructured.NestedString(obj.Object, "status", "failureReason"); code != "" {
+			status.Code = mcadv1beta1.FailureReason(code) // propagate reason code of nested AppWrapper
+		}
+		if transitions, _, _ := unstructured.NestedSlice(obj.Object, "status", "transitions"); len(transitions) > 0 {
+			if reason, _, _ := unstructured.NestedString(transitions[len(transitions)-1].(map[string]interface{}), "reason"); reason != "" {
+				status.Message += ": " + reason
+			}
+		}
+	}
+	return status
+}
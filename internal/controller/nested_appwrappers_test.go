@@ -0,0 +1,127 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestRecordSubmitterOfChild(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	parent := &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "parent", UID: "parent-uid"},
+		Spec: mcadv1beta1.AppWrapperSpec{
+			Resources: mcadv1beta1.AppWrapperResources{
+				GenericItems: []mcadv1beta1.GenericItem{{
+					GenericTemplate: runtime.RawExtension{
+						Raw: []byte(`{"apiVersion":"workload.codeflare.dev/v1beta1","kind":"AppWrapper","metadata":{"name":"child"}}`),
+					},
+				}},
+			},
+		},
+		Status: mcadv1beta1.AppWrapperStatus{Submitter: "alice"},
+	}
+	objects, err := parseResources(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &AppWrapperReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(parent).Build(),
+		Config: Config{RecordSubmitter: true},
+	}
+	child := func(name string, labels map[string]string, annotations map[string]string) *mcadv1beta1.AppWrapper {
+		annotations[mcadv1beta1.SubmitterAnnotation] = "system:serviceaccount:mcad-system:mcad-controller-manager"
+		return &mcadv1beta1.AppWrapper{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: name, Labels: labels, Annotations: annotations}}
+	}
+	for _, tc := range []struct {
+		name       string
+		appWrapper *mcadv1beta1.AppWrapper
+		submitter  string
+	}{
+		{"wrapped", child("child", objects[0].GetLabels(), objects[0].GetAnnotations()), "alice"},
+		{"wrong uid", child("child", objects[0].GetLabels(), map[string]string{parentUIDAnnotation: "other"}),
+			"system:serviceaccount:mcad-system:mcad-controller-manager"},
+		{"not wrapped", child("other", objects[0].GetLabels(), map[string]string{parentUIDAnnotation: "parent-uid"}),
+			"system:serviceaccount:mcad-system:mcad-controller-manager"},
+	} {
+		if err := r.recordSubmitter(context.Background(), tc.appWrapper); err != nil {
+			t.Fatal(err)
+		}
+		if tc.appWrapper.Status.Submitter != tc.submitter {
+			t.Errorf("%s: got %q, want %q", tc.name, tc.appWrapper.Status.Submitter, tc.submitter)
+		}
+	}
+}
+
+func TestRecordSubmitterOfGeneratedAppWrapper(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	set := &mcadv1beta1.AppWrapperSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "set", UID: "set-uid",
+			Annotations: map[string]string{mcadv1beta1.SubmitterAnnotation: "bob"}},
+		Spec: mcadv1beta1.AppWrapperSetSpec{Replicas: 2},
+	}
+	cronAppWrapper := &mcadv1beta1.CronAppWrapper{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "cron", UID: "cron-uid",
+			Annotations: map[string]string{mcadv1beta1.SubmitterAnnotation: "carol"}},
+	}
+	member, err := (&AppWrapperSetReconciler{Scheme: scheme}).newSetMember(set, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := (&CronAppWrapperReconciler{Scheme: scheme}).newRun(cronAppWrapper, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed := member.DeepCopy()
+	renamed.Name = "other"
+	impostor := member.DeepCopy()
+	impostor.OwnerReferences[0].UID = "other"
+	r := &AppWrapperReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(set, cronAppWrapper).Build(),
+		Config: Config{RecordSubmitter: true},
+	}
+	for _, tc := range []struct {
+		name       string
+		appWrapper *mcadv1beta1.AppWrapper
+		submitter  string
+	}{
+		{"set member", member, "bob"},
+		{"cron run", run, "carol"},
+		{"not generated", renamed, "system:serviceaccount:mcad-system:mcad-controller-manager"},
+		{"wrong uid", impostor, "system:serviceaccount:mcad-system:mcad-controller-manager"},
+	} {
+		// created by MCAD
+		tc.appWrapper.Annotations = map[string]string{mcadv1beta1.SubmitterAnnotation: "system:serviceaccount:mcad-system:mcad-controller-manager"}
+		if err := r.recordSubmitter(context.Background(), tc.appWrapper); err != nil {
+			t.Fatal(err)
+		}
+		if tc.appWrapper.Status.Submitter != tc.submitter {
+			t.Errorf("%s: got %q, want %q", tc.name, tc.appWrapper.Status.Submitter, tc.submitter)
+		}
+	}
+}
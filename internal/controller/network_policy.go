@@ -0,0 +1,47 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Name of the NetworkPolicy isolating the AppWrapper pods, distinct from the AppWrapper name to avoid user policies
+func networkPolicyName(appWrapper *mcadv1beta1.AppWrapper) string {
+	return appWrapper.Name + "-isolation"
+}
+
+// Generate NetworkPolicy isolating AppWrapper pods in the AppWrapper namespace
+// Traffic between AppWrapper pods is permitted as well as the configured egress
+func newNetworkPolicy(appWrapper *mcadv1beta1.AppWrapper) *networkingv1.NetworkPolicy {
+	labels := map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}
+	peers := []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: labels}}}
+	egress := []networkingv1.NetworkPolicyEgressRule{{To: peers}}
+	egress = append(egress, appWrapper.Spec.NetworkPolicy.Egress...)
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: networkPolicyName(appWrapper), Labels: labels},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: labels},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: peers}},
+			Egress:      egress,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+}
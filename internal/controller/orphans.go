@@ -0,0 +1,238 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The orphan sweeper periodically inventories the resources labeled as managed by MCAD on the local cluster
+// Resources whose AppWrapper no longer exists or holds no resources in its current phase are reported as orphans
+// Orphans are not deleted: completed AppWrappers deliberately retain their pods and resources
+// Resources whose deletion has been pending for longer than a sweep period are reported as blocked
+// The kinds of resources are taken from the current AppWrappers and remembered from earlier creations
+// Orphans found per kind and namespace are exported as metrics and served as JSON on the metrics endpoint
+
+const orphansPath = "/debug/mcad/orphans" // path of the orphan report on the metrics endpoint
+
+// Reasons for reporting leaked resources
+const (
+	orphanOwnerMissing = "owner_missing" // AppWrapper no longer exists
+	orphanResurrected  = "resurrected"   // AppWrapper is queued or was never dispatched, resource was recreated or never deleted
+	orphanBlocked      = "blocked"       // deletion pending for longer than a sweep period
+)
+
+// Leaked resource found by the orphan sweeper
+type Orphan struct {
+	// Kind of the resource
+	Kind string `json:"kind"`
+
+	// Namespace of the resource
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the resource
+	Name string `json:"name"`
+
+	// Namespace and name of the owning AppWrapper
+	AppWrapper string `json:"appwrapper"`
+
+	// Reason for reporting the resource
+	Reason string `json:"reason"`
+}
+
+// Result of the last orphan sweep
+type OrphanReport struct {
+	// Time of the sweep
+	Time time.Time `json:"time"`
+
+	// Leaked resources found
+	Orphans []Orphan `json:"orphans"`
+}
+
+// Kinds of resources to inventory and last orphan report
+type orphanSweeper struct {
+	mutex  sync.Mutex
+	kinds  map[schema.GroupVersionKind]bool
+	report OrphanReport
+}
+
+// Remember the kind of a created resource for later sweeps
+func (r *AppWrapperReconciler) rememberKind(obj client.Object) {
+	r.orphans.mutex.Lock()
+	defer r.orphans.mutex.Unlock()
+	if r.orphans.kinds == nil {
+		r.orphans.kinds = map[schema.GroupVersionKind]bool{}
+	}
+	r.orphans.kinds[obj.GetObjectKind().GroupVersionKind()] = true
+}
+
+// Sweep orphans periodically until the manager stops
+func (r *AppWrapperReconciler) sweepOrphans(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.Config.OrphanSweepPeriod):
+		}
+		if err := r.sweep(ctx); err != nil {
+			mcadLog.Error(err, "Orphan sweep error")
+		}
+	}
+}
+
+// Check whether an AppWrapper in the given phase and step holds no resources
+// Succeeded and failed AppWrappers may retain their resources and are never considered empty
+func holdsNoResources(phase mcadv1beta1.AppWrapperPhase, step mcadv1beta1.AppWrapperStep) bool {
+	switch phase {
+	case mcadv1beta1.Empty, mcadv1beta1.Admitting, mcadv1beta1.Rejected:
+		return true
+	case mcadv1beta1.Queued:
+		return step == mcadv1beta1.Idle // hibernated AppWrappers retain their resources
+	}
+	return false
+}
+
+// Inventory and report orphans
+func (r *AppWrapperReconciler) sweep(ctx context.Context) error {
+	start := time.Now()
+	reader := r.APIReader // do not start informers for arbitrary kinds
+	if reader == nil {
+		reader = r.Client
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers); err != nil {
+		return err
+	}
+	// collect kinds and determine which AppWrappers may hold resources
+	kinds := map[schema.GroupVersionKind]bool{{Version: "v1", Kind: "Pod"}: true}
+	owners := map[types.NamespacedName]bool{} // AppWrapper may hold resources
+	r.mutex.Lock()
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		phase, step := r.getCachedPhase(appWrapper)
+		owners[client.ObjectKeyFromObject(appWrapper)] = !holdsNoResources(phase, step) || !appWrapper.DeletionTimestamp.IsZero()
+		if objects, err := parseResources(appWrapper); err == nil {
+			for _, obj := range append(objects, generateResources(appWrapper, nil, nil)...) {
+				kinds[obj.GetObjectKind().GroupVersionKind()] = true
+			}
+		}
+	}
+	r.mutex.Unlock()
+	r.orphans.mutex.Lock()
+	for gvk := range r.orphans.kinds {
+		kinds[gvk] = true
+	}
+	r.orphans.mutex.Unlock()
+	// inventory resources labeled as managed by MCAD
+	report := OrphanReport{Time: time.Now(), Orphans: []Orphan{}}
+	for gvk := range kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := reader.List(ctx, list, client.HasLabels{namespaceLabel, nameLabel}); err != nil {
+			if !meta.IsNoMatchError(err) && !apierrors.IsNotFound(err) {
+				mcadLog.Error(err, "Orphan inventory error", "kind", gvk.String())
+			}
+			continue
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if obj.GetCreationTimestamp().Add(time.Second).After(start) {
+				continue // created after AppWrappers were listed, timestamps have a one-second granularity
+			}
+			owner := types.NamespacedName{Namespace: obj.GetLabels()[namespaceLabel], Name: obj.GetLabels()[nameLabel]}
+			holds, exists := owners[owner]
+			reason := ""
+			if timestamp := obj.GetDeletionTimestamp(); timestamp != nil {
+				if time.Since(timestamp.Time) > r.Config.OrphanSweepPeriod {
+					reason = orphanBlocked
+				}
+			} else if !exists {
+				reason = orphanOwnerMissing
+			} else if !holds {
+				reason = orphanResurrected
+			}
+			if reason == "" {
+				continue
+			}
+			report.Orphans = append(report.Orphans, Orphan{Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName(),
+				AppWrapper: owner.String(), Reason: reason})
+		}
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		a, b := report.Orphans[i], report.Orphans[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	updateOrphanMetrics(report.Orphans)
+	if len(report.Orphans) > 0 {
+		counts := map[string]int{}
+		for _, orphan := range report.Orphans {
+			counts[orphan.Kind+"/"+orphan.Namespace+"/"+orphan.Reason]++
+		}
+		mcadLog.Info("Orphans found", "counts", counts)
+	}
+	r.orphans.mutex.Lock()
+	r.orphans.report = report
+	r.orphans.mutex.Unlock()
+	return nil
+}
+
+// Serve the last orphan report as JSON
+func (r *AppWrapperReconciler) serveOrphans(w http.ResponseWriter, _ *http.Request) {
+	r.orphans.mutex.Lock()
+	report := r.orphans.report
+	r.orphans.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		mcadLog.Error(err, "Orphan report error")
+	}
+}
+
+// Count the outcome of the deletion of a wrapped resource
+func countDeletion(obj client.Object, err error) {
+	outcome := "requested"
+	if apierrors.IsNotFound(err) {
+		outcome = "not_found"
+	} else if err != nil {
+		outcome = "error"
+	}
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if _, ok := obj.(*v1.Pod); ok {
+		kind = "Pod"
+	}
+	resourceDeletions.WithLabelValues(kind, outcome).Inc()
+}
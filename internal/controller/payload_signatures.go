@@ -0,0 +1,134 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Admins may require every resource template to carry a signature verifiable against one of a set of public keys
+// Signatures are computed over the canonical JSON form of the template, i.e., compact JSON with sorted keys,
+// so they survive the reencoding of the template by the API server
+// ECDSA signatures are ASN.1-encoded signatures of the SHA-256 digest of the template as produced by cosign
+// RSA signatures are PKCS #1 v1.5 signatures of the SHA-256 digest, Ed25519 signatures sign the template itself
+// Unsigned templates and templates with invalid signatures are rejected when queued and never dispatched
+
+// Load PEM-encoded public keys from file
+func LoadPublicKeys(file string) ([]crypto.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	keys := []crypto.PublicKey{}
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key in %s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public key in %s", file)
+	}
+	return keys, nil
+}
+
+// Return canonical JSON form of template
+func canonicalJSON(raw []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber() // preserve numbers as written
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil { // maps are encoded with sorted keys
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
+
+// Check signature of payload against public key
+func verifySignature(key crypto.PublicKey, payload []byte, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	}
+	return false
+}
+
+// Verify the signatures of the resource templates of the AppWrapper
+func (r *AppWrapperReconciler) verifyPayloads(appWrapper *mcadv1beta1.AppWrapper) error {
+	if len(r.Config.PayloadKeys) == 0 {
+		return nil
+	}
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		resource := &appWrapper.Spec.Resources.GenericItems[i]
+		if resource.Signature == "" {
+			return errors.New("resource " + strconv.Itoa(i) + " is not signed")
+		}
+		signature, err := base64.StdEncoding.DecodeString(resource.Signature)
+		if err != nil {
+			return errors.New("resource " + strconv.Itoa(i) + " has a malformed signature")
+		}
+		raw, err := rawTemplate(resource)
+		if err != nil {
+			return err
+		}
+		payload, err := canonicalJSON(raw)
+		if err != nil {
+			return err
+		}
+		verified := false
+		for _, key := range r.Config.PayloadKeys {
+			if verifySignature(key, payload, signature) {
+				verified = true
+				break
+			}
+		}
+		if !verified {
+			return errors.New("resource " + strconv.Itoa(i) + " has an invalid signature")
+		}
+	}
+	return nil
+}
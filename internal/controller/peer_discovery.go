@@ -0,0 +1,115 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const (
+	hostfileKey  = "hostfile"  // ConfigMap key of the hostfile
+	hostfilePath = "/etc/mcad" // mount path of the hostfile in wrapped pods
+)
+
+// Name of the ConfigMap describing the peers of the AppWrapper pods
+func peersConfigMapName(appWrapper *mcadv1beta1.AppWrapper) string {
+	return appWrapper.Name + "-peers"
+}
+
+// Name of the headless Service covering the AppWrapper pods, distinct from the AppWrapper name to avoid user Services
+func peersServiceName(appWrapper *mcadv1beta1.AppWrapper) string {
+	return appWrapper.Name + "-peers"
+}
+
+// Generate headless Service covering the AppWrapper pods
+// Service name is used as the subdomain of the AppWrapper pods
+func newHeadlessService(appWrapper *mcadv1beta1.AppWrapper) *v1.Service {
+	labels := map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: peersServiceName(appWrapper), Labels: labels},
+		Spec: v1.ServiceSpec{
+			ClusterIP:                v1.ClusterIPNone,
+			Selector:                 labels,
+			PublishNotReadyAddresses: true, // peers must resolve before they are ready
+		},
+	}
+}
+
+// Generate ConfigMap with the service domain and the host names of the AppWrapper pods known in advance,
+// i.e., wrapped pods and pods of indexed jobs
+func newPeersConfigMap(appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) *v1.ConfigMap {
+	domain := peersServiceName(appWrapper) + "." + appWrapper.Namespace + ".svc"
+	hosts := []string{}
+	for _, obj := range objects {
+		u := obj.(*unstructured.Unstructured)
+		switch u.GroupVersionKind().GroupKind().String() {
+		case "Pod":
+			hostname, _, _ := unstructured.NestedString(u.Object, "spec", "hostname")
+			if hostname == "" {
+				hostname = u.GetName()
+			}
+			hosts = append(hosts, hostname+"."+domain)
+		case "Job.batch":
+			if mode, _, _ := unstructured.NestedString(u.Object, "spec", "completionMode"); mode != "Indexed" {
+				continue
+			}
+			completions, _, _ := unstructured.NestedInt64(u.Object, "spec", "completions")
+			for i := int64(0); i < completions; i++ {
+				hosts = append(hosts, u.GetName()+"-"+strconv.FormatInt(i, 10)+"."+domain)
+			}
+		}
+	}
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: peersConfigMapName(appWrapper),
+			Labels: map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}},
+		Data: map[string]string{
+			"MCAD_SERVICE_DOMAIN": domain,
+			"MCAD_HOSTS":          strings.Join(hosts, ","),
+			"MCAD_NUM_HOSTS":      strconv.Itoa(len(hosts)),
+			hostfileKey:           strings.Join(hosts, "\n") + "\n",
+		},
+	}
+}
+
+// Join pod template to the headless Service, expose peers as environment variables and hostfile
+func injectPeerDiscovery(appWrapper *mcadv1beta1.AppWrapper, obj *unstructured.Unstructured, t *podTemplate) {
+	spec := t.spec
+	spec["subdomain"] = peersServiceName(appWrapper)
+	if _, ok := spec["hostname"]; !ok && t.parent == nil {
+		spec["hostname"] = obj.GetName() // wrapped pod
+	}
+	name := peersConfigMapName(appWrapper)
+	appendUnique(spec, "volumes", map[string]interface{}{
+		"name":      name,
+		"configMap": map[string]interface{}{"name": name, "items": []interface{}{map[string]interface{}{"key": hostfileKey, "path": hostfileKey}}},
+	})
+	containers, _ := spec["containers"].([]interface{})
+	for _, container := range containers {
+		if container, ok := container.(map[string]interface{}); ok {
+			appendUnique(container, "envFrom", map[string]interface{}{"configMapRef": map[string]interface{}{"name": name}})
+			appendUnique(container, "volumeMounts", map[string]interface{}{"name": name, "mountPath": hostfilePath, "readOnly": true})
+		}
+	}
+}
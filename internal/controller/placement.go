@@ -0,0 +1,252 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// TargetPolicy orders the dispatch targets eligible for an AppWrapper with equal preference scores
+type TargetPolicy string
+
+const (
+	// Target with the most free GPUs first
+	MostFreeGPUs TargetPolicy = "MostFreeGPUs"
+
+	// Cheapest target first
+	LowestCost TargetPolicy = "LowestCost"
+
+	// Targets with a data location label matching the AppWrapper data location label first
+	DataLocality TargetPolicy = "DataLocality"
+
+	// Rotate through targets
+	RoundRobinTargets TargetPolicy = "RoundRobin"
+)
+
+const (
+	localTarget       = ""                                     // name of the local cluster
+	dataLocationLabel = "workload.codeflare.dev/data-location" // data location label for AppWrappers and targets
+)
+
+// Parse target policy name
+func ParseTargetPolicy(s string) (TargetPolicy, error) {
+	switch p := TargetPolicy(s); p {
+	case MostFreeGPUs, LowestCost, DataLocality, RoundRobinTargets:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid target policy %q", s)
+}
+
+// Candidate dispatch target
+type candidate struct {
+	name       string
+	properties TargetProperties
+	client     client.Reader
+	available  map[int]Weights      // available capacity at each priority level
+	nodes      map[string]*NodeInfo // schedulable nodes
+	usage      map[string]Weights   // resources allocated to each namespace
+	rank       int                  // position in configuration order
+}
+
+// Check whether the target is available and satisfies the AppWrapper cluster selector and pending migration if any
+func isEligible(appWrapper *mcadv1beta1.AppWrapper, c *candidate) bool {
+	return ineligibility(appWrapper, c) == ""
+}
+
+// Return the reason the target is not eligible for the AppWrapper, "" if eligible
+func ineligibility(appWrapper *mcadv1beta1.AppWrapper, c *candidate) string {
+	if c.properties.Maintenance {
+		return "under maintenance"
+	}
+	if !migrationAllows(appWrapper, c.name) {
+		return "excluded by migration"
+	}
+	if appWrapper.Spec.Clusters != nil && !matchesLabels(c.properties.Labels, appWrapper.Spec.Clusters.Selector) {
+		return "not matching cluster selector"
+	}
+	return ""
+}
+
+// Check whether labels include all selector entries
+func matchesLabels(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Sum the weights of the AppWrapper cluster preferences matched by the target
+func preferenceScore(appWrapper *mcadv1beta1.AppWrapper, properties TargetProperties) int32 {
+	score := int32(0)
+	if appWrapper.Spec.Clusters != nil {
+		for _, preference := range appWrapper.Spec.Clusters.Preferences {
+			if matchesLabels(properties.Labels, preference.MatchLabels) {
+				score += preference.Weight
+			}
+		}
+	}
+	return score
+}
+
+// Score modifiers of a dispatch target combined with AppWrapper cluster preferences and free capacity
+type ScoreModifiers struct {
+	// Preference tier, each tier adds 100 points
+	Tier int32 `json:"tier,omitempty"`
+
+	// Price of one GPU, the price of the requested GPUs is subtracted from the score
+	GPUPrice float64 `json:"gpuPrice,omitempty"`
+
+	// Points subtracted per requested GPU on power-constrained targets
+	PowerPenalty float64 `json:"powerPenalty,omitempty"`
+}
+
+const tierPoints = 100 // points per preference tier
+
+// Compute the placement score of the target for the AppWrapper
+// The score sums the matched cluster preferences, the target tier, and free GPUs weighted according to configuration,
+// minus the price of the requested GPUs and the power penalty
+func (r *AppWrapperReconciler) placementScore(appWrapper *mcadv1beta1.AppWrapper, request Weights, c *candidate) float64 {
+	gpus := request.Float64(nvidiaGpu)
+	free := c.available[int(appWrapper.Spec.Priority)].Float64(nvidiaGpu)
+	modifiers := c.properties.Scoring
+	return float64(preferenceScore(appWrapper, c.properties)) + float64(modifiers.Tier*tierPoints) + r.Config.FreeGPUWeight*free -
+		(modifiers.GPUPrice+modifiers.PowerPenalty)*gpus
+}
+
+// Order candidates with a quota for the AppWrapper namespace first, then by decreasing placement score,
+// then according to target policy, configuration order is the last resort
+func (r *AppWrapperReconciler) sortCandidates(appWrapper *mcadv1beta1.AppWrapper, candidates []*candidate, scores map[*candidate]float64) {
+	priority := int(appWrapper.Spec.Priority)
+	location, hasLocation := appWrapper.Labels[dataLocationLabel]
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if qi, qj := ci.quota(appWrapper.Namespace) != nil, cj.quota(appWrapper.Namespace) != nil; qi != qj {
+			return qi
+		}
+		if scores[ci] != scores[cj] {
+			return scores[ci] > scores[cj]
+		}
+		switch r.Config.TargetPolicy {
+		case LowestCost:
+			if ci.properties.Cost != cj.properties.Cost {
+				return ci.properties.Cost < cj.properties.Cost
+			}
+		case DataLocality:
+			mi := hasLocation && ci.properties.Labels[dataLocationLabel] == location
+			mj := hasLocation && cj.properties.Labels[dataLocationLabel] == location
+			if mi != mj {
+				return mi
+			}
+		case RoundRobinTargets:
+			// targets after the last selected target first
+			ai, aj := ci.rank > r.lastTarget, cj.rank > r.lastTarget
+			if ai != aj {
+				return ai
+			}
+			return ci.rank < cj.rank
+		}
+		if c := ci.available[priority].Cmp(cj.available[priority], nvidiaGpu); c != 0 {
+			return c > 0
+		}
+		return ci.rank < cj.rank
+	})
+}
+
+// Compute the request of the AppWrapper against the available capacity of a candidate
+// GPU quotas only apply to the local cluster and not to quota-exempt AppWrappers
+func (r *AppWrapperReconciler) chargedRequest(appWrapper *mcadv1beta1.AppWrapper, request Weights, c *candidate) Weights {
+	if c.name != localTarget {
+		return request
+	}
+	if r.isQuotaExempt(appWrapper) {
+		return r.fitRequest(r.exemptGPUQuotas(request))
+	}
+	return r.fitRequest(r.chargeGPUQuotas(appWrapper, request))
+}
+
+// Select a dispatch target for the AppWrapper among the candidates satisfying its cluster selector and namespace quotas
+// Targets without a quota for the namespace are only eligible if every quota for the namespace permits spillover
+// Return false if the AppWrapper does not fit any candidate
+// Also return the placement score of every candidate if there are several candidates
+func (r *AppWrapperReconciler) selectTarget(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, request Weights, candidates []*candidate) (string, []mcadv1beta1.PlacementScore, bool) {
+	restricted := false
+	for _, c := range candidates {
+		if quota := c.quota(appWrapper.Namespace); quota != nil && !quota.Spillover && !r.isQuotaExempt(appWrapper) {
+			restricted = true
+		}
+	}
+	scores := map[*candidate]float64{}
+	reasons := map[*candidate]string{}
+	eligible := []*candidate{}
+	for _, c := range candidates {
+		scores[c] = r.placementScore(appWrapper, request, c)
+		if reason := ineligibility(appWrapper, c); reason != "" {
+			reasons[c] = reason
+		} else if restricted && c.quota(appWrapper.Namespace) == nil {
+			reasons[c] = "no quota for namespace"
+		} else if !r.fitsTargetQuota(appWrapper, request, c) {
+			reasons[c] = "quota exhausted"
+		} else {
+			eligible = append(eligible, c)
+		}
+	}
+	if len(eligible) > 1 {
+		if r.Config.PlacementScorer != "" {
+			if err := r.externalScores(ctx, appWrapper, request, eligible, scores); err != nil {
+				log.FromContext(withAppWrapper(ctx, appWrapper)).Error(err, "Placement scorer error")
+			}
+		}
+		r.sortCandidates(appWrapper, eligible, scores)
+	}
+	selected := ""
+	found := false
+	for _, c := range eligible {
+		if found {
+			reasons[c] = "lower rank"
+		} else if r.chargedRequest(appWrapper, request, c).Fits(c.available[int(appWrapper.Spec.Priority)]) && r.fitsNodes(ctx, appWrapper, request, c.client, c.nodes) {
+			if len(candidates) > 1 {
+				log.FromContext(withAppWrapper(ctx, appWrapper)).Info("Selected target", "target", c.name)
+			}
+			r.lastTarget = c.rank
+			selected, found = c.name, true
+		} else {
+			reasons[c] = "insufficient capacity"
+		}
+	}
+	if !found || len(candidates) == 1 {
+		return selected, nil, found
+	}
+	// report eligible candidates in order of preference first
+	report := []mcadv1beta1.PlacementScore{}
+	for _, c := range append(eligible, candidates...) {
+		if _, ok := scores[c]; ok {
+			report = append(report, mcadv1beta1.PlacementScore{Target: c.name, Score: strconv.FormatFloat(scores[c], 'f', -1, 64), Reason: reasons[c]})
+			delete(scores, c)
+		}
+	}
+	return selected, report, true
+}
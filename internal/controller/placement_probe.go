@@ -0,0 +1,148 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const probeLabel = "workload.codeflare.dev/probe" // label for placement probe pods
+
+// Generate pause pods with the same requests and scheduling constraints as the wrapped pods
+func (r *AppWrapperReconciler) newProbePods(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) ([]*v1.Pod, error) {
+	objects, err := parseResources(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.injectPodTemplates(ctx, appWrapper, objects); err != nil {
+		return nil, err
+	}
+	pods := []*v1.Pod{}
+	for _, obj := range objects {
+		var walkErr error
+		walkPodTemplates(obj.(*unstructured.Unstructured).UnstructuredContent(), nil, nil, func(t *podTemplate) {
+			spec := v1.PodSpec{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(t.spec, &spec); err != nil {
+				walkErr = err
+				return
+			}
+			containers := []v1.Container{}
+			for i, container := range spec.Containers {
+				containers = append(containers, v1.Container{Name: "pause-" + strconv.Itoa(i), Image: pauseImage, Resources: container.Resources})
+			}
+			for n := expectedPods(t); n > 0; n-- {
+				pods = append(pods, &v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: appWrapper.Namespace,
+						Name:      appWrapper.Name + "-probe-" + strconv.Itoa(len(pods)),
+						Labels: map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name,
+							auxiliaryLabel: "true", probeLabel: "true"},
+					},
+					Spec: v1.PodSpec{
+						Containers:        containers,
+						NodeSelector:      spec.NodeSelector,
+						Affinity:          spec.Affinity,
+						Tolerations:       spec.Tolerations,
+						PriorityClassName: spec.PriorityClassName,
+						SchedulerName:     spec.SchedulerName,
+						ImagePullSecrets:  spec.ImagePullSecrets,
+					},
+				})
+			}
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+	return pods, nil
+}
+
+// Create probe pods if missing and check their placement
+// Return true once all probe pods are scheduled or a reason if some probe pod cannot be scheduled
+// Probe pods are deleted once the outcome is known
+func (r *AppWrapperReconciler) probePlacement(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, string, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil {
+		return false, "", err
+	}
+	if c == nil {
+		return true, "", nil // probes require direct access to the target
+	}
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(appWrapper.Namespace),
+		client.MatchingLabels{nameLabel: appWrapper.Name, probeLabel: "true"}); err != nil {
+		return false, "", err
+	}
+	if len(pods.Items) == 0 {
+		probes, err := r.newProbePods(ctx, appWrapper)
+		if err != nil {
+			return false, "", err
+		}
+		for _, pod := range probes {
+			if err := c.Create(ctx, pod); err != nil && !apierrors.IsAlreadyExists(err) {
+				return false, "", err
+			}
+		}
+		log.FromContext(ctx).Info("Probing placement", "pods", len(probes))
+		return len(probes) == 0, "", nil
+	}
+	reason := ""
+	placed := true
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" {
+			placed = false
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+					reason = "probe pod " + pod.Name + " is unschedulable: " + condition.Message
+				}
+			}
+		}
+	}
+	// give up waiting after the initial waiting time
+	if !placed && reason == "" &&
+		metav1.Now().After(appWrapper.Status.DispatchTimestamp.Add(time.Duration(appWrapper.Spec.Scheduling.Requeuing.TimeInSeconds)*time.Second)) {
+		reason = "probe pods were not scheduled in time"
+	}
+	if placed || reason != "" {
+		if err := r.deleteProbes(ctx, appWrapper); err != nil {
+			return false, "", err
+		}
+	}
+	return placed, reason, nil
+}
+
+// Delete probe pods
+func (r *AppWrapperReconciler) deleteProbes(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	c, err := r.targetClient(appWrapper)
+	if err != nil || c == nil {
+		return err
+	}
+	return c.DeleteAllOf(ctx, &v1.Pod{}, client.InNamespace(appWrapper.Namespace),
+		client.MatchingLabels{nameLabel: appWrapper.Name, probeLabel: "true"}, client.GracePeriodSeconds(0))
+}
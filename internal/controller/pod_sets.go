@@ -0,0 +1,130 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// A pod set is the set of pods created from one pod template of a wrapped resource
+
+const podSetLabel = "workload.codeflare.dev/podset" // pod set label for wrapped pods
+
+// Name pod set using the name of the wrapped resource and the path to the template
+// For example, the worker template of PyTorchJob "job" produces pod set "job-worker"
+// A pod set label already specified in the template takes precedence
+func podSetName(obj *unstructured.Unstructured, t *podTemplate) string {
+	if labels, ok := t.metadata["labels"].(map[string]interface{}); ok {
+		if name, ok := labels[podSetLabel].(string); ok {
+			return name
+		}
+	}
+	segments := []string{obj.GetName()}
+	for i, segment := range t.path {
+		if segment == "spec" || segment == "template" || strings.HasSuffix(segment, "Specs") {
+			continue
+		}
+		if i == len(t.path)-2 && t.parent != nil {
+			if groupName, ok := t.parent["groupName"].(string); ok {
+				segment = groupName // e.g. RayCluster worker group
+			}
+		}
+		segments = append(segments, strings.ToLower(strings.TrimSuffix(segment, "Spec")))
+	}
+	name := strings.Join(segments, "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-.") // label values are limited to 63 characters
+	}
+	return name
+}
+
+// Expected number of pods for a pod template, i.e., replicas or parallelism of the parent map
+func expectedPods(t *podTemplate) int32 {
+	for _, field := range []string{"replicas", "parallelism"} {
+		if n, ok, _ := unstructured.NestedInt64(t.parent, field); ok {
+			return int32(n)
+		}
+	}
+	return 1
+}
+
+// Apply function to the pod sets of wrapped resources in template order
+func forEachPodSet(appWrapper *mcadv1beta1.AppWrapper, f func(resource *mcadv1beta1.GenericItem, podSet mcadv1beta1.PodSetStatus)) {
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		resource := &appWrapper.Spec.Resources.GenericItems[i]
+		obj, err := parseResource(appWrapper, resource)
+		if err != nil {
+			continue
+		}
+		templates := []*podTemplate{}
+		walkPodTemplates(obj.UnstructuredContent(), nil, nil, func(t *podTemplate) { templates = append(templates, t) })
+		for _, t := range sortTemplates(templates) {
+			f(resource, mcadv1beta1.PodSetStatus{Name: podSetName(obj, t), Expected: expectedPods(t)})
+		}
+	}
+}
+
+// List pod sets of wrapped resources in template order
+func listPodSets(appWrapper *mcadv1beta1.AppWrapper) []mcadv1beta1.PodSetStatus {
+	var podSets []mcadv1beta1.PodSetStatus // nil if empty to match omitted status field
+	forEachPodSet(appWrapper, func(_ *mcadv1beta1.GenericItem, podSet mcadv1beta1.PodSetStatus) {
+		podSets = append(podSets, podSet)
+	})
+	return podSets
+}
+
+// Count running pods and succeeded pods except for pod sets that ignore succeeded pods
+func healthyPods(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts) int {
+	healthy := counts.Running + counts.Succeeded
+	ignored := map[string]bool{} // do not subtract twice if pod set names collide
+	forEachPodSet(appWrapper, func(resource *mcadv1beta1.GenericItem, podSet mcadv1beta1.PodSetStatus) {
+		if c, ok := counts.PodSets[podSet.Name]; ok && resource.SucceededPods == mcadv1beta1.IgnoreSucceededPods && !ignored[podSet.Name] {
+			healthy -= int(c.Succeeded)
+			ignored[podSet.Name] = true
+		}
+	})
+	return healthy
+}
+
+// Sort pod templates by path since map iteration order is random
+func sortTemplates(templates []*podTemplate) []*podTemplate {
+	for i := 1; i < len(templates); i++ {
+		for j := i; j > 0 && strings.Join(templates[j].path, ".") < strings.Join(templates[j-1].path, "."); j-- {
+			templates[j], templates[j-1] = templates[j-1], templates[j]
+		}
+	}
+	return templates
+}
+
+// Combine pod set list with the pod counts for each pod set
+func podSetStatuses(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts) []mcadv1beta1.PodSetStatus {
+	podSets := listPodSets(appWrapper)
+	for i := range podSets {
+		if c, ok := counts.PodSets[podSets[i].Name]; ok {
+			podSets[i].Running = c.Running
+			podSets[i].Succeeded = c.Succeeded
+			podSets[i].Failed = c.Failed
+			podSets[i].Other = c.Other
+			podSets[i].Initializing = c.Initializing
+		}
+	}
+	return podSets
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Pod template embedded in a wrapped resource
+type podTemplate struct {
+	// Path to the template in the wrapped resource
+	path []string
+
+	// Map containing the template, nil if the wrapped resource is a pod
+	parent map[string]interface{}
+
+	// Template metadata
+	metadata map[string]interface{}
+
+	// Template spec
+	spec map[string]interface{}
+}
+
+// Apply function to every pod template embedded in map
+// A pod template is a map with a spec field containing a containers array, e.g., a Pod or a Deployment template
+// Metadata is created if missing
+func forEachPodTemplate(m map[string]interface{}, fn func(metadata map[string]interface{}, spec map[string]interface{})) {
+	walkPodTemplates(m, nil, nil, func(t *podTemplate) { fn(t.metadata, t.spec) })
+}
+
+// Apply function to every pod template embedded in map m at the given path in parent map
+func walkPodTemplates(m map[string]interface{}, path []string, parent map[string]interface{}, fn func(t *podTemplate)) {
+	if spec, ok := m["spec"].(map[string]interface{}); ok {
+		if _, ok := spec["containers"].([]interface{}); ok {
+			metadata, ok := m["metadata"].(map[string]interface{})
+			if !ok {
+				metadata = map[string]interface{}{}
+				m["metadata"] = metadata
+			}
+			fn(&podTemplate{path: path, parent: parent, metadata: metadata, spec: spec})
+			return // pod templates do not contain pod templates
+		}
+	}
+	for k, v := range m {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			walkPodTemplates(v, append(path[:len(path):len(path)], k), m, fn)
+		case []interface{}:
+			for i, e := range v {
+				if e, ok := e.(map[string]interface{}); ok {
+					walkPodTemplates(e, append(path[:len(path):len(path)], k, strconv.Itoa(i)), m, fn)
+				}
+			}
+		}
+	}
+}
+
+// Get nested map, creating maps along the path if necessary
+func nestedMap(m map[string]interface{}, fields ...string) map[string]interface{} {
+	for _, field := range fields {
+		n, ok := m[field].(map[string]interface{})
+		if !ok {
+			n = map[string]interface{}{}
+			m[field] = n
+		}
+		m = n
+	}
+	return m
+}
+
+// Set key in nested string map, creating the map if necessary
+func setNestedString(m map[string]interface{}, field string, key string, value string) {
+	nestedMap(m, field)[key] = value
+}
+
+// Inject AppWrapper-level settings into all pod templates of wrapped resources
+// Return the injected node selector
+func (r *AppWrapperReconciler) injectPodTemplates(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) (map[string]string, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	priorityClassName := ""
+	if r.Config.InjectPriorityClass && c != nil {
+		if priorityClassName, err = r.priorityClassFor(ctx, c, appWrapper); err != nil {
+			return nil, err
+		}
+	}
+	nodeSelector := map[string]string{}
+	constraints, err := r.getNodeConstraints(ctx, c, appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	if constraints != nil {
+		nodeSelector = constraints.nodeSelector
+	}
+	for _, obj := range objects {
+		labelResource(appWrapper, obj.(*unstructured.Unstructured))
+		injectPodTemplate(appWrapper, obj.(*unstructured.Unstructured), priorityClassName, nodeSelector)
+		r.injectProfiles(appWrapper, obj.(*unstructured.Unstructured))
+	}
+	return nodeSelector, nil
+}
+
+// Inject AppWrapper-level settings into all pod templates of one wrapped resource
+func injectPodTemplate(appWrapper *mcadv1beta1.AppWrapper, obj *unstructured.Unstructured, priorityClassName string, nodeSelector map[string]string) {
+	walkPodTemplates(obj.UnstructuredContent(), nil, nil, func(t *podTemplate) {
+		metadata, spec := t.metadata, t.spec
+		// label pods so MCAD can track them and tools can group them by scheduling context
+		for k, v := range schedulingLabels(appWrapper) {
+			setNestedString(metadata, "labels", k, v)
+		}
+		setNestedString(metadata, "labels", podSetLabel, podSetName(obj, t))
+		// override service account
+		if appWrapper.Spec.ServiceAccountName != "" {
+			spec["serviceAccountName"] = appWrapper.Spec.ServiceAccountName
+		}
+		// override scheduler
+		if appWrapper.Spec.SchedulerName != "" {
+			spec["schedulerName"] = appWrapper.Spec.SchedulerName
+		}
+		// add missing image pull secrets
+		for _, secret := range appWrapper.Spec.ImagePullSecrets {
+			appendUnique(spec, "imagePullSecrets", map[string]interface{}{"name": secret.Name})
+		}
+		// set priority class unless already specified
+		if _, ok := spec["priorityClassName"]; !ok && priorityClassName != "" {
+			spec["priorityClassName"] = priorityClassName
+		}
+		// add node selector entries
+		for k, v := range nodeSelector {
+			setNestedString(spec, "nodeSelector", k, v)
+		}
+		// add missing tolerations
+		for _, toleration := range appWrapper.Spec.Tolerations {
+			if u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&toleration); err == nil {
+				appendUnique(spec, "tolerations", u)
+			}
+		}
+		// point to checkpoint to restore from
+		injectCheckpoint(appWrapper, metadata, spec)
+		// join headless service
+		if appWrapper.Spec.PeerDiscovery {
+			injectPeerDiscovery(appWrapper, obj, t)
+		}
+		// add topology constraints
+		if placement := appWrapper.Spec.Placement; placement != nil {
+			selector := map[string]interface{}{"matchLabels": map[string]interface{}{
+				namespaceLabel: appWrapper.Namespace,
+				nameLabel:      appWrapper.Name,
+			}}
+			switch placement.Policy {
+			case mcadv1beta1.Spread:
+				appendUnique(spec, "topologySpreadConstraints", map[string]interface{}{
+					"maxSkew":           int64(1),
+					"topologyKey":       placement.TopologyKey,
+					"whenUnsatisfiable": "DoNotSchedule",
+					"labelSelector":     selector,
+				})
+			default:
+				appendUnique(nestedMap(spec, "affinity", "podAffinity"), "requiredDuringSchedulingIgnoredDuringExecution", map[string]interface{}{
+					"topologyKey":   placement.TopologyKey,
+					"labelSelector": selector,
+				})
+			}
+		}
+	})
+}
+
+// Find the PriorityClass with the highest value not exceeding the AppWrapper priority
+// Return the empty string if there is no such class
+func (r *AppWrapperReconciler) priorityClassFor(ctx context.Context, c client.Reader, appWrapper *mcadv1beta1.AppWrapper) (string, error) {
+	classes := &schedulingv1.PriorityClassList{}
+	if err := c.List(ctx, classes); err != nil {
+		return "", err
+	}
+	var best *schedulingv1.PriorityClass
+	for i, class := range classes.Items {
+		if class.Value > appWrapper.Spec.Priority {
+			continue
+		}
+		// break ties using names for determinism
+		if best == nil || class.Value > best.Value || class.Value == best.Value && class.Name < best.Name {
+			best = &classes.Items[i]
+		}
+	}
+	if best == nil {
+		return "", nil
+	}
+	return best.Name, nil
+}
+
+// Append element to nested array unless already present
+func appendUnique(m map[string]interface{}, field string, element interface{}) {
+	a, _ := m[field].([]interface{})
+	for _, e := range a {
+		if reflect.DeepEqual(e, element) {
+			return
+		}
+	}
+	m[field] = append(a, element)
+}
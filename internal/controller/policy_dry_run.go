@@ -0,0 +1,72 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Policy engines such as Kyverno or OPA Gatekeeper enforce their policies in admission webhooks
+// that also evaluate server-side dry-run requests
+// When a new AppWrapper is queued, MCAD renders its wrapped resources as it would at dispatch time
+// and submits them to the local cluster in dry-run mode
+// Resources denied by admission are reported right away in the PolicyCompliant condition and the AppWrapper is rejected
+// Resources of kinds unknown to the local cluster or in missing namespaces are not evaluated,
+// nor are webhooks with side effects as the API server refuses to call them in dry-run mode
+
+const policyCondition = "PolicyCompliant" // condition type for the outcome of the policy evaluation
+
+// Evaluate admission policies against the rendered wrapped resources of a new AppWrapper
+// Return the reason for rejecting the AppWrapper if any
+func (r *AppWrapperReconciler) evaluatePolicies(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (string, error) {
+	if !r.Config.PolicyDryRun {
+		return "", nil
+	}
+	objects, err := parseResources(appWrapper)
+	if err != nil {
+		return "", nil // reported at dispatch time
+	}
+	applyShrunk(appWrapper, objects)
+	if _, err := r.injectPodTemplates(ctx, appWrapper, objects); err != nil {
+		return "", err
+	}
+	for _, obj := range objects {
+		err := r.Create(ctx, obj, client.DryRunAll)
+		if err == nil || apierrors.IsAlreadyExists(err) || apierrors.IsNotFound(err) || meta.IsNoMatchError(err) ||
+			strings.Contains(err.Error(), "does not support dry run") { // webhooks with side effects cannot be evaluated
+			continue
+		}
+		if apierrors.IsForbidden(err) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			reason := obj.GetObjectKind().GroupVersionKind().Kind + " " + obj.GetName() + " violates policy: " + err.Error()
+			meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: policyCondition, Status: metav1.ConditionFalse,
+				Reason: "Rejected", Message: reason})
+			return reason, nil
+		}
+		return "", err
+	}
+	meta.SetStatusCondition(&appWrapper.Status.Conditions, metav1.Condition{Type: policyCondition, Status: metav1.ConditionTrue,
+		Reason: "DryRunSucceeded", Message: "Wrapped resources passed admission in dry-run mode"})
+	return "", nil
+}
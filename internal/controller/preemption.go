@@ -0,0 +1,309 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// With explicit preemption, AppWrappers are only dispatched to the local cluster if they fit its free capacity
+// A queued AppWrapper that only fits once lower-priority reservations are discounted requeues lower-priority
+// AppWrappers running on the local cluster and waits for their resources to be released
+// Elastic AppWrappers are shrunk before AppWrappers are requeued
+// AppWrappers dispatched within the protection period are never preempted to avoid thrashing
+// Only AppWrappers in strict priority bands may preempt
+// AppWrappers may opt out of preempting others or being preempted, or only permit preemption below a cost threshold
+// The release of the capacity of the victims is simulated first, the preemption is aborted if the preemptor
+// would still not fit the free capacity of the nodes satisfying its constraints
+
+const preemptionReason = "Preempted" // event reason for preempted AppWrappers
+
+// Return the lowest priority level
+func lowestPriority(requests map[int]Weights) int {
+	first := true
+	lowest := 0
+	for priority := range requests {
+		if first || priority < lowest {
+			lowest = priority
+			first = false
+		}
+	}
+	return lowest
+}
+
+// Compute the capacity available at every priority level when reservations at all priority levels are honored
+func freeCapacity(available map[int]Weights) map[int]Weights {
+	free := available[lowestPriority(available)]
+	capacity := map[int]Weights{}
+	for priority := range available {
+		capacity[priority] = free
+	}
+	return capacity
+}
+
+// Check whether running AppWrapper may not be preempted
+// because of its preemption policy or because it was dispatched too recently
+func (r *AppWrapperReconciler) isProtected(appWrapper *mcadv1beta1.AppWrapper) bool {
+	running := time.Since(appWrapper.Status.DispatchTimestamp.Time)
+	if running < r.Config.PreemptionProtection {
+		return true
+	}
+	switch appWrapper.Spec.Scheduling.Preemption.Preemptible {
+	case mcadv1beta1.NeverPreempt:
+		return true
+	case mcadv1beta1.CostBasedPreempt:
+		return running > time.Duration(appWrapper.Spec.Scheduling.Preemption.MaxCostInSeconds)*time.Second
+	default:
+		return false
+	}
+}
+
+// Capacity released by shrinking or requeuing a victim
+type preemptionPlan struct {
+	victim  *mcadv1beta1.AppWrapper
+	shrink  map[int]int32 // replica counts of shrunk elastic resources, victim is requeued if nil
+	release Weights
+}
+
+// Preempt lower-priority AppWrappers running on the local cluster to make room for the queued AppWrapper
+// Shrink elastic AppWrappers before requeuing AppWrappers
+// Available is the capacity of the local cluster at each priority level discounting lower-priority reservations
+// Return true if the AppWrapper is waiting for the capacity of victims to be released
+func (r *AppWrapperReconciler) preempt(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, request Weights,
+	c *candidate, available map[int]Weights) (bool, error) {
+	if appWrapper.Spec.Scheduling.Preemption.Preempt == mcadv1beta1.NeverPreempt ||
+		bandSemantics(r.Config.PriorityBands, appWrapper.Spec.Priority) != StrictBand || ineligibility(appWrapper, c) != "" || !r.fitsTargetQuota(appWrapper, request, c) ||
+		!request.Fits(available[int(appWrapper.Spec.Priority)]) {
+		return false, nil // preemption cannot help
+	}
+	free := Weights{} // copy free capacity before adding released capacity
+	free.Add(c.available[lowestPriority(c.available)])
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return false, err
+	}
+	releasing := []*preemptionPlan{}       // lower-priority AppWrappers already releasing their capacity
+	running := []*mcadv1beta1.AppWrapper{} // candidate victims
+	for i := range appWrappers.Items {
+		victim := &appWrappers.Items[i]
+		if victim.Status.Target != localTarget || victim.Spec.Priority >= appWrapper.Spec.Priority {
+			continue
+		}
+		phase, step := r.getCachedPhase(victim)
+		if phase == mcadv1beta1.Running && step == mcadv1beta1.Deleting {
+			releasing = append(releasing, &preemptionPlan{victim: victim})
+			free.Add(aggregateRequests(victim))
+		} else if phase == mcadv1beta1.Running && step == mcadv1beta1.Created {
+			if r.isProtected(victim) {
+				continue
+			}
+			running = append(running, victim)
+			if len(victim.Status.Shrunk) > 0 {
+				// pods of shrunk resources may still be terminating
+				pending, err := r.podRequest(ctx, victim)
+				if err != nil {
+					return false, err
+				}
+				shrunk := aggregateRequests(victim)
+				pending.Max(shrunk)
+				pending.Sub(shrunk)
+				free.Add(pending)
+			}
+		}
+	}
+	if request.Fits(free) {
+		return true, nil // wait for victims to release their capacity
+	}
+	// select victims in order of increasing priority and decreasing dispatch time
+	sort.Slice(running, func(i, j int) bool {
+		if running[i].Spec.Priority != running[j].Spec.Priority {
+			return running[i].Spec.Priority < running[j].Spec.Priority
+		}
+		return running[j].Status.DispatchTimestamp.Before(&running[i].Status.DispatchTimestamp)
+	})
+	plans := map[*mcadv1beta1.AppWrapper]*preemptionPlan{}
+	// shrink elastic AppWrappers first
+	for _, victim := range running {
+		if request.Fits(free) {
+			break
+		}
+		if shrink, release := shrinkage(victim); len(shrink) > 0 {
+			plans[victim] = &preemptionPlan{victim: victim, shrink: shrink, release: release}
+			free.Add(release)
+		}
+	}
+	// requeue AppWrappers next, including shrunk AppWrappers
+	for _, victim := range running {
+		if request.Fits(free) {
+			break
+		}
+		release := aggregateRequests(victim)
+		if plan, ok := plans[victim]; ok {
+			free.Sub(plan.release)
+		}
+		plans[victim] = &preemptionPlan{victim: victim, release: release}
+		free.Add(release)
+	}
+	ctx = withAppWrapper(ctx, appWrapper)
+	if !request.Fits(free) {
+		log.FromContext(ctx).Info("Preemption aborted", "reason", "insufficient preemptible capacity")
+		return false, nil
+	}
+	// do not shrink AppWrappers unnecessarily once others are requeued
+	selected := []*preemptionPlan{}
+	for i := len(running) - 1; i >= 0; i-- {
+		plan, ok := plans[running[i]]
+		if !ok {
+			continue
+		}
+		if plan.shrink != nil {
+			free.Sub(plan.release)
+			if request.Fits(free) {
+				continue
+			}
+			free.Add(plan.release)
+		}
+		selected = append([]*preemptionPlan{plan}, selected...)
+	}
+	// simulate the release of the capacity of the victims on each node
+	nodes, err := r.simulateRelease(ctx, c.nodes, append(releasing, selected...))
+	if err != nil {
+		return false, err
+	}
+	if !r.fitsNodes(ctx, appWrapper, request, c.client, nodes) {
+		log.FromContext(ctx).Info("Preemption aborted", "reason", "released capacity does not fit node constraints")
+		return false, nil
+	}
+	preemptor := appWrapper.Namespace + "/" + appWrapper.Name
+	shrunk := []string{}
+	requeued := []string{}
+	for _, plan := range selected {
+		victim := plan.victim.DeepCopy() // deep copy AppWrapper before mutating
+		ctx := withAppWrapper(ctx, victim)
+		if r.isStale(ctx, victim) {
+			continue
+		}
+		if plan.shrink != nil {
+			if err := r.shrink(ctx, victim, plan.shrink, preemptor); err != nil {
+				return false, err
+			}
+			r.Recorder.Event(victim, v1.EventTypeNormal, preemptionReason, "shrunk for "+preemptor)
+			log.FromContext(ctx).Info("Shrunk", "preemptor", preemptor)
+			shrunk = append(shrunk, victim.Namespace+"/"+victim.Name)
+			continue
+		}
+		message := "preempted by " + preemptor
+		victim.Status.RequeueTimestamp = metav1.Now()
+		phase := mcadv1beta1.Running
+		if requeuingsExhausted(victim) {
+			// fail victim with no requeuing left
+			phase = mcadv1beta1.Failed
+			victim.Status.FailureReason = mcadv1beta1.Preempted
+		}
+		if _, err := r.updateStatus(ctx, victim, phase, mcadv1beta1.Deleting, message); err != nil {
+			return false, err
+		}
+		r.Recorder.Event(victim, v1.EventTypeNormal, preemptionReason, message)
+		log.FromContext(ctx).Info("Preempted", "preemptor", preemptor)
+		requeued = append(requeued, victim.Namespace+"/"+victim.Name)
+	}
+	if err := r.recordPreemption(ctx, appWrapper, shrunk, requeued); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Return a copy of the nodes with the requests of the pods released by the victims added back to their free capacity
+// Shrinking is assumed to remove the most recently created pods of the shrunk resources
+func (r *AppWrapperReconciler) simulateRelease(ctx context.Context, targetNodes map[string]*NodeInfo,
+	plans []*preemptionPlan) (map[string]*NodeInfo, error) {
+	if targetNodes == nil {
+		return nil, nil // node-level capacity is not visible
+	}
+	nodes := map[string]*NodeInfo{}
+	for name, node := range targetNodes {
+		free := Weights{} // copy free capacity before adding released capacity
+		free.Add(node.Free)
+		nodes[name] = &NodeInfo{Labels: node.Labels, Taints: node.Taints, Free: free}
+	}
+	for _, plan := range plans {
+		pods := &v1.PodList{}
+		if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
+			client.MatchingLabels{namespaceLabel: plan.victim.Namespace, nameLabel: plan.victim.Name}); err != nil {
+			return nil, err
+		}
+		released := pods.Items
+		if plan.shrink != nil {
+			released = shrunkPods(plan.victim, plan.shrink, pods.Items, r.Config.TerminatingPods)
+		}
+		for _, pod := range released {
+			node, ok := nodes[pod.Spec.NodeName]
+			if !ok || !consumesResources(&pod, r.Config.TerminatingPods) {
+				continue
+			}
+			for _, container := range pod.Spec.Containers {
+				node.Free.Add(addGPUType(NewWeights(container.Resources.Requests), r.nodeGPUType(pod.Spec.NodeName)))
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// Select the pods removed by shrinking elastic resources, most recently created first
+func shrunkPods(appWrapper *mcadv1beta1.AppWrapper, shrink map[int]int32, pods []v1.Pod, policy TerminatingPodPolicy) []v1.Pod {
+	released := []v1.Pod{}
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		replicas, ok := shrink[i]
+		if !ok {
+			continue
+		}
+		current := appWrapper.Spec.Resources.GenericItems[i].CustomPodResources[0].Replicas
+		if n, ok := shrunkReplicas(appWrapper, i); ok {
+			current = n
+		}
+		podSets := map[string]bool{}
+		forEachPodSet(appWrapper, func(resource *mcadv1beta1.GenericItem, podSet mcadv1beta1.PodSetStatus) {
+			if resource == &appWrapper.Spec.Resources.GenericItems[i] {
+				podSets[podSet.Name] = true
+			}
+		})
+		candidates := []v1.Pod{}
+		for _, pod := range pods {
+			if podSets[pod.Labels[podSetLabel]] && consumesResources(&pod, policy) {
+				candidates = append(candidates, pod)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[j].CreationTimestamp.Before(&candidates[i].CreationTimestamp)
+		})
+		count := int(current - replicas)
+		if count > len(candidates) {
+			count = len(candidates)
+		}
+		released = append(released, candidates[:count]...)
+	}
+	return released
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Priority bands partition AppWrapper priorities into ranges with distinct dispatch semantics
+// AppWrappers in higher bands are always considered first
+// Strict bands are ordered by priority and may preempt lower-priority AppWrappers
+// Fair-share bands order AppWrappers by the dominant resource share allocated to their namespaces
+// Best-effort bands only backfill capacity left over by other bands and never preempt
+
+// BandSemantics is the dispatch semantics of a priority band
+type BandSemantics string
+
+const (
+	// Order by priority, may preempt
+	StrictBand BandSemantics = "Strict"
+
+	// Order by namespace dominant resource share, then priority
+	FairShareBand BandSemantics = "FairShare"
+
+	// Backfill by priority, never preempt
+	BestEffortBand BandSemantics = "BestEffort"
+)
+
+// Priority band
+type PriorityBand struct {
+	// Minimum priority of the band
+	MinPriority int32
+
+	// Dispatch semantics of the band
+	Semantics BandSemantics
+}
+
+// Parse priority bands listed by decreasing minimum priority, e.g., Strict=1000,FairShare=100,BestEffort
+// The last band has no minimum priority
+func ParsePriorityBands(s string) ([]PriorityBand, error) {
+	bands := []PriorityBand{}
+	entries := strings.Split(s, ",")
+	for i, entry := range entries {
+		semantics, value, found := strings.Cut(entry, "=")
+		band := PriorityBand{MinPriority: math.MinInt32, Semantics: BandSemantics(semantics)}
+		switch band.Semantics {
+		case StrictBand, FairShareBand, BestEffortBand:
+		default:
+			return nil, fmt.Errorf("invalid priority band semantics %q", semantics)
+		}
+		if found {
+			priority, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority band %q: %w", entry, err)
+			}
+			band.MinPriority = int32(priority)
+		} else if i != len(entries)-1 {
+			return nil, fmt.Errorf("missing minimum priority in priority band %q", entry)
+		}
+		if i > 0 && band.MinPriority >= bands[i-1].MinPriority {
+			return nil, fmt.Errorf("priority bands must be listed by decreasing minimum priority")
+		}
+		bands = append(bands, band)
+	}
+	bands[len(bands)-1].MinPriority = math.MinInt32 // last band covers all lower priorities
+	return bands, nil
+}
+
+// Return the index of the band of the given priority, zero if no bands are configured
+func bandIndex(bands []PriorityBand, priority int32) int {
+	for i, band := range bands {
+		if priority >= band.MinPriority {
+			return i
+		}
+	}
+	return 0
+}
+
+// Return the dispatch semantics for the given priority, strict if no bands are configured
+func bandSemantics(bands []PriorityBand, priority int32) BandSemantics {
+	if len(bands) == 0 {
+		return StrictBand
+	}
+	return bands[bandIndex(bands, priority)].Semantics
+}
+
+// Reorder queue sorted by priority according to priority bands, keeping expedited AppWrappers first
+func orderBands(queue []*mcadv1beta1.AppWrapper, bands []PriorityBand, allocations []mcadv1beta1.AllocationStatus, capacity Weights) {
+	if len(bands) == 0 {
+		return
+	}
+	// compute dominant resource share of each namespace
+	allocated := map[string]Weights{}
+	for _, allocation := range allocations {
+		if allocated[allocation.Namespace] == nil {
+			allocated[allocation.Namespace] = Weights{}
+		}
+		allocated[allocation.Namespace].Add(NewWeights(allocation.Allocated))
+	}
+	shares := map[string]float64{}
+	for namespace, weights := range allocated {
+		shares[namespace] = weights.DominantShare(capacity)
+	}
+	// stable sort preserves priority order within bands and among equal shares
+	sort.SliceStable(queue, func(i, j int) bool {
+		if expedited := queue[i].Status.ExpeditedBy != ""; expedited != (queue[j].Status.ExpeditedBy != "") {
+			return expedited
+		}
+		bi, bj := bandIndex(bands, queue[i].Spec.Priority), bandIndex(bands, queue[j].Spec.Priority)
+		if bi != bj {
+			return bi < bj
+		}
+		if bands[bi].Semantics == FairShareBand {
+			return shares[queue[i].Namespace] < shares[queue[j].Namespace]
+		}
+		return false
+	})
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const queueLabel = "workload.codeflare.dev/queue" // AppWrapper label naming the queue of the AppWrapper
+
+// Check whether the AppWrapper is exempt from queue limits, GPU quotas, and target quotas
+func (r *AppWrapperReconciler) isQuotaExempt(appWrapper *mcadv1beta1.AppWrapper) bool {
+	_, ok := appWrapper.Annotations[mcadv1beta1.QuotaExemptAnnotation]
+	return ok && r.Config.QuotaExemption
+}
+
+// Check whether a new AppWrapper may be queued given the queue length limits
+// Return the reason for rejecting the AppWrapper if any
+func (r *AppWrapperReconciler) checkQueueLimits(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (string, error) {
+	if r.isQuotaExempt(appWrapper) {
+		return "", nil
+	}
+	queue := appWrapper.Labels[queueLabel]
+	user := appWrapper.Status.Submitter
+	if r.Config.MaxQueuedPerNamespace <= 0 && (r.Config.MaxQueuedPerQueue <= 0 || queue == "") && (r.Config.MaxQueuedPerUser <= 0 || user == "") {
+		return "", nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return "", err
+	}
+	inNamespace := 0
+	inQueue := 0
+	byUser := 0
+	for _, other := range appWrappers.Items {
+		if phase, _ := r.getCachedPhase(&other); phase != mcadv1beta1.Queued {
+			continue
+		}
+		if other.Namespace == appWrapper.Namespace {
+			inNamespace++
+		}
+		if queue != "" && other.Labels[queueLabel] == queue {
+			inQueue++
+		}
+		if user != "" && other.Status.Submitter == user {
+			byUser++
+		}
+	}
+	if r.Config.MaxQueuedPerNamespace > 0 && inNamespace >= r.Config.MaxQueuedPerNamespace {
+		return "namespace " + appWrapper.Namespace + " has reached the limit of " + strconv.Itoa(r.Config.MaxQueuedPerNamespace) + " queued AppWrappers", nil
+	}
+	if r.Config.MaxQueuedPerQueue > 0 && queue != "" && inQueue >= r.Config.MaxQueuedPerQueue {
+		return "queue " + queue + " has reached the limit of " + strconv.Itoa(r.Config.MaxQueuedPerQueue) + " queued AppWrappers", nil
+	}
+	if r.Config.MaxQueuedPerUser > 0 && user != "" && byUser >= r.Config.MaxQueuedPerUser {
+		return "user " + user + " has reached the limit of " + strconv.Itoa(r.Config.MaxQueuedPerUser) + " queued AppWrappers", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const queueSLOCondition = "QueueSLOViolated" // condition type for AppWrappers queued for too long
+
+// Set or clear the queue SLO condition of a queued AppWrapper
+// Emit an event and increment the violation counter when the AppWrapper exceeds its maximum queue time
+// Requeue reconciliation to check again when the maximum queue time expires
+func (r *AppWrapperReconciler) checkQueueSLO(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (ctrl.Result, error) {
+	maxQueueTime := time.Duration(appWrapper.Spec.Scheduling.MaxQueueTimeInSeconds) * time.Second
+	if maxQueueTime <= 0 || appWrapper.Status.Step == mcadv1beta1.Hibernated {
+		return ctrl.Result{}, nil
+	}
+	// queuing starts at creation or last requeuing
+	since := appWrapper.CreationTimestamp
+	if since.Before(&appWrapper.Status.RequeueTimestamp) {
+		since = appWrapper.Status.RequeueTimestamp
+	}
+	remaining := time.Until(since.Add(maxQueueTime))
+	condition := metav1.Condition{Type: queueSLOCondition, Status: metav1.ConditionFalse, Reason: "WithinMaxQueueTime"}
+	if remaining <= 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "MaxQueueTimeExceeded"
+		condition.Message = fmt.Sprintf("AppWrapper has been queued for more than %v", maxQueueTime)
+	} else if !meta.IsStatusConditionTrue(appWrapper.Status.Conditions, queueSLOCondition) {
+		return ctrl.Result{RequeueAfter: remaining}, nil // only record condition once violated
+	}
+	if existing := meta.FindStatusCondition(appWrapper.Status.Conditions, queueSLOCondition); existing == nil ||
+		existing.Status != condition.Status || existing.Reason != condition.Reason {
+		meta.SetStatusCondition(&appWrapper.Status.Conditions, condition)
+		if err := r.saveStatus(ctx, appWrapper); err != nil {
+			return ctrl.Result{}, err
+		}
+		if condition.Status == metav1.ConditionTrue {
+			log.FromContext(ctx).Info("Queue SLO violated", "maxQueueTime", maxQueueTime)
+			r.Recorder.Event(appWrapper, v1.EventTypeWarning, queueSLOCondition, condition.Message)
+			queueSLOViolations.WithLabelValues(appWrapper.Namespace, appWrapper.Labels[queueLabel]).Inc()
+		}
+	}
+	if remaining <= 0 {
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: remaining}, nil
+}
+
+// Reset the queue SLO condition of an AppWrapper being dispatched, the status is updated by the caller
+func clearQueueSLO(appWrapper *mcadv1beta1.AppWrapper) {
+	if meta.IsStatusConditionTrue(appWrapper.Status.Conditions, queueSLOCondition) {
+		meta.SetStatusCondition(&appWrapper.Status.Conditions,
+			metav1.Condition{Type: queueSLOCondition, Status: metav1.ConditionFalse, Reason: "Dispatched"})
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Replay the dispatch policy offline against a snapshot of nodes, pods, and AppWrappers
+// Return the AppWrappers dispatched from the snapshot in dispatch order
+// The snapshot is loaded into an in-memory client and never written back to a cluster
+// Replays are deterministic unless using the Random tie breaker
+func Replay(ctx context.Context, scheme *runtime.Scheme, objects []client.Object, config Config) ([]*mcadv1beta1.AppWrapper, error) {
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objects...).
+		WithStatusSubresource(&mcadv1beta1.AppWrapper{}, &mcadv1beta1.ClusterInfo{}).
+		WithIndex(&v1.Pod{}, specNodeName, func(obj client.Object) []string {
+			return []string{obj.(*v1.Pod).Spec.NodeName}
+		}).
+		Build()
+	r := &AppWrapperReconciler{
+		Client: c,
+		Scheme: scheme,
+		Cache:  map[types.UID]*CachedAppWrapper{},
+		Config: config,
+	}
+	dispatched := []*mcadv1beta1.AppWrapper{}
+	for {
+		appWrapper, err := r.selectForDispatch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if appWrapper == nil {
+			return dispatched, nil
+		}
+		// reserve capacity without creating wrapped resources
+		appWrapper.Status.Phase = mcadv1beta1.Running
+		appWrapper.Status.Step = mcadv1beta1.Creating
+		appWrapper.Status.TransitionCount++
+		if err := r.Status().Update(ctx, appWrapper); err != nil {
+			return nil, err
+		}
+		r.addCachedPhase(appWrapper)
+		dispatched = append(dispatched, appWrapper)
+	}
+}
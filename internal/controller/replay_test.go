@@ -0,0 +1,75 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestReplay(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	cpus := v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node"},
+		Status: v1.NodeStatus{Capacity: cpus, Allocatable: cpus,
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}
+	queued := func(name string, priority int32, cpus string) *mcadv1beta1.AppWrapper {
+		return &mcadv1beta1.AppWrapper{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)},
+			Spec: mcadv1beta1.AppWrapperSpec{
+				Priority: priority,
+				Resources: mcadv1beta1.AppWrapperResources{
+					GenericItems: []mcadv1beta1.GenericItem{{
+						CustomPodResources: []mcadv1beta1.CustomPodResource{{
+							Replicas: 1,
+							Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpus)},
+						}},
+					}},
+				},
+			},
+			Status: mcadv1beta1.AppWrapperStatus{Phase: mcadv1beta1.Queued},
+		}
+	}
+	objects := []client.Object{node, queued("low", 1, "2"), queued("high", 5, "3"), queued("small", 0, "1")}
+	dispatched, err := Replay(context.Background(), scheme, objects, Config{TieBreaker: CreationTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, appWrapper := range dispatched {
+		names = append(names, appWrapper.Name)
+	}
+	// high fits, low no longer fits the remaining capacity, small does
+	if want := []string{"high", "small"}; len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
@@ -17,7 +17,12 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -29,6 +34,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
@@ -39,8 +45,18 @@ type PodCounts struct {
 	Other     int
 	Running   int
 	Succeeded int
+	Failed    int
+	Auxiliary int // non-terminated auxiliary pods, not included in other counts
+
+	Initializing int // pods running init containers, included in other counts
+	InfraFailed  int // pods failed by their node, e.g., evicted, included in failed counts
+
+	// Counts per pod set including auxiliary pods
+	PodSets map[string]*mcadv1beta1.PodSetStatus
 }
 
+const auxiliaryLabel = "workload.codeflare.dev/auxiliary" // label for pods excluded from health accounting
+
 const appWrapperNamespacePlaceholder = "<APPWRAPPER_NAMESPACE>"
 const appWrapperNamePlaceholder = "<APPWRAPPER_NAME>"
 
@@ -80,13 +96,35 @@ func fixArray(appWrapper *mcadv1beta1.AppWrapper, a []interface{}) {
 	}
 }
 
-// Parse raw resource into unstructured object
-func parseResource(appWrapper *mcadv1beta1.AppWrapper, raw []byte) (*unstructured.Unstructured, error) {
+// Return resource template, decompressing the template if needed
+func rawTemplate(resource *mcadv1beta1.GenericItem) ([]byte, error) {
+	raw := resource.GenericTemplate.Raw
+	switch resource.ContentEncoding {
+	case mcadv1beta1.Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(resource.CompressedTemplate))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if raw, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// Parse resource template into unstructured object, decompressing the template if needed
+func parseResource(appWrapper *mcadv1beta1.AppWrapper, resource *mcadv1beta1.GenericItem) (*unstructured.Unstructured, error) {
+	raw, err := rawTemplate(resource)
+	if err != nil {
+		return nil, err
+	}
 	obj := &unstructured.Unstructured{}
 	if _, _, err := unstructured.UnstructuredJSONScheme.Decode(raw, nil, obj); err != nil {
 		return nil, err
 	}
 	fixMap(appWrapper, obj.UnstructuredContent())
+	inheritFromParent(appWrapper, obj)
 	if obj.GetNamespace() == "" {
 		obj.SetNamespace("default")
 	}
@@ -97,7 +135,7 @@ func parseResource(appWrapper *mcadv1beta1.AppWrapper, raw []byte) (*unstructure
 func parseResources(appWrapper *mcadv1beta1.AppWrapper) ([]client.Object, error) {
 	objects := make([]client.Object, len(appWrapper.Spec.Resources.GenericItems))
 	for i, resource := range appWrapper.Spec.Resources.GenericItems {
-		obj, err := parseResource(appWrapper, resource.GenericTemplate.Raw)
+		obj, err := parseResource(appWrapper, &resource)
 		if err != nil {
 			return nil, err
 		}
@@ -106,127 +144,340 @@ func parseResources(appWrapper *mcadv1beta1.AppWrapper) ([]client.Object, error)
 	return objects, nil
 }
 
+// Generate auxiliary resources managed by MCAD on behalf of the AppWrapper given the wrapped resources
+func generateResources(appWrapper *mcadv1beta1.AppWrapper, wrapped []client.Object, nodeSelector map[string]string) []client.Object {
+	objects := []client.Object{}
+	if appWrapper.Spec.NetworkPolicy != nil {
+		objects = append(objects, newNetworkPolicy(appWrapper))
+	}
+	if appWrapper.Spec.PeerDiscovery {
+		objects = append(objects, newHeadlessService(appWrapper), newPeersConfigMap(appWrapper, wrapped))
+	}
+	if appWrapper.Spec.PrePullImages {
+		objects = append(objects, newPrePullDaemonSet(appWrapper, nodeSelector))
+	}
+	return objects
+}
+
+// Check whether an existing auxiliary resource on the local cluster is labeled as belonging to the AppWrapper
+// Resources with the same name created by users are neither adopted nor deleted
+func (r *AppWrapperReconciler) isManaged(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) (bool, error) {
+	reader := r.APIReader // do not start informers for auxiliary kinds
+	if reader == nil {
+		reader = r.Client
+	}
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := reader.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		return false, err
+	}
+	labels := existing.GetLabels()
+	return labels[namespaceLabel] == appWrapper.Namespace && labels[nameLabel] == appWrapper.Name, nil
+}
+
 // Create wrapped resources, give up on first error, decide if error is fatal
 func (r *AppWrapperReconciler) createResources(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (error, bool) {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return err, false // may be retried
+	}
+	if err := r.verifyPayloads(appWrapper); err != nil {
+		return withReason(mcadv1beta1.CreationForbidden, err), true // fatal
+	}
 	objects, err := parseResources(appWrapper)
 	if err != nil {
-		return err, true // fatal
+		return withReason(mcadv1beta1.ResourceParsingFailed, err), true // fatal
 	}
-	for _, obj := range objects {
-		if err := r.Create(ctx, obj); err != nil {
-			if apierrors.IsAlreadyExists(err) {
-				continue // ignore existing resources
-			}
+	if reason := r.checkIsolation(appWrapper, objects); reason != "" {
+		return withReason(mcadv1beta1.CreationForbidden, errors.New(reason)), true // fatal
+	}
+	applyShrunk(appWrapper, objects)
+	if err, fatal := r.resolveSecrets(ctx, appWrapper, objects); err != nil {
+		return err, fatal
+	}
+	if appWrapper.Spec.SnapshotReferences && appWrapper.Status.Target == localTarget {
+		if err := r.snapshotReferences(ctx, appWrapper, objects); err != nil {
+			return err, false // may be retried
+		}
+	}
+	nodeSelector, err := r.injectPodTemplates(ctx, appWrapper, objects)
+	if err != nil {
+		return err, false // may be retried
+	}
+	objects = append(objects, generateResources(appWrapper, objects, nodeSelector)...)
+	r.setOwnerReferences(appWrapper, objects)
+	for i, obj := range objects {
+		if err := t.Create(ctx, appWrapper, obj); err != nil && !apierrors.IsAlreadyExists(err) { // ignore existing resources
 			if discovery.IsGroupDiscoveryFailedError(err) ||
 				meta.IsNoMatchError(err) ||
 				runtime.IsMissingVersion(err) ||
 				runtime.IsMissingKind(err) {
-				return err, true // fatal
+				return withReason(mcadv1beta1.ResourceParsingFailed, err), true // fatal
 			}
 			return err, false // may be retried
+		} else if err != nil && i >= len(appWrapper.Spec.Resources.GenericItems) && appWrapper.Status.Target == localTarget {
+			// do not adopt an existing auxiliary resource that does not belong to the AppWrapper
+			if managed, err := r.isManaged(ctx, appWrapper, obj); err != nil {
+				return err, false // may be retried
+			} else if !managed {
+				kind := obj.GetObjectKind().GroupVersionKind().Kind
+				if gvk, err := r.GroupVersionKindFor(obj); err == nil {
+					kind = gvk.Kind // typed objects have no kind
+				}
+				return withReason(mcadv1beta1.CreationForbidden, fmt.Errorf("%s %s already exists and does not belong to the AppWrapper", kind, obj.GetName())), true // fatal
+			}
+		}
+		if i < len(appWrapper.Spec.Resources.GenericItems) {
+			r.recordCreation(appWrapper, i)
+		}
+		if appWrapper.Status.Target == localTarget {
+			r.rememberKind(obj)
 		}
 	}
 	return nil, false
 }
 
+// Set owner references on namespaced resources in the namespace of the AppWrapper on the local cluster
+// so garbage collection deletes them if finalizer-driven cleanup is bypassed
+// Owner references cannot cross namespaces or clusters, other resources are only tracked by labels
+func (r *AppWrapperReconciler) setOwnerReferences(appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) {
+	if !r.Config.OwnerReferences || appWrapper.Status.Target != localTarget {
+		return
+	}
+	for _, obj := range objects {
+		if obj.GetNamespace() != appWrapper.Namespace {
+			continue
+		}
+		if namespaced, err := r.IsObjectNamespaced(obj); err != nil || !namespaced {
+			continue // unknown kinds fail to be created anyway
+		}
+		_ = controllerutil.SetOwnerReference(appWrapper, obj, r.Scheme)
+	}
+}
+
 // Assess successful completion of AppWrapper by looking at pods and wrapped resources
-func (r *AppWrapperReconciler) isSuccessful(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts) (bool, error) {
-	// To succeed we need at least MinAvailable successful pods and no running, failed, and other pods
-	if counts.Running > 0 || counts.Other > 0 || counts.Succeeded < int(appWrapper.Spec.Scheduling.MinAvailable) {
+func (r *AppWrapperReconciler) isSuccessful(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts, statuses []*ResourceStatus) (bool, error) {
+	// If a leader resource is designated, its completion alone determines the completion of the AppWrapper
+	for i, resource := range appWrapper.Spec.Resources.GenericItems {
+		if resource.Leader {
+			return r.isLeaderSuccessful(ctx, appWrapper, resource, statuses[i])
+		}
+	}
+	// Completable resources of known kinds must have succeeded, their pods are accounted for by the resources
+	known := false // at least one completable resource of known kind?
+	for _, status := range statuses {
+		if status != nil && status.Completable {
+			if !status.Succeeded {
+				return false, nil
+			}
+			known = true
+		}
+	}
+	// Otherwise pod counts must satisfy the success policy
+	if !known && !podsSucceeded(appWrapper, counts) {
 		return false, nil
 	}
-	custom := false // at least one resource with completionstatus spec?
+	custom := known // at least one resource with completionstatus spec or completable resource of known kind?
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return false, err
+	}
 	for _, resource := range appWrapper.Spec.Resources.GenericItems {
 		// skip resources without a completionstatus spec
 		if resource.CompletionStatus != "" {
 			custom = true
-			obj, err := parseResource(appWrapper, resource.GenericTemplate.Raw)
+			obj, err := parseResource(appWrapper, &resource)
 			if err != nil {
 				return false, err
 			}
-			if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if err := t.Get(ctx, appWrapper, obj); err != nil {
 				return false, err
 			}
-			unstruct := obj.UnstructuredContent()
-			success := false // at least one condition matching completionstatus spec?
-			// check for a condition with status True and a type than contains one of the specified completion status key
-			if status, ok := unstruct["status"].(map[string]interface{}); ok {
-				if conditions, ok := status["conditions"].([]interface{}); ok {
-					keys := strings.Split(resource.CompletionStatus, ",")
-					for _, condition := range conditions {
-						if c, ok := condition.(map[string]interface{}); ok {
-							if t, ok := c["type"].(string); ok && c["status"] == "True" {
-								for _, k := range keys {
-									if strings.Contains(strings.ToLower(t), strings.ToLower(k)) {
-										success = true
-										break
-									}
-								}
+			if !matchesCompletionStatus(obj, resource.CompletionStatus) {
+				return false, nil
+			}
+		}
+	}
+	// To succeed we need to pass the custom completionstatus check or have a pod-based success criterion
+	policy := appWrapper.Spec.Scheduling.SuccessPolicy
+	return custom || policy != "" && policy != mcadv1beta1.MinAvailableSucceeded || appWrapper.Spec.Scheduling.MinAvailable > 0, nil
+}
+
+// Check pod counts against success policy
+func podsSucceeded(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts) bool {
+	switch appWrapper.Spec.Scheduling.SuccessPolicy {
+	case mcadv1beta1.AllSucceeded:
+		// all expected pods must succeed
+		expected := 0
+		for _, podSet := range listPodSets(appWrapper) {
+			expected += int(podSet.Expected)
+		}
+		if expected == 0 {
+			expected = int(appWrapper.Spec.Scheduling.MinAvailable)
+		}
+		return counts.Running == 0 && counts.Other == 0 && counts.Failed == 0 && counts.Succeeded > 0 && counts.Succeeded >= expected
+	case mcadv1beta1.AtLeastSucceeded:
+		return counts.Succeeded > 0 && counts.Succeeded >= int(appWrapper.Spec.Scheduling.MinSucceeded)
+	case mcadv1beta1.AnySucceeded:
+		return counts.Succeeded >= 1
+	default:
+		// at least MinAvailable successful pods and no running, failed, and other pods
+		return counts.Running == 0 && counts.Other == 0 && counts.Failed == 0 && counts.Succeeded >= int(appWrapper.Spec.Scheduling.MinAvailable)
+	}
+}
+
+// Assess successful completion of leader resource using completionstatus spec, known status, or pod phase
+func (r *AppWrapperReconciler) isLeaderSuccessful(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, resource mcadv1beta1.GenericItem, status *ResourceStatus) (bool, error) {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return false, err
+	}
+	if resource.CompletionStatus == "" && status != nil {
+		return status.Succeeded, nil
+	}
+	obj, err := parseResource(appWrapper, &resource)
+	if err != nil {
+		return false, err
+	}
+	if err := t.Get(ctx, appWrapper, obj); err != nil {
+		return false, err
+	}
+	if resource.CompletionStatus != "" {
+		return matchesCompletionStatus(obj, resource.CompletionStatus), nil
+	}
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	return phase == string(v1.PodSucceeded), nil
+}
+
+// Check for a condition with status True and a type than contains one of the specified completion status keys
+func matchesCompletionStatus(obj *unstructured.Unstructured, completionStatus string) bool {
+	unstruct := obj.UnstructuredContent()
+	if status, ok := unstruct["status"].(map[string]interface{}); ok {
+		if conditions, ok := status["conditions"].([]interface{}); ok {
+			keys := strings.Split(completionStatus, ",")
+			for _, condition := range conditions {
+				if c, ok := condition.(map[string]interface{}); ok {
+					if t, ok := c["type"].(string); ok && c["status"] == "True" {
+						for _, k := range keys {
+							if strings.Contains(strings.ToLower(t), strings.ToLower(k)) {
+								return true
 							}
 						}
 					}
 				}
 			}
-			if !success {
-				return false, nil
-			}
 		}
 	}
-	// To succeed we need to pass the custom completionstatus check or have enough successful pods if MinAvailable > 0
-	return custom || appWrapper.Spec.Scheduling.MinAvailable > 0 && counts.Succeeded >= int(appWrapper.Spec.Scheduling.MinAvailable), nil
+	return false
+}
+
+// Check whether AppWrapper designates a leader resource
+func hasLeader(appWrapper *mcadv1beta1.AppWrapper) bool {
+	for _, resource := range appWrapper.Spec.Resources.GenericItems {
+		if resource.Leader {
+			return true
+		}
+	}
+	return false
 }
 
 // Delete wrapped resources, forcing deletion of pods and wrapped resources if enabled
+// Pods are only forcefully deleted if the transport permits direct access to the target
 func (r *AppWrapperReconciler) deleteResources(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, timestamp metav1.Time) bool {
 	log := log.FromContext(ctx)
-	remaining := 0
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		log.Error(err, "Deletion error")
+		return false
+	}
+	c := t.Client()
+	objects := []client.Object{}
 	for _, resource := range appWrapper.Spec.Resources.GenericItems {
-		obj, err := parseResource(appWrapper, resource.GenericTemplate.Raw)
+		if resource.GenericTemplateRef != nil && resource.GenericTemplate.Raw == nil {
+			continue // offloaded template lost
+		}
+		obj, err := parseResource(appWrapper, &resource)
 		if err != nil {
 			log.Error(err, "Parsing error")
 			continue
 		}
-		if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		objects = append(objects, obj)
+	}
+	for _, obj := range generateResources(appWrapper, nil, nil) {
+		if appWrapper.Status.Target == localTarget {
+			if managed, err := r.isManaged(ctx, appWrapper, obj); err == nil && !managed {
+				continue // do not delete resources that do not belong to the AppWrapper
+			}
+		}
+		objects = append(objects, obj)
+	}
+	// find the resources of lost offloaded templates by labels
+	if missingTemplates(appWrapper) && appWrapper.Status.Target == localTarget {
+		labeled, err := r.labeledResources(ctx, appWrapper)
+		if err != nil {
+			log.Error(err, "Resource list error")
+			return false
+		}
+		objects = append(objects, labeled...)
+	}
+	if err := r.deleteProbes(ctx, appWrapper); err != nil {
+		log.Error(err, "Probe deletion error")
+	}
+	remaining := []client.Object{}
+	failed := false // failed to request the deletion of some resource
+	for _, obj := range objects {
+		err := t.Delete(ctx, appWrapper, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		countDeletion(obj, err)
+		if err != nil {
 			if !apierrors.IsNotFound(err) {
 				log.Error(err, "Deletion error")
+				failed = true
 			}
 			continue
 		}
-		remaining++ // no error deleting resource, resource therefore still exists
+		remaining = append(remaining, obj) // no error deleting resource, resource therefore still exists
+	}
+	if !failed {
+		r.recordDeletion(appWrapper)
+	}
+	// strip finalizers blocking deletion after delay
+	if len(remaining) > 0 && r.Config.FinalizerRemovalTimeout > 0 &&
+		metav1.Now().After(timestamp.Add(r.Config.FinalizerRemovalTimeout)) {
+		for _, obj := range remaining {
+			if err := r.removeFinalizers(ctx, t, appWrapper, obj); err != nil {
+				log.Error(err, "Finalizer removal error")
+			}
+		}
 	}
-	if appWrapper.Spec.Scheduling.ForceDeletionTimeInSeconds == 0 {
-		// force deletion is not enabled, return true iff no resources were found
-		return remaining == 0
+	if appWrapper.Spec.Scheduling.ForceDeletionTimeInSeconds == 0 && r.Config.TerminatingPods != CountTerminating {
+		// force deletion is not enabled and pods need not be gone, return true iff no resources were found
+		return len(remaining) == 0
 	}
 	pods := &v1.PodList{Items: []v1.Pod{}}
-	if err := r.List(ctx, pods, client.UnsafeDisableDeepCopy,
-		client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
-		log.Error(err, "Pod list error")
+	if c != nil {
+		if err := c.List(ctx, pods, client.UnsafeDisableDeepCopy,
+			client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+			log.Error(err, "Pod list error")
+		}
 	}
-	if remaining == 0 && len(pods.Items) == 0 {
+	if len(remaining) == 0 && len(pods.Items) == 0 {
 		// no resources, no pods, deletion is complete
 		return true
 	}
-	if !metav1.Now().After(timestamp.Add(time.Duration(appWrapper.Spec.Scheduling.ForceDeletionTimeInSeconds) * time.Second)) {
+	if appWrapper.Spec.Scheduling.ForceDeletionTimeInSeconds == 0 || !metav1.Now().After(timestamp.Add(time.Duration(appWrapper.Spec.Scheduling.ForceDeletionTimeInSeconds)*time.Second)) {
 		// wait before forcing deletion and simply requeue deletion
 		return false
 	}
 	if len(pods.Items) > 0 {
 		// force deletion of pods first
 		for _, pod := range pods.Items {
-			if err := r.Delete(ctx, &pod, client.GracePeriodSeconds(0)); err != nil {
+			if err := c.Delete(ctx, &pod, client.GracePeriodSeconds(0)); err != nil {
 				log.Error(err, "Forceful pod deletion error")
 			}
 		}
 	} else {
 		// force deletion of wrapped resources once pods are gone
-		for _, resource := range appWrapper.Spec.Resources.GenericItems {
-			obj, err := parseResource(appWrapper, resource.GenericTemplate.Raw)
-			if err != nil {
-				log.Error(err, "Parsing error")
-				continue
-			}
-			if err := r.Delete(ctx, obj, client.GracePeriodSeconds(0)); err != nil && !apierrors.IsNotFound(err) {
+		for _, obj := range objects {
+			if err := t.Delete(ctx, appWrapper, obj, client.GracePeriodSeconds(0)); err != nil && !apierrors.IsNotFound(err) {
 				log.Error(err, "Forceful deletion error")
 			}
 		}
@@ -235,17 +486,82 @@ func (r *AppWrapperReconciler) deleteResources(ctx context.Context, appWrapper *
 	return false
 }
 
-// Count AppWrapper pods
+// Remove strippable finalizers from object
+func (r *AppWrapperReconciler) removeFinalizers(ctx context.Context, t Transport, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	if err := t.Get(ctx, appWrapper, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	finalizers := []string{}
+	for _, finalizer := range obj.GetFinalizers() {
+		strip := false
+		for _, strippable := range r.Config.StrippableFinalizers {
+			if strippable == "*" || strippable == finalizer {
+				strip = true
+			}
+		}
+		if !strip {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	if len(finalizers) == len(obj.GetFinalizers()) {
+		return nil
+	}
+	log.FromContext(ctx).Info("Removing finalizers", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName(), "finalizers", obj.GetFinalizers())
+	obj.SetFinalizers(finalizers)
+	return client.IgnoreNotFound(t.Update(ctx, appWrapper, obj))
+}
+
+// Count AppWrapper pods, report no pods if the transport does not permit direct access to the target
 func (r *AppWrapperReconciler) countPods(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (*PodCounts, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return &PodCounts{PodSets: map[string]*mcadv1beta1.PodSetStatus{}}, nil
+	}
 	// list matching pods
 	pods := &v1.PodList{}
-	if err := r.List(ctx, pods,
+	if err := c.List(ctx, pods,
 		client.MatchingLabels{nameLabel: appWrapper.Name}); err != nil {
 		return nil, err
 	}
-	counts := &PodCounts{}
-	for _, pod := range pods.Items {
+	return tallyPods(appWrapper, pods.Items, r.Config.TerminatingPods), nil
+}
+
+// Count the pods of the AppWrapper in a list of pods with a matching name label
+// Terminating pods no longer accounted for according to the policy are skipped
+func tallyPods(appWrapper *mcadv1beta1.AppWrapper, pods []v1.Pod, policy TerminatingPodPolicy) *PodCounts {
+	counts := &PodCounts{PodSets: map[string]*mcadv1beta1.PodSetStatus{}}
+	for _, pod := range pods {
+		if isIgnoredTerminating(&pod, policy) {
+			continue
+		}
 		namespace := pod.Labels[namespaceLabel]
+		if name, ok := pod.Labels[podSetLabel]; ok && namespace == appWrapper.Namespace {
+			if counts.PodSets[name] == nil {
+				counts.PodSets[name] = &mcadv1beta1.PodSetStatus{Name: name}
+			}
+			switch pod.Status.Phase {
+			case v1.PodRunning:
+				counts.PodSets[name].Running += 1
+			case v1.PodSucceeded:
+				counts.PodSets[name].Succeeded += 1
+			case v1.PodFailed:
+				counts.PodSets[name].Failed += 1
+			default:
+				counts.PodSets[name].Other += 1
+				if isInitializing(&pod) {
+					counts.PodSets[name].Initializing += 1
+				}
+			}
+		}
+		if pod.Labels[auxiliaryLabel] == "true" {
+			if namespace == appWrapper.Namespace && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+				counts.Auxiliary += 1
+			}
+			continue
+		}
 		switch pod.Status.Phase {
 		case v1.PodSucceeded:
 			if namespace == appWrapper.Namespace || namespace == "" {
@@ -255,11 +571,21 @@ func (r *AppWrapperReconciler) countPods(ctx context.Context, appWrapper *mcadv1
 			if namespace == appWrapper.Namespace || namespace == "" {
 				counts.Running += 1 // for backward compatibility count pods missing namespace label
 			}
+		case v1.PodFailed:
+			if namespace == appWrapper.Namespace {
+				counts.Failed += 1
+				if isInfraFailure(&pod) {
+					counts.InfraFailed += 1
+				}
+			}
 		default:
 			if namespace == appWrapper.Namespace {
 				counts.Other += 1
+				if isInitializing(&pod) {
+					counts.Initializing += 1
+				}
 			}
 		}
 	}
-	return counts, nil
+	return counts
 }
@@ -0,0 +1,355 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// ResourceStatus is the status of a wrapped resource derived from the resource itself
+// For known resource kinds, this status supersedes pod counts
+type ResourceStatus struct {
+	// Resource is expected to complete, e.g., a job as opposed to a service
+	Completable bool
+
+	// Resource is healthy
+	Ready bool
+
+	// Resource completed successfully
+	Succeeded bool
+
+	// Resource failed
+	Failed bool
+
+	// Failure details
+	Message string
+
+	// Failure reason code
+	Code mcadv1beta1.FailureReason
+
+	// Dashboard URL if any
+	DashboardURL string
+
+	// Resource manages replicas whose readiness supersedes the pod counts of its pod sets
+	ReplicaManaged bool
+
+	// Ready replicas up to the desired number of replicas, surge pods excluded
+	ReadyReplicas int
+}
+
+// Function deriving the status of a wrapped resource
+type statusFunc func(obj *unstructured.Unstructured) *ResourceStatus
+
+// Status functions for known resource kinds
+var statusFuncs = map[schema.GroupKind]statusFunc{
+	{Group: "batch", Kind: "Job"}:                             jobStatus,
+	{Group: "apps", Kind: "Deployment"}:                       deploymentStatus,
+	{Group: "apps", Kind: "StatefulSet"}:                      statefulSetStatus,
+	{Group: "ray.io", Kind: "RayCluster"}:                     rayClusterStatus,
+	{Group: "ray.io", Kind: "RayJob"}:                         rayJobStatus,
+	{Group: "kubeflow.org", Kind: "PyTorchJob"}:               kubeflowJobStatus,
+	{Group: "kubeflow.org", Kind: "TFJob"}:                    kubeflowJobStatus,
+	{Group: "kubeflow.org", Kind: "MPIJob"}:                   kubeflowJobStatus,
+	{Group: "kubeflow.org", Kind: "XGBoostJob"}:               kubeflowJobStatus,
+	{Group: "kubeflow.org", Kind: "PaddleJob"}:                kubeflowJobStatus,
+	{Group: "sparkoperator.k8s.io", Kind: "SparkApplication"}: sparkApplicationStatus,
+	appWrapperGroupKind:                                       appWrapperStatus,
+}
+
+// Get the status of wrapped resources of known kinds, nil entries denote unknown kinds
+func (r *AppWrapperReconciler) getResourceStatuses(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) ([]*ResourceStatus, error) {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*ResourceStatus, len(appWrapper.Spec.Resources.GenericItems))
+	for i, resource := range appWrapper.Spec.Resources.GenericItems {
+		obj, err := parseResource(appWrapper, &resource)
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := statusFuncs[obj.GroupVersionKind().GroupKind()]
+		if !ok {
+			continue
+		}
+		if err := t.Get(ctx, appWrapper, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue // resource is not created yet or was deleted
+			}
+			return nil, err
+		}
+		statuses[i] = fn(obj)
+	}
+	return statuses, nil
+}
+
+// Derive status of a batch Job from its conditions
+// The job is ready if enough pods are ready to make progress at the requested parallelism
+func jobStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	status := &ResourceStatus{
+		Completable: true,
+		Succeeded:   isConditionTrue(obj, "Complete"),
+		Failed:      isConditionTrue(obj, "Failed"),
+	}
+	if status.Failed {
+		status.Message = "Job " + obj.GetName() + " failed: " + conditionMessage(obj, "Failed")
+		status.Code = mcadv1beta1.PodsFailed
+		if condition := findCondition(obj, "Failed"); condition["reason"] == "DeadlineExceeded" {
+			status.Code = mcadv1beta1.DeadlineExceeded
+		}
+	}
+	parallelism, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "parallelism")
+	if !ok {
+		parallelism = 1 // default
+	}
+	succeeded, _, _ := unstructured.NestedInt64(obj.Object, "status", "succeeded")
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "ready")
+	expected := parallelism
+	if completions, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "completions"); ok && completions-succeeded < expected {
+		expected = completions - succeeded
+	}
+	status.Ready = ready >= expected
+	return status
+}
+
+// Derive status of a Deployment from its replica counts
+// The deployment is ready if all desired replicas are updated and ready or if a rollout is progressing
+func deploymentStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	replicas, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !ok {
+		replicas = 1 // default
+	}
+	current, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	rollout := current > updated // pods of earlier revisions remain
+	return &ResourceStatus{
+		Ready:          updated >= replicas && ready >= replicas || rollout && isConditionTrue(obj, "Progressing"),
+		ReplicaManaged: true,
+		ReadyReplicas:  int(min64(ready, replicas)),
+	}
+}
+
+// Derive status of a StatefulSet from its replica counts
+// The stateful set is ready if all desired replicas are ready or if a rolling update is replacing one replica at a time
+func statefulSetStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	replicas, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !ok {
+		replicas = 1 // default
+	}
+	ready, _, _ := unstructured.NestedInt64(obj.Object, "status", "readyReplicas")
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	rollout := updateRevision != "" && currentRevision != updateRevision
+	return &ResourceStatus{
+		Ready:          ready >= replicas || rollout && ready+1 >= replicas,
+		ReplicaManaged: true,
+		ReadyReplicas:  int(min64(ready, replicas)),
+	}
+}
+
+// Return the smaller of two integers
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Derive status of a RayCluster
+func rayClusterStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	state, _, _ := unstructured.NestedString(obj.Object, "status", "state")
+	status := &ResourceStatus{Ready: state == "ready", Failed: state == "failed"}
+	if status.Failed {
+		reason, _, _ := unstructured.NestedString(obj.Object, "status", "reason")
+		status.Message = "RayCluster " + obj.GetName() + " failed: " + reason
+	}
+	if _, ok, _ := unstructured.NestedString(obj.Object, "status", "endpoints", "dashboard"); ok {
+		status.DashboardURL = "http://" + obj.GetName() + "-head-svc." + obj.GetNamespace() + ".svc:8265"
+	}
+	return status
+}
+
+// Derive status of a RayJob
+func rayJobStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	jobStatus, _, _ := unstructured.NestedString(obj.Object, "status", "jobStatus")
+	deploymentStatus, _, _ := unstructured.NestedString(obj.Object, "status", "jobDeploymentStatus")
+	status := &ResourceStatus{
+		Completable: true,
+		Ready:       jobStatus == "RUNNING" || deploymentStatus == "Running",
+		Succeeded:   jobStatus == "SUCCEEDED",
+		Failed:      jobStatus == "FAILED" || jobStatus == "STOPPED" || deploymentStatus == "Failed",
+	}
+	if status.Failed {
+		message, _, _ := unstructured.NestedString(obj.Object, "status", "message")
+		status.Message = "RayJob " + obj.GetName() + " failed: " + message
+	}
+	if url, ok, _ := unstructured.NestedString(obj.Object, "status", "dashboardURL"); ok && url != "" {
+		if !strings.Contains(url, "://") {
+			url = "http://" + url
+		}
+		status.DashboardURL = url
+	}
+	return status
+}
+
+// Derive status of a Kubeflow training job
+// The job is ready if running with all replicas active or if the training operator is restarting replicas
+func kubeflowJobStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	status := &ResourceStatus{
+		Completable: true,
+		Succeeded:   isConditionTrue(obj, "Succeeded"),
+		Failed:      isConditionTrue(obj, "Failed"),
+	}
+	if status.Failed {
+		status.Message = obj.GetKind() + " " + obj.GetName() + " failed: " + conditionMessage(obj, "Failed")
+	}
+	expected := int64(0)
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	for k, v := range spec {
+		if replicaSpecs, ok := v.(map[string]interface{}); ok && strings.HasSuffix(k, "ReplicaSpecs") {
+			for _, replicaSpec := range replicaSpecs {
+				if replicaSpec, ok := replicaSpec.(map[string]interface{}); ok {
+					replicas, ok, _ := unstructured.NestedInt64(replicaSpec, "replicas")
+					if !ok {
+						replicas = 1 // default
+					}
+					expected += replicas
+				}
+			}
+		}
+	}
+	active := int64(0)
+	replicaStatuses, _, _ := unstructured.NestedMap(obj.Object, "status", "replicaStatuses")
+	for _, replicaStatus := range replicaStatuses {
+		if replicaStatus, ok := replicaStatus.(map[string]interface{}); ok {
+			n, _, _ := unstructured.NestedInt64(replicaStatus, "active")
+			active += n
+		}
+	}
+	status.Ready = isConditionTrue(obj, "Restarting") || isConditionTrue(obj, "Running") && active >= expected
+	return status
+}
+
+// Derive status of a SparkApplication
+// Executor pods come and go, so the application state supersedes pod counts
+func sparkApplicationStatus(obj *unstructured.Unstructured) *ResourceStatus {
+	state, _, _ := unstructured.NestedString(obj.Object, "status", "applicationState", "state")
+	status := &ResourceStatus{Completable: true}
+	switch state {
+	case "RUNNING", "SUCCEEDING", "PENDING_RERUN", "INVALIDATING":
+		status.Ready = true
+	case "COMPLETED":
+		status.Succeeded = true
+	case "FAILED", "SUBMISSION_FAILED":
+		status.Failed = true
+		message, _, _ := unstructured.NestedString(obj.Object, "status", "applicationState", "errorMessage")
+		status.Message = "SparkApplication " + obj.GetName() + " failed: " + message
+	}
+	return status
+}
+
+// Check whether resource has a condition of the given type with status True
+func isConditionTrue(obj *unstructured.Unstructured, conditionType string) bool {
+	return findCondition(obj, conditionType) != nil
+}
+
+// Get message of the condition of the given type with status True
+func conditionMessage(obj *unstructured.Unstructured, conditionType string) string {
+	if condition := findCondition(obj, conditionType); condition != nil {
+		message, _ := condition["message"].(string)
+		return message
+	}
+	return ""
+}
+
+// Find condition of the given type with status True
+func findCondition(obj *unstructured.Unstructured, conditionType string) map[string]interface{} {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		if c, ok := condition.(map[string]interface{}); ok && c["type"] == conditionType && c["status"] == "True" {
+			return c
+		}
+	}
+	return nil
+}
+
+// Check whether there is at least one wrapped resource of known kind and all such resources are ready or succeeded
+func isReady(statuses []*ResourceStatus) bool {
+	known := false
+	for _, status := range statuses {
+		if status != nil {
+			if !status.Ready && !status.Succeeded {
+				return false
+			}
+			known = true
+		}
+	}
+	return known
+}
+
+// Count healthy pods, replacing the pods of replica-managed resources with their ready replicas
+// Surge pods and pods of earlier revisions therefore neither inflate nor deflate the count
+func healthyReplicas(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts, statuses []*ResourceStatus) int {
+	healthy := healthyPods(appWrapper, counts)
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		if i >= len(statuses) || statuses[i] == nil || !statuses[i].ReplicaManaged {
+			continue
+		}
+		obj, err := parseResource(appWrapper, &appWrapper.Spec.Resources.GenericItems[i])
+		if err != nil {
+			continue
+		}
+		walkPodTemplates(obj.UnstructuredContent(), nil, nil, func(t *podTemplate) {
+			if c, ok := counts.PodSets[podSetName(obj, t)]; ok {
+				healthy -= int(c.Running)
+			}
+		})
+		healthy += statuses[i].ReadyReplicas
+	}
+	return healthy
+}
+
+// Find first failed wrapped resource if any, default the failure reason code to failed pods
+func findFailure(statuses []*ResourceStatus) *ResourceStatus {
+	for _, status := range statuses {
+		if status != nil && status.Failed {
+			if status.Code == "" {
+				status.Code = mcadv1beta1.PodsFailed
+			}
+			return status
+		}
+	}
+	return nil
+}
+
+// Find first dashboard URL if any
+func findDashboardURL(statuses []*ResourceStatus) string {
+	for _, status := range statuses {
+		if status != nil && status.DashboardURL != "" {
+			return status.DashboardURL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The periodic resync is a safety net against missed watch events and controller bugs
+// It re-lists all AppWrappers, enqueues a reconciliation for each, and checks phases against observed state
+// Anomalies are flagged with warning events and metrics, the enqueued reconciliations repair what they can
+
+// Anomalies detected by the periodic resync
+const (
+	anomalyUnadmitted    = "unadmitted"     // AppWrapper never admitted into the queue
+	anomalyNoPods        = "no_pods"        // running AppWrapper without pods
+	anomalyPhaseMismatch = "phase_mismatch" // cached phase disagrees with the AppWrapper status
+)
+
+// Resync periodically until the manager stops
+func (r *AppWrapperReconciler) resyncPeriodically(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.Config.ResyncPeriod):
+		}
+		if err := r.resync(ctx); err != nil {
+			mcadLog.Error(err, "Resync error")
+		}
+	}
+}
+
+// Re-list AppWrappers, flag anomalies, and enqueue reconciliations
+func (r *AppWrapperReconciler) resync(ctx context.Context) error {
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers); err != nil {
+		return err
+	}
+	counts := map[string]int{anomalyUnadmitted: 0, anomalyNoPods: 0, anomalyPhaseMismatch: 0}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if isAssigned(appWrapper) {
+			continue // reconciled by pull-based agents
+		}
+		if anomaly, err := r.checkConsistency(ctx, appWrapper); err != nil {
+			mcadLog.Error(err, "Resync check error", "namespace", appWrapper.Namespace, "name", appWrapper.Name)
+		} else if anomaly != "" {
+			counts[anomaly]++
+			r.Recorder.Event(appWrapper, v1.EventTypeWarning, "ResyncAnomaly", anomaly)
+			mcadLog.Info("Resync anomaly", "namespace", appWrapper.Namespace, "name", appWrapper.Name, "anomaly", anomaly)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case r.Events <- event.GenericEvent{Object: appWrapper}:
+		}
+	}
+	for anomaly, count := range counts {
+		resyncAnomalies.WithLabelValues(anomaly).Set(float64(count))
+	}
+	r.triggerDispatch()
+	return nil
+}
+
+// Check the phase of an AppWrapper against the cached phase and observed pods
+// Only report anomalies older than a resync period to leave time for ongoing reconciliations
+// Return the anomaly if any
+func (r *AppWrapperReconciler) checkConsistency(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (string, error) {
+	if !appWrapper.DeletionTimestamp.IsZero() {
+		return "", nil
+	}
+	since := appWrapper.CreationTimestamp.Time
+	if n := len(appWrapper.Status.Transitions); n > 0 {
+		since = appWrapper.Status.Transitions[n-1].Time.Time
+	}
+	if time.Since(since) < r.Config.ResyncPeriod {
+		return "", nil
+	}
+	if appWrapper.Status.Phase == mcadv1beta1.Empty || appWrapper.Status.Phase == mcadv1beta1.Admitting {
+		return anomalyUnadmitted, nil
+	}
+	r.mutex.Lock()
+	phase, step := r.getCachedPhase(appWrapper)
+	r.mutex.Unlock()
+	if phase != appWrapper.Status.Phase || step != appWrapper.Status.Step {
+		return anomalyPhaseMismatch, nil
+	}
+	if phase == mcadv1beta1.Running && step == mcadv1beta1.Created && appWrapper.Spec.Scheduling.MinAvailable > 0 && r.observesPods(appWrapper) {
+		counts, err := r.countPods(ctx, appWrapper)
+		if err != nil {
+			return "", err
+		}
+		if counts.Running+counts.Other+counts.Succeeded+counts.Failed == 0 {
+			return anomalyNoPods, nil
+		}
+	}
+	return "", nil
+}
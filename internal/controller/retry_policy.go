@@ -0,0 +1,62 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// AppWrappers may opt out of requeuing so pipelines learn about failures without waiting for max requeuings
+// With retry policy Never, every failure is fatal and the first failed pod fails the AppWrapper
+// With retry policy OnInfraFailureOnly, failed wrapped resources and pods failed by their containers are fatal,
+// whereas pods evicted or lost by their node and other failures, e.g., unschedulable pods, are requeued
+
+// Pod status reasons denoting pods failed by their node rather than by their containers
+var infraFailureReasons = []string{"Evicted", "Preempting", "NodeLost", "NodeAffinity", "Shutdown", "Terminated", "UnexpectedAdmissionError"}
+
+// Check whether a failed pod was failed by its node, e.g., evicted, rather than by its containers
+func isInfraFailure(pod *v1.Pod) bool {
+	for _, reason := range infraFailureReasons {
+		if pod.Status.Reason == reason {
+			return true
+		}
+	}
+	if strings.HasPrefix(pod.Status.Reason, "OutOf") {
+		return true // e.g. OutOfcpu or OutOfmemory at admission
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.DisruptionTarget && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// Count the failed pods that fail the AppWrapper according to its retry policy
+func fatalFailedPods(appWrapper *mcadv1beta1.AppWrapper, counts *PodCounts) int {
+	switch appWrapper.Spec.RetryPolicy {
+	case mcadv1beta1.RetryNever:
+		return counts.Failed
+	case mcadv1beta1.RetryOnInfraFailureOnly:
+		return counts.Failed - counts.InfraFailed
+	}
+	return 0
+}
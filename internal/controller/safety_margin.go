@@ -0,0 +1,79 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/inf.v0"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Margin is the capacity withheld from dispatch for one resource
+// Either an absolute quantity or a percentage of the cluster capacity
+type Margin struct {
+	Quantity resource.Quantity
+	Percent  int64
+}
+
+// Parse comma-separated list of margins, for example "cpu=2,nvidia.com/gpu=10%"
+func ParseMargins(s string) (map[v1.ResourceName]Margin, error) {
+	margins := map[v1.ResourceName]Margin{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid margin %q", entry)
+		}
+		if percent, ok := strings.CutSuffix(value, "%"); ok {
+			p, err := strconv.ParseInt(percent, 10, 64)
+			if err != nil || p < 0 || p > 100 {
+				return nil, fmt.Errorf("invalid margin %q", entry)
+			}
+			margins[v1.ResourceName(name)] = Margin{Percent: p}
+		} else {
+			q, err := resource.ParseQuantity(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid margin %q: %w", entry, err)
+			}
+			margins[v1.ResourceName(name)] = Margin{Quantity: q}
+		}
+	}
+	return margins, nil
+}
+
+// Subtract margins from capacity
+func applyMargins(capacity Weights, margins map[v1.ResourceName]Margin) {
+	margin := Weights{}
+	for name, m := range margins {
+		if m.Percent > 0 {
+			if c, ok := capacity[name]; ok {
+				tmp := inf.NewDec(m.Percent, 2) // percent / 100
+				margin[name] = tmp.Mul(tmp, c)
+			}
+		} else {
+			margin[name] = m.Quantity.AsDec()
+		}
+	}
+	capacity.Sub(margin)
+}
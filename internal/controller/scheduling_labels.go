@@ -0,0 +1,59 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Wrapped resources and their pods are labeled with the scheduling context of the AppWrapper
+// so cluster-level tooling can group resources without resolving the owning AppWrapper
+
+const (
+	priorityLabel        = "workload.codeflare.dev/priority"         // AppWrapper priority label for wrapped resources
+	dispatchAttemptLabel = "workload.codeflare.dev/dispatch-attempt" // dispatch attempt number label for wrapped resources
+)
+
+// Compute the labels describing the owner and scheduling context of the AppWrapper
+func schedulingLabels(appWrapper *mcadv1beta1.AppWrapper) map[string]string {
+	labels := map[string]string{
+		namespaceLabel:       appWrapper.Namespace,
+		nameLabel:            appWrapper.Name,
+		priorityLabel:        strconv.Itoa(int(appWrapper.Spec.Priority)),
+		dispatchAttemptLabel: strconv.Itoa(int(appWrapper.Status.Restarts + appWrapper.Status.Migrations + 1)),
+	}
+	if queue, ok := appWrapper.Labels[queueLabel]; ok {
+		labels[queueLabel] = queue
+	}
+	return labels
+}
+
+// Label wrapped resource with the scheduling context of the AppWrapper
+func labelResource(appWrapper *mcadv1beta1.AppWrapper, obj *unstructured.Unstructured) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for k, v := range schedulingLabels(appWrapper) {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+}
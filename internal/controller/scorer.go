@@ -0,0 +1,119 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	v1 "k8s.io/api/core/v1"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// An external placement scorer is an HTTP endpoint that scores the eligible dispatch targets of an AppWrapper
+// MCAD posts a ScorerRequest and expects a ScorerResponse, the returned scores replace the built-in scores
+// Targets missing from the response keep their built-in scores, errors fall back to the built-in scores
+
+// Request sent to the external placement scorer
+type ScorerRequest struct {
+	AppWrapper ScorerAppWrapper  `json:"appWrapper"`
+	Candidates []ScorerCandidate `json:"candidates"`
+}
+
+// AppWrapper requirements sent to the external placement scorer
+type ScorerAppWrapper struct {
+	Namespace string                   `json:"namespace"`
+	Name      string                   `json:"name"`
+	Priority  int32                    `json:"priority"`
+	Labels    map[string]string        `json:"labels,omitempty"`
+	Requests  v1.ResourceList          `json:"requests,omitempty"`
+	GPUType   string                   `json:"gpuType,omitempty"`
+	Clusters  *mcadv1beta1.ClusterSpec `json:"clusters,omitempty"`
+}
+
+// Candidate dispatch target sent to the external placement scorer
+type ScorerCandidate struct {
+	Name      string            `json:"name"` // "local" for the local cluster
+	Labels    map[string]string `json:"labels,omitempty"`
+	Cost      float64           `json:"cost,omitempty"`
+	Available v1.ResourceList   `json:"available,omitempty"` // available capacity at the AppWrapper priority
+	Score     float64           `json:"score"`               // built-in placement score
+}
+
+// Response of the external placement scorer
+type ScorerResponse struct {
+	Scores map[string]float64 `json:"scores"` // score of each target by name, higher is better
+}
+
+var scorerClient = &http.Client{Timeout: scorerTimeout}
+
+// Name of target in scorer requests and responses
+func scorerName(name string) string {
+	if name == localTarget {
+		return localTargetName
+	}
+	return name
+}
+
+// Replace the scores of the candidates with the scores returned by the external placement scorer
+func (r *AppWrapperReconciler) externalScores(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, request Weights,
+	candidates []*candidate, scores map[*candidate]float64) error {
+	body := ScorerRequest{AppWrapper: ScorerAppWrapper{
+		Namespace: appWrapper.Namespace,
+		Name:      appWrapper.Name,
+		Priority:  appWrapper.Spec.Priority,
+		Labels:    appWrapper.Labels,
+		Requests:  request.AsResources(),
+		GPUType:   appWrapper.Spec.GPUType,
+		Clusters:  appWrapper.Spec.Clusters,
+	}}
+	for _, c := range candidates {
+		body.Candidates = append(body.Candidates, ScorerCandidate{Name: scorerName(c.name), Labels: c.properties.Labels,
+			Cost: c.properties.Cost, Available: c.available[int(appWrapper.Spec.Priority)].AsResources(), Score: scores[c]})
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Config.PlacementScorer, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := scorerClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("placement scorer returned status %d", resp.StatusCode)
+	}
+	response := &ScorerResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if score, ok := response.Scores[scorerName(c.name)]; ok {
+			scores[c] = score
+		}
+	}
+	return nil
+}
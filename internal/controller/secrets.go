@@ -0,0 +1,167 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Wrapped manifests may reference secrets held by an external secret manager using ${secret:<path>#<key>} placeholders
+// Placeholders are resolved at dispatch time by posting a SecretRequest to the secret resolver configured by the admin
+// Resolved values only appear in the created resources, never in the AppWrapper stored in etcd
+// Unresolved placeholders prevent the creation of the wrapped resources and requeue the AppWrapper
+// Placeholders are refused for remote targets as their transports store the created resources on the hub
+
+// Placeholder syntax for external secrets
+var secretPlaceholder = regexp.MustCompile(`\$\{secret:([^}#]+)#([^}]+)\}`)
+
+// Reference to a secret held by the external secret manager
+type SecretReference struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// Request sent to the secret resolver
+type SecretRequest struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Secrets   []SecretReference `json:"secrets"`
+}
+
+// Response of the secret resolver
+type SecretResponse struct {
+	Values map[string]string `json:"values"` // value of each secret by "<path>#<key>"
+}
+
+var secretClient = &http.Client{Timeout: secretResolverTimeout}
+
+// Error for AppWrapper with placeholders but no secret resolver
+var errNoSecretResolver = errors.New("secret placeholders require a secret resolver")
+
+// Error for AppWrapper with placeholders dispatched to a remote target
+var errRemoteSecrets = errors.New("secret placeholders are only supported on the local cluster")
+
+// Key of a secret reference in secret resolver responses
+func (s SecretReference) String() string {
+	return s.Path + "#" + s.Key
+}
+
+// Apply function to all strings in unstructured content, including map keys
+func mapStrings(value interface{}, f func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return f(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[f(k)] = mapStrings(e, f)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = mapStrings(e, f)
+		}
+		return v
+	}
+	return value
+}
+
+// Resolve secret placeholders in wrapped resources, return error and whether error is fatal
+func (r *AppWrapperReconciler) resolveSecrets(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) (error, bool) {
+	// collect placeholders
+	refs := map[string]SecretReference{}
+	for _, obj := range objects {
+		mapStrings(obj.(*unstructured.Unstructured).Object, func(s string) string {
+			for _, match := range secretPlaceholder.FindAllStringSubmatch(s, -1) {
+				ref := SecretReference{Path: match[1], Key: match[2]}
+				refs[ref.String()] = ref
+			}
+			return s
+		})
+	}
+	if len(refs) == 0 {
+		return nil, false
+	}
+	if r.Config.SecretResolver == "" {
+		return errNoSecretResolver, true
+	}
+	if appWrapper.Status.Target != localTarget {
+		return errRemoteSecrets, true // resolved values would be stored on the hub
+	}
+	values, err := r.fetchSecrets(ctx, appWrapper, refs)
+	if err != nil {
+		return err, false // may be retried
+	}
+	for _, obj := range objects {
+		u := obj.(*unstructured.Unstructured)
+		u.Object = mapStrings(u.Object, func(s string) string {
+			return secretPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+				match := secretPlaceholder.FindStringSubmatch(placeholder)
+				return values[SecretReference{Path: match[1], Key: match[2]}.String()]
+			})
+		}).(map[string]interface{})
+	}
+	return nil, false
+}
+
+// Fetch the values of the referenced secrets from the secret resolver
+func (r *AppWrapperReconciler) fetchSecrets(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, refs map[string]SecretReference) (map[string]string, error) {
+	body := SecretRequest{Namespace: appWrapper.Namespace, Name: appWrapper.Name}
+	for _, ref := range refs {
+		body.Secrets = append(body.Secrets, ref)
+	}
+	sort.Slice(body.Secrets, func(i, j int) bool { return body.Secrets[i].String() < body.Secrets[j].String() })
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Config.SecretResolver, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := secretClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secret resolver returned status %d", resp.StatusCode)
+	}
+	response := &SecretResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, err
+	}
+	for key := range refs {
+		if _, ok := response.Values[key]; !ok {
+			return nil, fmt.Errorf("secret resolver did not resolve %s", key) // never include values in errors
+		}
+	}
+	return response.Values, nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Wait for the manager to stop, then stop dispatching and create the resources of dispatched AppWrappers
+// AppWrappers still creating resources after the shutdown timeout are resumed by the next controller instance
+// Nothing is written if the manager stopped without a stop signal, e.g., because leadership was lost
+func (r *AppWrapperReconciler) shutdown(ctx context.Context) error {
+	<-ctx.Done()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stopping = true
+	if r.Stopped != nil {
+		select {
+		case <-r.Stopped:
+		default:
+			mcadLog.Info("Skipping shutdown procedure without stop signal")
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers); err != nil {
+		mcadLog.Error(err, "Shutdown error")
+		return nil
+	}
+	completed := 0
+	pending := 0
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		if phase, step := r.getCachedPhase(appWrapper); phase != mcadv1beta1.Running || step != mcadv1beta1.Creating {
+			continue
+		}
+		if _, err := r.reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(appWrapper)}); err != nil {
+			mcadLog.Error(err, "Shutdown error", "namespace", appWrapper.Namespace, "name", appWrapper.Name)
+			pending++
+			continue
+		}
+		// AppWrappers waiting on readiness probes or hooks remain in the creating step
+		if _, step := r.getCachedPhase(appWrapper); step == mcadv1beta1.Created {
+			completed++
+		} else {
+			pending++
+		}
+	}
+	mcadLog.Info("Completed in-flight dispatches", "count", completed, "pending", pending)
+	// dispatch is stopped, resolve pending dispatch transactions
+	if r.Config.DispatchLog {
+		if err := r.recoverDispatchLog(ctx); err != nil {
+			mcadLog.Error(err, "Shutdown error")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Reference to a ConfigMap or Secret in a pod template
+type reference struct {
+	secret bool                   // Secret or ConfigMap
+	parent map[string]interface{} // map containing the name
+	field  string                 // name field
+}
+
+// Name of the snapshot of a ConfigMap or Secret
+func snapshotName(appWrapper *mcadv1beta1.AppWrapper, name string) string {
+	return appWrapper.Name + "-snapshot-" + name
+}
+
+// Get nested map without creating missing maps, return nil if missing
+func lookupMap(v interface{}, fields ...string) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	for _, field := range fields {
+		m, _ = m[field].(map[string]interface{})
+	}
+	return m
+}
+
+// Apply function to every ConfigMap and Secret reference in pod spec
+func forEachReference(spec map[string]interface{}, fn func(ref reference)) {
+	visit := func(v interface{}, secret bool, field string, path ...string) {
+		if parent := lookupMap(v, path...); parent != nil {
+			fn(reference{secret: secret, parent: parent, field: field})
+		}
+	}
+	volumes, _ := spec["volumes"].([]interface{})
+	for _, volume := range volumes {
+		visit(volume, false, "name", "configMap")
+		visit(volume, true, "secretName", "secret")
+		sources, _ := lookupMap(volume, "projected")["sources"].([]interface{})
+		for _, source := range sources {
+			visit(source, false, "name", "configMap")
+			visit(source, true, "name", "secret")
+		}
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := spec[field].([]interface{})
+		for _, container := range containers {
+			env, _ := lookupMap(container)["env"].([]interface{})
+			for _, e := range env {
+				visit(e, false, "name", "valueFrom", "configMapKeyRef")
+				visit(e, true, "name", "valueFrom", "secretKeyRef")
+			}
+			envFrom, _ := lookupMap(container)["envFrom"].([]interface{})
+			for _, e := range envFrom {
+				visit(e, false, "name", "configMapRef")
+				visit(e, true, "name", "secretRef")
+			}
+		}
+	}
+}
+
+// Copy ConfigMaps and Secrets referenced by the pod templates of the wrapped resources unless already copied
+// Rewrite references to use the copies, which are owned by the AppWrapper and survive requeuing
+// References to missing objects are left unchanged
+func (r *AppWrapperReconciler) snapshotReferences(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, objects []client.Object) error {
+	var err error
+	for _, obj := range objects {
+		forEachPodTemplate(obj.(*unstructured.Unstructured).UnstructuredContent(), func(_ map[string]interface{}, spec map[string]interface{}) {
+			forEachReference(spec, func(ref reference) {
+				name, ok := ref.parent[ref.field].(string)
+				if !ok || name == "" || err != nil {
+					return
+				}
+				var snapshotted bool
+				if snapshotted, err = r.snapshot(ctx, appWrapper, name, ref.secret); err == nil && snapshotted {
+					ref.parent[ref.field] = snapshotName(appWrapper, name)
+				}
+			})
+		})
+	}
+	return err
+}
+
+// Copy ConfigMap or Secret unless already copied, return false if the object does not exist
+func (r *AppWrapperReconciler) snapshot(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, name string, secret bool) (bool, error) {
+	var original, copy client.Object
+	key := types.NamespacedName{Namespace: appWrapper.Namespace, Name: snapshotName(appWrapper, name)}
+	if secret {
+		original, copy = &v1.Secret{}, &v1.Secret{}
+	} else {
+		original, copy = &v1.ConfigMap{}, &v1.ConfigMap{}
+	}
+	reader := r.APIReader // do not start cluster-wide informers for Secrets and ConfigMaps
+	if reader == nil {
+		reader = r.Client
+	}
+	// check for existing snapshot
+	if err := reader.Get(ctx, key, copy); err == nil {
+		return true, nil
+	} else if !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: appWrapper.Namespace, Name: name}, original); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	meta := metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name,
+		Labels: map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}}
+	if secret {
+		s := original.(*v1.Secret)
+		copy = &v1.Secret{ObjectMeta: meta, Type: s.Type, Data: s.Data, Immutable: s.Immutable}
+	} else {
+		c := original.(*v1.ConfigMap)
+		copy = &v1.ConfigMap{ObjectMeta: meta, Data: c.Data, BinaryData: c.BinaryData, Immutable: c.Immutable}
+	}
+	// snapshot is garbage collected when the AppWrapper is deleted
+	if err := controllerutil.SetOwnerReference(appWrapper, copy, r.Scheme); err != nil {
+		return false, err
+	}
+	if err := r.Create(ctx, copy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return false, err
+	}
+	return true, nil
+}
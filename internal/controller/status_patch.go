@@ -0,0 +1,155 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Status writes patch the status fields owned by MCAD with a JSON merge patch instead of updating the status
+// The patch is conditioned on the resource version of the AppWrapper so a stale reconciliation cannot overwrite a newer status
+// On conflicts, the AppWrapper is re-read and the patch is reapplied if the transition is still valid
+// Conditions are merged per type: only the condition types owned by MCAD are changed, conditions of other types are kept
+
+// JSON names of the status fields owned by MCAD
+var ownedStatusFields = func() []string {
+	fields := []string{}
+	t := reflect.TypeOf(mcadv1beta1.AppWrapperStatus{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "conditions" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}()
+
+// Condition types owned by MCAD
+var ownedConditionTypes = []string{completionHookCondition, heartbeatCondition, policyCondition, preDispatchHookCondition,
+	preemptionCondition, queueSLOCondition, shrunkCondition, stuckCondition}
+
+// Conditions by type, nil for removed conditions
+type conditionChanges map[string]*metav1.Condition
+
+// Return the conditions owned by MCAD, nil for absent conditions
+func ownedConditions(conditions []metav1.Condition) conditionChanges {
+	changes := conditionChanges{}
+	for _, t := range ownedConditionTypes {
+		changes[t] = meta.FindStatusCondition(conditions, t)
+	}
+	return changes
+}
+
+// Apply the changes to a copy of the given conditions, preserving the order of existing conditions
+func (changes conditionChanges) apply(conditions []metav1.Condition) []metav1.Condition {
+	result := []metav1.Condition{}
+	for _, c := range conditions {
+		if change, ok := changes[c.Type]; !ok {
+			result = append(result, c)
+		} else if change != nil {
+			result = append(result, *change)
+		}
+	}
+	added := []string{}
+	for t, change := range changes {
+		if change != nil && meta.FindStatusCondition(conditions, t) == nil {
+			added = append(added, t)
+		}
+	}
+	sort.Strings(added) // deterministic order of added conditions
+	for _, t := range added {
+		result = append(result, *changes[t])
+	}
+	return result
+}
+
+// Patch the status fields owned by MCAD, clearing fields omitted from the AppWrapper status
+// Retry on conflicts if the AppWrapper spec and phase did not change concurrently
+func (r *AppWrapperReconciler) patchStatus(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, previous *mcadv1beta1.AppWrapperStatus) error {
+	// conditions owned by MCAD, reapplied to the latest conditions on conflicts
+	changes := ownedConditions(appWrapper.Status.Conditions)
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	for attempt := 0; ; attempt++ {
+		patch, err := statusPatch(appWrapper)
+		if err != nil {
+			return err
+		}
+		err = r.Status().Patch(ctx, appWrapper, client.RawPatch(types.MergePatchType, patch))
+		if err == nil || !apierrors.IsConflict(err) || attempt == maxStatusRetries {
+			return err
+		}
+		// re-read AppWrapper bypassing the reconciler cache and validate transition
+		latest := &mcadv1beta1.AppWrapper{}
+		if err := reader.Get(ctx, client.ObjectKeyFromObject(appWrapper), latest); err != nil {
+			return err
+		}
+		if latest.UID != appWrapper.UID || latest.Generation != appWrapper.Generation ||
+			latest.Status.Phase != previous.Phase || latest.Status.Step != previous.Step ||
+			latest.Status.TransitionCount != previous.TransitionCount {
+			return err // concurrent transition or spec change, requeue reconciliation
+		}
+		log.FromContext(ctx).Info("Retrying status update after conflict", "attempt", attempt+1)
+		appWrapper.ResourceVersion = latest.ResourceVersion
+		appWrapper.Status.Conditions = changes.apply(latest.Status.Conditions)
+	}
+}
+
+// Patch the status fields owned by MCAD without a phase transition
+func (r *AppWrapperReconciler) saveStatus(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	previous := appWrapper.Status // phase, step, and transition count are unchanged
+	return r.patchStatus(ctx, appWrapper, &previous)
+}
+
+// Make a merge patch of the status fields owned by MCAD conditioned on the resource version of the AppWrapper
+// The conditions are replaced, the resource version guarantees conditions of other types are current
+func statusPatch(appWrapper *mcadv1beta1.AppWrapper) ([]byte, error) {
+	data, err := json.Marshal(appWrapper.Status)
+	if err != nil {
+		return nil, err
+	}
+	status := map[string]interface{}{}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	for _, name := range ownedStatusFields {
+		if _, ok := status[name]; !ok {
+			status[name] = nil // null deletes the field
+		}
+	}
+	if _, ok := status["conditions"]; !ok {
+		status["conditions"] = nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"resourceVersion": appWrapper.ResourceVersion}, // optimistic lock
+		"status":   status,
+	})
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+func TestSaveStatusKeepsConcurrentConditions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(mcadv1beta1.AddToScheme(scheme))
+	appWrapper := &mcadv1beta1.AppWrapper{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "aw", UID: types.UID("aw")},
+		Status: mcadv1beta1.AppWrapperStatus{Phase: mcadv1beta1.Queued, Step: mcadv1beta1.Idle,
+			Conditions: []metav1.Condition{{Type: stuckCondition, Status: metav1.ConditionTrue, Reason: "Timeout"}}},
+	}
+	// the fake client ignores the resource version of merge patches, enforce it like the API server
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appWrapper).WithStatusSubresource(appWrapper).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResource string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				data, err := patch.Data(obj)
+				if err != nil {
+					return err
+				}
+				precondition := struct {
+					Metadata metav1.ObjectMeta `json:"metadata"`
+				}{}
+				if err := json.Unmarshal(data, &precondition); err != nil {
+					return err
+				}
+				current := &mcadv1beta1.AppWrapper{}
+				if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+					return err
+				}
+				if rv := precondition.Metadata.ResourceVersion; rv != "" && rv != current.ResourceVersion {
+					return apierrors.NewConflict(mcadv1beta1.GroupVersion.WithResource("appwrappers").GroupResource(), obj.GetName(), nil)
+				}
+				return c.SubResource(subResource).Patch(ctx, obj, patch, opts...)
+			},
+		}).Build()
+	r := &AppWrapperReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	stale := &mcadv1beta1.AppWrapper{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(appWrapper), stale); err != nil {
+		t.Fatal(err)
+	}
+	// concurrent writer adds a condition
+	external := stale.DeepCopy()
+	meta.SetStatusCondition(&external.Status.Conditions, metav1.Condition{Type: "External", Status: metav1.ConditionTrue, Reason: "Test"})
+	if err := c.Status().Update(ctx, external); err != nil {
+		t.Fatal(err)
+	}
+	stale.Status.ExpeditedBy = "control"
+	meta.RemoveStatusCondition(&stale.Status.Conditions, stuckCondition)
+	if err := r.saveStatus(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	latest := &mcadv1beta1.AppWrapper{}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(appWrapper), latest); err != nil {
+		t.Fatal(err)
+	}
+	if latest.Status.ExpeditedBy != "control" || !meta.IsStatusConditionTrue(latest.Status.Conditions, "External") ||
+		meta.FindStatusCondition(latest.Status.Conditions, stuckCondition) != nil {
+		t.Errorf("expedited by %q, conditions %v", latest.Status.ExpeditedBy, latest.Status.Conditions)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The admission webhook records the user creating an AppWrapper in the submitter annotation
+// Unlike labels, the annotation cannot be spoofed or modified once the webhook is deployed
+// MCAD copies the annotation to the status of new AppWrappers if configured to trust the webhook
+// and uses the recorded submitter for per-user queue limits, per-user allocation metrics, and the dispatch log
+// AppWrappers wrapped in other AppWrappers are created by MCAD and attributed to the submitter of their parent
+// AppWrappers generated from an AppWrapperSet or CronAppWrapper are created by MCAD and attributed to the submitter of their owner
+
+// Record the submitter of a new AppWrapper in its status
+func (r *AppWrapperReconciler) recordSubmitter(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	if !r.Config.RecordSubmitter || appWrapper.Status.Submitter != "" {
+		return nil
+	}
+	parent, err := r.parentAppWrapper(ctx, appWrapper)
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		appWrapper.Status.Submitter = parent.Status.Submitter
+		return nil
+	}
+	owner, err := r.generatingOwner(ctx, appWrapper)
+	if err != nil {
+		return err
+	}
+	if owner != nil {
+		appWrapper.Status.Submitter = owner.GetAnnotations()[mcadv1beta1.SubmitterAnnotation]
+	} else {
+		appWrapper.Status.Submitter = appWrapper.Annotations[mcadv1beta1.SubmitterAnnotation]
+	}
+	return nil
+}
+
+// Return the AppWrapperSet or CronAppWrapper that generated the AppWrapper, nil if none
+// The owner must be the controller of the AppWrapper, match the owner UID, and generate an AppWrapper with its name
+// so that owner references and labels alone cannot attribute an AppWrapper to another owner
+func (r *AppWrapperReconciler) generatingOwner(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (client.Object, error) {
+	ref := metav1.GetControllerOf(appWrapper)
+	if ref == nil {
+		return nil, nil
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != mcadv1beta1.GroupVersion.Group {
+		return nil, nil
+	}
+	var owner client.Object
+	switch ref.Kind {
+	case "AppWrapperSet":
+		if appWrapper.Labels[setLabel] != ref.Name || appWrapper.Name != ref.Name+"-"+appWrapper.Labels[indexLabel] {
+			return nil, nil
+		}
+		owner = &mcadv1beta1.AppWrapperSet{}
+	case "CronAppWrapper":
+		if appWrapper.Labels[cronLabel] != ref.Name || !strings.HasPrefix(appWrapper.Name, ref.Name+"-") {
+			return nil, nil
+		}
+		owner = &mcadv1beta1.CronAppWrapper{}
+	default:
+		return nil, nil
+	}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: appWrapper.Namespace, Name: ref.Name}, owner); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if owner.GetUID() != ref.UID {
+		return nil, nil
+	}
+	return owner, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+const failoverReason = "Failover" // event reason for AppWrappers evacuated from unhealthy targets
+
+// Return the name of the AppWrapper target if it has been unhealthy for longer than the outage timeout, "" otherwise
+func (r *AppWrapperReconciler) failedTarget(appWrapper *mcadv1beta1.AppWrapper) string {
+	if r.Config.TargetOutageTimeout <= 0 || appWrapper.Status.Target == localTarget {
+		return ""
+	}
+	if target := r.lookupTarget(appWrapper.Status.Target); target != nil && target.outage() > r.Config.TargetOutageTimeout {
+		return target.Name
+	}
+	return ""
+}
+
+// Requeue AppWrappers running on targets that have been unhealthy for longer than the outage timeout
+// The wrapped resources on these targets are abandoned
+func (r *AppWrapperReconciler) evacuateTargets(ctx context.Context) error {
+	failed := false
+	for _, target := range r.Targets {
+		failed = failed || target.outage() > r.Config.TargetOutageTimeout
+	}
+	if !failed {
+		return nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return err
+	}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		phase, step := r.getCachedPhase(appWrapper)
+		if phase != mcadv1beta1.Running || step == mcadv1beta1.Deleting {
+			continue
+		}
+		target := r.failedTarget(appWrapper)
+		if target == "" {
+			continue
+		}
+		appWrapper = appWrapper.DeepCopy() // deep copy AppWrapper before mutating
+		ctx := withAppWrapper(ctx, appWrapper)
+		if r.isStale(ctx, appWrapper) {
+			continue
+		}
+		message := fmt.Sprintf("target %s unhealthy for more than %v", target, r.Config.TargetOutageTimeout)
+		log.FromContext(ctx).Info("Evacuating", "target", target)
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, failoverReason, "Requeuing AppWrapper: "+message)
+		appWrapper.Status.RequeueTimestamp = metav1.Now()
+		if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// A namespace quota on a dispatch target caps the resources allocated to the AppWrappers of the namespace on the target
+// Targets with a quota for the namespace of an AppWrapper are preferred over other targets
+// Once the quota is exhausted, AppWrappers wait for the target unless spillover to other targets is enabled
+// AppWrappers that spilled over may be moved back to the preferred target once it frees up
+
+// Namespace quota on a dispatch target
+type TargetQuota struct {
+	// Namespace
+	Namespace string `json:"namespace"`
+
+	// Maximum resources allocated to the AppWrappers of the namespace on the target
+	Resources v1.ResourceList `json:"resources"`
+
+	// Permit dispatching AppWrappers of the namespace to other targets once the quota is exhausted
+	Spillover bool `json:"spillover,omitempty"`
+
+	// Requeue AppWrappers of the namespace running on other targets once they fit the quota and capacity of this target
+	Reclaim bool `json:"reclaim,omitempty"`
+}
+
+// Return the quota of the namespace on the target if any
+func (c *candidate) quota(namespace string) *TargetQuota {
+	for i := range c.properties.Quotas {
+		if c.properties.Quotas[i].Namespace == namespace {
+			return &c.properties.Quotas[i]
+		}
+	}
+	return nil
+}
+
+// Check whether request fits the quota of the namespace on the target if any
+func (c *candidate) fitsQuota(namespace string, request Weights) bool {
+	quota := c.quota(namespace)
+	if quota == nil {
+		return true
+	}
+	used := Weights{}
+	used.Add(c.usage[namespace])
+	used.Add(request)
+	for k, limit := range NewWeights(quota.Resources) {
+		if used.Get(k).Cmp(limit) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether the AppWrapper request fits the quota of its namespace on the target, quota-exempt AppWrappers always fit
+// The requests of quota-exempt AppWrappers still count toward the usage of their namespace
+func (r *AppWrapperReconciler) fitsTargetQuota(appWrapper *mcadv1beta1.AppWrapper, request Weights, c *candidate) bool {
+	return r.isQuotaExempt(appWrapper) || c.fitsQuota(appWrapper.Namespace, request)
+}
+
+// Compute resources allocated to each namespace on each target
+func targetUsage(allocations []mcadv1beta1.AllocationStatus) map[string]map[string]Weights {
+	usage := map[string]map[string]Weights{}
+	for _, allocation := range allocations {
+		if usage[allocation.Target] == nil {
+			usage[allocation.Target] = map[string]Weights{}
+		}
+		if usage[allocation.Target][allocation.Namespace] == nil {
+			usage[allocation.Target][allocation.Namespace] = Weights{}
+		}
+		usage[allocation.Target][allocation.Namespace].Add(NewWeights(allocation.Allocated))
+	}
+	return usage
+}
+
+// Requeue running AppWrappers that spilled over to other targets if they fit a preferred target with reclaim enabled
+// Requeued AppWrappers are accounted for so that the preferred target is not oversubscribed
+func (r *AppWrapperReconciler) reclaimSpilled(ctx context.Context, candidates []*candidate) error {
+	reclaiming := false
+	for _, c := range candidates {
+		for _, quota := range c.properties.Quotas {
+			reclaiming = reclaiming || quota.Reclaim
+		}
+	}
+	if !reclaiming {
+		return nil
+	}
+	appWrappers := &mcadv1beta1.AppWrapperList{}
+	if err := r.List(ctx, appWrappers, client.UnsafeDisableDeepCopy); err != nil {
+		return err
+	}
+	for i := range appWrappers.Items {
+		appWrapper := &appWrappers.Items[i]
+		phase, step := r.getCachedPhase(appWrapper)
+		if phase != mcadv1beta1.Running || step != mcadv1beta1.Created {
+			continue
+		}
+		// skip AppWrappers running on a target with a quota for their namespace
+		spilled := true
+		for _, c := range candidates {
+			if c.name == appWrapper.Status.Target && c.quota(appWrapper.Namespace) != nil {
+				spilled = false
+			}
+		}
+		if !spilled {
+			continue
+		}
+		request := r.fitRequest(aggregateRequests(appWrapper))
+		priority := int(appWrapper.Spec.Priority)
+		for _, c := range candidates {
+			quota := c.quota(appWrapper.Namespace)
+			if quota == nil || !quota.Reclaim || !isEligible(appWrapper, c) ||
+				!r.fitsTargetQuota(appWrapper, request, c) || !request.Fits(c.available[priority]) {
+				continue
+			}
+			appWrapper := appWrapper.DeepCopy() // deep copy AppWrapper before mutating
+			ctx := withAppWrapper(ctx, appWrapper)
+			if r.isStale(ctx, appWrapper) {
+				break
+			}
+			appWrapper.Status.RequeueTimestamp = metav1.Now()
+			if _, err := r.updateStatus(ctx, appWrapper, mcadv1beta1.Running, mcadv1beta1.Deleting, "moving to preferred target "+c.name); err != nil {
+				return err
+			}
+			// reserve capacity and quota on preferred target until next refresh
+			if c.usage == nil {
+				c.usage = map[string]Weights{}
+			}
+			if c.usage[appWrapper.Namespace] == nil {
+				c.usage[appWrapper.Namespace] = Weights{}
+			}
+			c.usage[appWrapper.Namespace].Add(request)
+			for p, available := range c.available {
+				if p <= priority {
+					available.Sub(request)
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
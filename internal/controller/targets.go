@@ -0,0 +1,213 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Dispatch targets are remote clusters MCAD may dispatch AppWrappers to in addition to the local cluster
+// The capacity of each target is refreshed independently on its own cadence
+
+// Placement properties of a dispatch target
+type TargetProperties struct {
+	// Target labels matched against AppWrapper cluster selectors and preferences
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Relative cost of dispatching to the target, lower is cheaper
+	Cost float64 `json:"cost,omitempty"`
+
+	// Namespace quotas on the target
+	Quotas []TargetQuota `json:"quotas,omitempty"`
+
+	// Target under maintenance, not eligible for new dispatches, running AppWrappers are migrated to other targets
+	Maintenance bool `json:"maintenance,omitempty"`
+
+	// Modifiers of the placement score of the target
+	Scoring ScoreModifiers `json:"scoring,omitempty"`
+}
+
+// Settings of one dispatch target
+type TargetConfig struct {
+	// Target name, must be unique and non-empty
+	Name string `json:"name"`
+
+	// Transport: Direct (default), ManifestWork, KubeStellar, or Agent
+	Transport string `json:"transport,omitempty"`
+
+	// Path to the kubeconfig file for the target cluster, the Open Cluster Management hub, the KubeStellar
+	// workload description space, or the agent hub depending on the transport, in-cluster configuration if empty
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// Path to the kubeconfig file for the KubeStellar inventory and transport space
+	InventoryKubeconfig string `json:"inventoryKubeconfig,omitempty"`
+
+	// Name of the managed cluster for the ManifestWork and KubeStellar transports, defaults to the target name
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// Namespace of the AppWrappers assigned to the target on the hub for the Agent transport, defaults to the target name
+	Namespace string `json:"namespace,omitempty"`
+
+	// How often to refresh the target capacity, defaults to clusterInfoTimeout
+	SyncPeriod metav1.Duration `json:"syncPeriod,omitempty"`
+
+	TargetProperties
+}
+
+// Dispatch targets file
+type TargetsConfig struct {
+	// Placement properties of the local cluster
+	Local TargetProperties `json:"local,omitempty"`
+
+	// Remote dispatch targets
+	Targets []TargetConfig `json:"targets"`
+}
+
+// Dispatch target
+type Target struct {
+	TargetConfig
+
+	// Transport for the target cluster
+	Transport Transport
+
+	mutex          sync.RWMutex
+	capacity       Weights              // capacity available to MCAD
+	nodes          map[string]*NodeInfo // schedulable nodes
+	time           time.Time            // last successful refresh
+	err            error                // reason the target is unhealthy if any
+	unhealthySince time.Time            // start of the current outage if any
+}
+
+// Load local cluster properties and dispatch targets from file and build transports
+func LoadTargets(path string, scheme *runtime.Scheme) (TargetProperties, []*Target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TargetProperties{}, nil, err
+	}
+	config := &TargetsConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return TargetProperties{}, nil, err
+	}
+	targets := []*Target{}
+	names := map[string]bool{}
+	for _, targetConfig := range config.Targets {
+		if targetConfig.Name == "" || targetConfig.Name == localTargetName || names[targetConfig.Name] {
+			return TargetProperties{}, nil, fmt.Errorf("missing, reserved, or duplicate target name %q", targetConfig.Name)
+		}
+		names[targetConfig.Name] = true
+		if targetConfig.SyncPeriod.Duration <= 0 {
+			targetConfig.SyncPeriod.Duration = clusterInfoTimeout
+		}
+		transport, err := newTransport(targetConfig, scheme)
+		if err != nil {
+			return TargetProperties{}, nil, fmt.Errorf("target %s: %w", targetConfig.Name, err)
+		}
+		targets = append(targets, &Target{TargetConfig: targetConfig, Transport: transport})
+	}
+	return config.Local, targets, nil
+}
+
+// Refresh target capacity and health periodically until context is canceled
+func (t *Target) Start(ctx context.Context) error {
+	for {
+		t.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(t.SyncPeriod.Duration):
+		}
+	}
+}
+
+// Refresh target capacity and health, keeping the last known capacity if the target is unreachable
+func (t *Target) refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, t.SyncPeriod.Duration)
+	defer cancel()
+	capacity, nodes, err := t.Transport.Capacity(ctx)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err != nil && t.err == nil {
+		t.unhealthySince = time.Now()
+		mcadLog.Error(err, "Target unhealthy", "target", t.Name)
+	} else if err == nil && t.err != nil {
+		mcadLog.Info("Target healthy", "target", t.Name)
+	}
+	t.err = err
+	updateTargetHealthMetric(t.Name, err == nil)
+	if capacity == nil {
+		return // unreachable
+	}
+	t.capacity, t.nodes = capacity, nodes
+	t.time = time.Now()
+	updateTargetMetrics(t.Name, t.capacity)
+}
+
+var errNoReadyNodes = errors.New("no ready schedulable nodes")
+
+// Count ready schedulable nodes
+func readyNodes(nodes []v1.Node) int {
+	count := 0
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Return the duration of the current outage, zero if the target is healthy
+func (t *Target) outage() time.Duration {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if t.err == nil {
+		return 0
+	}
+	return time.Since(t.unhealthySince)
+}
+
+// Return last known target capacity, schedulable nodes, refresh time, and reason the target is unhealthy if any
+// Capacity must not be mutated, node free capacity may be updated to account for placements until next refresh
+func (t *Target) Capacity() (Weights, map[string]*NodeInfo, time.Time, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.capacity, t.nodes, t.time, t.err
+}
+
+// Return the remote dispatch target with the given name, nil if none
+func (r *AppWrapperReconciler) lookupTarget(name string) *Target {
+	for _, target := range r.Targets {
+		if target.Name == name {
+			return target
+		}
+	}
+	return nil
+}
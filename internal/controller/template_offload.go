@@ -0,0 +1,158 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Oversized resource templates may be offloaded to ConfigMaps owned by the AppWrapper
+// Offloaded templates are loaded into the in-memory AppWrapper at the beginning of each reconciliation
+
+const templateKey = "template" // ConfigMap key for offloaded template
+
+// Name of ConfigMap holding the offloaded template of the i-th resource
+func templateConfigMapName(appWrapper *mcadv1beta1.AppWrapper, i int) string {
+	return appWrapper.Name + "-template-" + strconv.Itoa(i)
+}
+
+// Offload templates exceeding the maximum size or return the reason for rejecting the AppWrapper
+// Return true if the AppWrapper spec was updated
+func (r *AppWrapperReconciler) offloadTemplates(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (bool, string, error) {
+	if r.Config.MaxTemplateSize <= 0 {
+		return false, "", nil
+	}
+	offloaded := false
+	updated := appWrapper.DeepCopy() // do not mutate in-memory AppWrapper with loaded templates
+	for i := range updated.Spec.Resources.GenericItems {
+		resource := &updated.Spec.Resources.GenericItems[i]
+		if resource.GenericTemplateRef != nil {
+			resource.GenericTemplate = runtime.RawExtension{} // drop loaded template
+			continue
+		}
+		if len(resource.GenericTemplate.Raw) <= r.Config.MaxTemplateSize {
+			continue
+		}
+		if !r.Config.OffloadTemplates {
+			return false, fmt.Sprintf("resource template %d exceeds the maximum size of %d bytes", i, r.Config.MaxTemplateSize), nil
+		}
+		configMap := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: appWrapper.Namespace, Name: templateConfigMapName(appWrapper, i)},
+			Data:       map[string]string{templateKey: string(resource.GenericTemplate.Raw)},
+		}
+		if err := controllerutil.SetControllerReference(appWrapper, configMap, r.Scheme); err != nil {
+			return false, "", err
+		}
+		if err := r.Create(ctx, configMap); err != nil && !apierrors.IsAlreadyExists(err) {
+			return false, "", err
+		}
+		resource.GenericTemplateRef = &v1.ConfigMapKeySelector{
+			LocalObjectReference: v1.LocalObjectReference{Name: configMap.Name},
+			Key:                  templateKey,
+		}
+		resource.GenericTemplate = runtime.RawExtension{}
+		offloaded = true
+	}
+	if offloaded {
+		if err := r.Update(ctx, updated); err != nil {
+			return false, "", err
+		}
+		log.FromContext(ctx).Info("Offloaded resource templates")
+	}
+	return offloaded, "", nil
+}
+
+// Load offloaded templates into the in-memory AppWrapper
+// The in-memory AppWrapper must not be used to update the AppWrapper spec after loading templates
+// Missing ConfigMaps are tolerated for AppWrappers being deleted so they can still be finalized
+func (r *AppWrapperReconciler) loadTemplates(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	for i := range appWrapper.Spec.Resources.GenericItems {
+		resource := &appWrapper.Spec.Resources.GenericItems[i]
+		ref := resource.GenericTemplateRef
+		if ref == nil || resource.GenericTemplate.Raw != nil {
+			continue
+		}
+		configMap := &v1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: appWrapper.Namespace, Name: ref.Name}, configMap); err != nil {
+			if apierrors.IsNotFound(err) && !appWrapper.DeletionTimestamp.IsZero() {
+				continue // ConfigMap deleted first, wrapped resources are found by labels instead
+			}
+			return err
+		}
+		template, ok := configMap.Data[ref.Key]
+		if !ok {
+			return fmt.Errorf("key %s not found in ConfigMap %s", ref.Key, ref.Name)
+		}
+		resource.GenericTemplate.Raw = []byte(template)
+	}
+	return nil
+}
+
+// Check whether some offloaded template could not be loaded
+func missingTemplates(appWrapper *mcadv1beta1.AppWrapper) bool {
+	for _, resource := range appWrapper.Spec.Resources.GenericItems {
+		if resource.GenericTemplateRef != nil && resource.GenericTemplate.Raw == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// List the resources of the kinds created by MCAD that are labeled as belonging to the AppWrapper
+func (r *AppWrapperReconciler) labeledResources(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) ([]client.Object, error) {
+	reader := r.APIReader // do not start informers for arbitrary kinds
+	if reader == nil {
+		reader = r.Client
+	}
+	r.orphans.mutex.Lock()
+	kinds := []schema.GroupVersionKind{}
+	for gvk := range r.orphans.kinds {
+		kinds = append(kinds, gvk)
+	}
+	r.orphans.mutex.Unlock()
+	objects := []client.Object{}
+	for _, gvk := range kinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := reader.List(ctx, list, client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+			if meta.IsNoMatchError(err) || apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+	return objects, nil
+}
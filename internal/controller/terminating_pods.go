@@ -0,0 +1,75 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// Terminating pods, i.e., pods with a deletion timestamp, are accounted for consistently by capacity computations,
+// the reservations of requeuing AppWrappers, preemption, and the completion of the deletion of wrapped resources
+
+// TerminatingPodPolicy is the treatment of terminating pods in resource accounting
+type TerminatingPodPolicy string
+
+const (
+	// Count terminating pods until they are gone, requeuing AppWrappers wait for their pods to be gone
+	CountTerminating TerminatingPodPolicy = "Count"
+
+	// Count terminating pods until the end of their grace period
+	GracePeriodTerminating TerminatingPodPolicy = "GracePeriod"
+
+	// Ignore terminating pods immediately
+	IgnoreTerminating TerminatingPodPolicy = "Ignore"
+)
+
+// Parse terminating pod policy name
+func ParseTerminatingPodPolicy(s string) (TerminatingPodPolicy, error) {
+	switch p := TerminatingPodPolicy(s); p {
+	case CountTerminating, GracePeriodTerminating, IgnoreTerminating:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid terminating pod policy %q", s)
+}
+
+// Check whether pod consumes resources on its node
+// Pods that completed are ignored, terminating pods are counted according to the policy
+func consumesResources(pod *v1.Pod, policy TerminatingPodPolicy) bool {
+	if pod.Status.Phase == v1.PodFailed || pod.Status.Phase == v1.PodSucceeded {
+		return false
+	}
+	if pod.DeletionTimestamp == nil {
+		return true
+	}
+	switch policy {
+	case CountTerminating:
+		return true
+	case IgnoreTerminating:
+		return false
+	}
+	// deletion timestamp is the end of the grace period
+	return time.Now().Before(pod.DeletionTimestamp.Time)
+}
+
+// Check whether a terminating pod that has not completed is no longer accounted for according to the policy
+func isIgnoredTerminating(pod *v1.Pod, policy TerminatingPodPolicy) bool {
+	return pod.DeletionTimestamp != nil && pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodSucceeded &&
+		!consumesResources(pod, policy)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseTerminatingPodPolicy(t *testing.T) {
+	for _, s := range []string{"Count", "GracePeriod", "Ignore"} {
+		if p, err := ParseTerminatingPodPolicy(s); err != nil || string(p) != s {
+			t.Errorf("%s: got %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParseTerminatingPodPolicy("count"); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func TestConsumesResources(t *testing.T) {
+	pod := func(phase v1.PodPhase, deletion *time.Time) *v1.Pod {
+		pod := &v1.Pod{Status: v1.PodStatus{Phase: phase}}
+		if deletion != nil {
+			pod.DeletionTimestamp = &metav1.Time{Time: *deletion}
+		}
+		return pod
+	}
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	for _, tc := range []struct {
+		name     string
+		pod      *v1.Pod
+		policy   TerminatingPodPolicy
+		consumes bool
+		ignored  bool
+	}{
+		{"running", pod(v1.PodRunning, nil), IgnoreTerminating, true, false},
+		{"succeeded", pod(v1.PodSucceeded, nil), CountTerminating, false, false},
+		{"failed terminating", pod(v1.PodFailed, &future), CountTerminating, false, false},
+		{"count terminating", pod(v1.PodRunning, &past), CountTerminating, true, false},
+		{"ignore terminating", pod(v1.PodRunning, &future), IgnoreTerminating, false, true},
+		{"within grace period", pod(v1.PodRunning, &future), GracePeriodTerminating, true, false},
+		{"past grace period", pod(v1.PodRunning, &past), GracePeriodTerminating, false, true},
+	} {
+		if consumes := consumesResources(tc.pod, tc.policy); consumes != tc.consumes {
+			t.Errorf("%s: consumesResources got %v, want %v", tc.name, consumes, tc.consumes)
+		}
+		if ignored := isIgnoredTerminating(tc.pod, tc.policy); ignored != tc.ignored {
+			t.Errorf("%s: isIgnoredTerminating got %v, want %v", tc.name, ignored, tc.ignored)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// TieBreaker orders queued AppWrappers with equal priorities
+type TieBreaker string
+
+const (
+	// Oldest AppWrapper first
+	CreationTime TieBreaker = "CreationTime"
+
+	// Smallest GPU, then CPU, then memory request first
+	LeastRequested TieBreaker = "LeastRequested"
+
+	// Alternate between namespaces, oldest AppWrapper first in each namespace
+	RoundRobin TieBreaker = "RoundRobin"
+
+	// Random order
+	Random TieBreaker = "Random"
+)
+
+// Parse tie breaker name
+func ParseTieBreaker(s string) (TieBreaker, error) {
+	switch t := TieBreaker(s); t {
+	case CreationTime, LeastRequested, RoundRobin, Random:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid tie breaker %q", s)
+}
+
+// Sort queue with expedited AppWrappers first then by decreasing priority using tie breaker for equal priorities
+// Creation time is the last resort
+func sortQueue(queue []*mcadv1beta1.AppWrapper, tieBreaker TieBreaker) {
+	byCreation := func(i, j int) bool {
+		return queue[i].CreationTimestamp.Before(&queue[j].CreationTimestamp)
+	}
+	sort.SliceStable(queue, byCreation)
+	var less func(i, j int) bool
+	switch tieBreaker {
+	case LeastRequested:
+		requests := map[*mcadv1beta1.AppWrapper]Weights{}
+		for _, appWrapper := range queue {
+			requests[appWrapper] = aggregateRequests(appWrapper)
+		}
+		less = func(i, j int) bool {
+			for _, name := range packingOrder {
+				if c := requests[queue[i]].Cmp(requests[queue[j]], name); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		}
+	case RoundRobin:
+		// rank AppWrappers by creation time in each namespace and priority
+		ranks := map[*mcadv1beta1.AppWrapper]int{}
+		counts := map[string]int{}
+		for _, appWrapper := range queue {
+			key := fmt.Sprintf("%s/%d", appWrapper.Namespace, appWrapper.Spec.Priority)
+			ranks[appWrapper] = counts[key]
+			counts[key]++
+		}
+		less = func(i, j int) bool { return ranks[queue[i]] < ranks[queue[j]] }
+	case Random:
+		keys := map[*mcadv1beta1.AppWrapper]int{}
+		for _, appWrapper := range queue {
+			keys[appWrapper] = rand.Int()
+		}
+		less = func(i, j int) bool { return keys[queue[i]] < keys[queue[j]] }
+	default:
+		less = func(i, j int) bool { return false }
+	}
+	// stable sort preserves creation order among ties
+	sort.SliceStable(queue, func(i, j int) bool {
+		if expedited := queue[i].Status.ExpeditedBy != ""; expedited != (queue[j].Status.ExpeditedBy != "") {
+			return expedited
+		}
+		if queue[i].Spec.Priority != queue[j].Spec.Priority {
+			return queue[i].Spec.Priority > queue[j].Spec.Priority
+		}
+		return less(i, j)
+	})
+}
@@ -24,11 +24,25 @@ import (
 
 const (
 	// Timeouts
-	cacheConflictTimeout = 5 * time.Minute // minimum wait before invalidating the cache
-	clusterInfoTimeout   = time.Minute     // how often to refresh cluster capacity
+	cacheConflictTimeout    = 5 * time.Minute  // default minimum wait before a conflict is persistent
+	clusterInfoTimeout      = time.Minute      // how often to refresh cluster capacity
+	capacityRefreshDelay    = 5 * time.Second  // minimum wait between capacity refreshes triggered by pod changes
+	shutdownTimeout         = 20 * time.Second // maximum time spent completing in-flight dispatches on shutdown
+	phantomCapacityTimeout  = 5 * time.Minute  // how long to withhold capacity the scheduler could not use
+	targetRequestTimeout    = 30 * time.Second // maximum duration of requests to remote dispatch targets
+	agentHeartbeatTimeout   = 3 * time.Minute  // maximum age of the capacity published by a pull-based agent
+	scorerTimeout           = 2 * time.Second  // maximum duration of requests to the external placement scorer
+	dispatchLivenessTimeout = 20 * time.Minute // maximum time between dispatch evaluations, exceeds the max reconcile backoff
+	capacityStaleTimeout    = 5 * time.Minute  // maximum age of the cluster capacity used for dispatch
+	eventSaturationTimeout  = 30 * time.Second // maximum time the event channel may remain full
+	secretResolverTimeout   = 5 * time.Second  // maximum duration of requests to the external secret resolver
+	maxWebhookHookTimeout   = 30 * time.Second // maximum duration of webhook hook calls regardless of the hook timeout
 
 	// RequeueAfter delays
-	runDelay      = time.Minute     // how often to force check running AppWrapper health
-	dispatchDelay = time.Minute     // how often to force dispatch
-	deletionDelay = 5 * time.Second // how often to check deleted resources
+	runDelay             = time.Minute     // how often to force check running AppWrapper health
+	dispatchDelay        = time.Minute     // how often to force dispatch
+	deletionDelay        = 5 * time.Second // how often to check deleted resources
+	prePullDelay         = 5 * time.Second // how often to check image pre-pull progress
+	probeDelay           = time.Second     // how often to check probe pod placement
+	dispatchControlDelay = 5 * time.Second // how often to check the progress of DispatchControl actions
 )
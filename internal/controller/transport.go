@@ -0,0 +1,178 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Transport creates, updates, deletes, and monitors the wrapped resources of AppWrappers on a dispatch target
+// Wrapped resources are always handled through the transport of the AppWrapper target
+// Pod-level features (pod counts, probes, checkpoints, artifacts, forced deletion) require direct access to the target
+type Transport interface {
+	// Create object on target, return an AlreadyExists error if the object exists
+	Create(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error
+
+	// Get last observed state of object on target, return a NotFound error if the object does not exist
+	Get(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error
+
+	// Update object on target
+	Update(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error
+
+	// Request deletion of object on target, return a NotFound error if the object does not exist
+	Delete(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object, opts ...client.DeleteOption) error
+
+	// Observe target capacity and free capacity of each node if visible, return an error if the target is unhealthy
+	Capacity(ctx context.Context) (Weights, map[string]*NodeInfo, error)
+
+	// Return a client with direct access to the target, nil if the transport does not permit direct access
+	Client() client.Client
+}
+
+// Transport kinds
+const (
+	DirectTransport       = "Direct"
+	ManifestWorkTransport = "ManifestWork"
+	KubeStellarTransport  = "KubeStellar"
+	AgentTransport        = "Agent"
+)
+
+// Build transport for dispatch target
+func newTransport(config TargetConfig, scheme *runtime.Scheme) (Transport, error) {
+	c, err := newClient(config.Kubeconfig, scheme)
+	if err != nil {
+		return nil, err
+	}
+	clusterName := config.ClusterName
+	if clusterName == "" {
+		clusterName = config.Name
+	}
+	switch config.Transport {
+	case "", DirectTransport:
+		return &directTransport{client: c}, nil
+	case ManifestWorkTransport:
+		return &manifestWorkTransport{hub: c, clusterName: clusterName}, nil
+	case KubeStellarTransport:
+		inventory, err := newClient(config.InventoryKubeconfig, scheme)
+		if err != nil {
+			return nil, err
+		}
+		return &kubeStellarTransport{wds: c, inventory: inventory, clusterName: clusterName}, nil
+	case AgentTransport:
+		namespace := config.Namespace
+		if namespace == "" {
+			namespace = config.Name
+		}
+		return &agentTransport{hub: c, target: config.Name, namespace: namespace}, nil
+	}
+	return nil, fmt.Errorf("invalid transport %q", config.Transport)
+}
+
+// Build client from kubeconfig file, use in-cluster configuration if path is empty
+func newClient(kubeconfig string, scheme *runtime.Scheme) (client.Client, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	if restConfig.Timeout == 0 {
+		restConfig.Timeout = targetRequestTimeout
+	}
+	return client.New(restConfig, client.Options{Scheme: scheme})
+}
+
+// Transport with direct access to the target API server
+type directTransport struct {
+	client client.Client
+}
+
+func (t *directTransport) Create(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	return t.client.Create(ctx, obj)
+}
+
+func (t *directTransport) Get(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	return t.client.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+}
+
+func (t *directTransport) Update(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	return t.client.Update(ctx, obj)
+}
+
+func (t *directTransport) Delete(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object, opts ...client.DeleteOption) error {
+	return t.client.Delete(ctx, obj, opts...)
+}
+
+// Compute capacity from nodes and pods, a target is healthy if it has at least one ready schedulable node
+func (t *directTransport) Capacity(ctx context.Context) (Weights, map[string]*NodeInfo, error) {
+	nodes := &v1.NodeList{}
+	if err := t.client.List(ctx, nodes); err != nil {
+		return nil, nil, err
+	}
+	pods := &v1.PodList{}
+	if err := t.client.List(ctx, pods); err != nil {
+		return nil, nil, err
+	}
+	podsByNode := map[string][]v1.Pod{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod)
+		}
+	}
+	capacity, nodeInfos := nodeCapacity(nodes.Items, podsByNode, GracePeriodTerminating)
+	if readyNodes(nodes.Items) == 0 {
+		return capacity, nodeInfos, errNoReadyNodes
+	}
+	return capacity, nodeInfos, nil
+}
+
+func (t *directTransport) Client() client.Client {
+	return t.client
+}
+
+// Return the transport for the dispatch target of the AppWrapper
+func (r *AppWrapperReconciler) transport(appWrapper *mcadv1beta1.AppWrapper) (Transport, error) {
+	if appWrapper.Status.Target == localTarget {
+		return &directTransport{client: r.Client}, nil
+	}
+	if target := r.lookupTarget(appWrapper.Status.Target); target != nil {
+		return target.Transport, nil
+	}
+	return nil, fmt.Errorf("unknown dispatch target %q", appWrapper.Status.Target)
+}
+
+// Return a client with direct access to the dispatch target of the AppWrapper
+// Return nil if the target transport does not permit direct access
+func (r *AppWrapperReconciler) targetClient(appWrapper *mcadv1beta1.AppWrapper) (client.Client, error) {
+	t, err := r.transport(appWrapper)
+	if err != nil {
+		return nil, err
+	}
+	return t.Client(), nil
+}
+
+// Check whether the pods of the AppWrapper are visible on its dispatch target
+func (r *AppWrapperReconciler) observesPods(appWrapper *mcadv1beta1.AppWrapper) bool {
+	c, err := r.targetClient(appWrapper)
+	return err == nil && c != nil
+}
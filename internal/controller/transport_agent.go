@@ -0,0 +1,262 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The Agent transport dispatches to clusters that cannot accept inbound connections from the hub
+// The wrapped resources of an AppWrapper are listed in an AppWrapper assigned to the target in a namespace on the hub
+// An agent running in the target cluster watches this namespace, creates and deletes the resources locally,
+// reports their status in the assigned AppWrapper, and publishes the target capacity in a ClusterInfo on the hub
+
+const assignedLabel = "workload.codeflare.dev/assigned-to" // target of an AppWrapper assigned to a pull-based agent
+
+type agentTransport struct {
+	hub       client.Client // client for the hub
+	target    string        // target name
+	namespace string        // namespace of the assigned AppWrappers on the hub
+}
+
+// Name of the ClusterInfo published by the agent of the target
+func agentClusterInfoName(target string) string {
+	return "mcad-agent-" + target
+}
+
+// Check whether the AppWrapper is assigned to a pull-based agent, such AppWrappers are ignored by the dispatcher
+func isAssigned(appWrapper *mcadv1beta1.AppWrapper) bool {
+	_, ok := appWrapper.Labels[assignedLabel]
+	return ok
+}
+
+// Get the AppWrapper assigned to the agent for the AppWrapper, return an empty AppWrapper and a NotFound error if missing
+func (t *agentTransport) getAssignment(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (*mcadv1beta1.AppWrapper, error) {
+	assignment := &mcadv1beta1.AppWrapper{}
+	err := t.hub.Get(ctx, types.NamespacedName{Namespace: t.namespace, Name: remoteName(appWrapper)}, assignment)
+	if apierrors.IsNotFound(err) {
+		assignment.Namespace = t.namespace
+		assignment.Name = remoteName(appWrapper)
+		assignment.Labels = map[string]string{assignedLabel: t.target, namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}
+	}
+	return assignment, err
+}
+
+// Find the index of the item of the assigned AppWrapper matching the manifest, -1 if none
+func findItem(assignment *mcadv1beta1.AppWrapper, manifest map[string]interface{}) int {
+	for i, item := range assignment.Spec.Resources.GenericItems {
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(item.GenericTemplate.Raw, &m); err == nil && sameResource(m, manifest) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find the resource reported by the agent matching the manifest if any
+func findReport(assignment *mcadv1beta1.AppWrapper, manifest map[string]interface{}) *mcadv1beta1.ReportedResource {
+	for i, report := range assignment.Status.ReportedResources {
+		if sameResource(reportedManifest(report), manifest) {
+			return &assignment.Status.ReportedResources[i]
+		}
+	}
+	return nil
+}
+
+// Convert reported resource to manifest with identifying fields only
+func reportedManifest(report mcadv1beta1.ReportedResource) map[string]interface{} {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(report.APIVersion)
+	u.SetKind(report.Kind)
+	u.SetNamespace(report.Namespace)
+	u.SetName(report.Name)
+	return u.Object
+}
+
+// Convert manifest to assigned AppWrapper item
+func toItem(manifest map[string]interface{}) (mcadv1beta1.GenericItem, error) {
+	raw, err := json.Marshal(manifest)
+	return mcadv1beta1.GenericItem{GenericTemplate: runtime.RawExtension{Raw: raw}}, err
+}
+
+func (t *agentTransport) Create(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	assignment, err := t.getAssignment(ctx, appWrapper)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if findItem(assignment, manifest) >= 0 {
+		return alreadyExists(manifest)
+	}
+	item, err := toItem(manifest)
+	if err != nil {
+		return err
+	}
+	assignment.Spec.Resources.GenericItems = append(assignment.Spec.Resources.GenericItems, item)
+	if assignment.ResourceVersion == "" {
+		return t.hub.Create(ctx, assignment)
+	}
+	return t.hub.Update(ctx, assignment)
+}
+
+func (t *agentTransport) Get(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	target, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	assignment, err := t.getAssignment(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(target)
+		}
+		return err
+	}
+	content := target
+	i := findItem(assignment, target)
+	report := findReport(assignment, target)
+	if i >= 0 {
+		content = map[string]interface{}{}
+		if err := json.Unmarshal(assignment.Spec.Resources.GenericItems[i].GenericTemplate.Raw, &content); err != nil {
+			return err
+		}
+	} else if report == nil {
+		return notFound(target)
+	}
+	// add reported status if any
+	if report != nil && len(report.Status.Raw) > 0 {
+		status := map[string]interface{}{}
+		if err := json.Unmarshal(report.Status.Raw, &status); err == nil {
+			content["status"] = status
+		}
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetUnstructuredContent(content)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj)
+}
+
+func (t *agentTransport) Update(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	assignment, err := t.getAssignment(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(manifest)
+		}
+		return err
+	}
+	i := findItem(assignment, manifest)
+	if i < 0 {
+		return notFound(manifest)
+	}
+	if assignment.Spec.Resources.GenericItems[i], err = toItem(manifest); err != nil {
+		return err
+	}
+	return t.hub.Update(ctx, assignment)
+}
+
+// Remove the item from the assigned AppWrapper, the agent deletes the resource on the target
+// The resource exists until the agent no longer reports it, the assigned AppWrapper is deleted once empty
+// Delete options are ignored
+func (t *agentTransport) Delete(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object, _ ...client.DeleteOption) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	assignment, err := t.getAssignment(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(manifest)
+		}
+		return err
+	}
+	if i := findItem(assignment, manifest); i >= 0 {
+		items := assignment.Spec.Resources.GenericItems
+		assignment.Spec.Resources.GenericItems = append(items[:i], items[i+1:]...)
+		return t.hub.Update(ctx, assignment)
+	}
+	if findReport(assignment, manifest) != nil {
+		return nil // deletion in progress
+	}
+	if len(assignment.Spec.Resources.GenericItems) == 0 && len(assignment.Status.ReportedResources) == 0 {
+		if err := t.hub.Delete(ctx, assignment); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return notFound(manifest)
+}
+
+// Report the capacity published by the agent, the target is unhealthy if the agent stops publishing
+// Node-level capacity is not visible
+func (t *agentTransport) Capacity(ctx context.Context) (Weights, map[string]*NodeInfo, error) {
+	clusterInfo := &mcadv1beta1.ClusterInfo{}
+	if err := t.hub.Get(ctx, types.NamespacedName{Name: agentClusterInfoName(t.target)}, clusterInfo); err != nil {
+		return nil, nil, err
+	}
+	capacity := NewWeights(clusterInfo.Status.Capacity)
+	if time.Since(clusterInfo.Status.Time.Time) > agentHeartbeatTimeout {
+		return capacity, nil, errors.New("agent last reported at " + clusterInfo.Status.Time.Format(time.RFC3339))
+	}
+	for _, status := range clusterInfo.Status.Targets {
+		if !status.Healthy {
+			return capacity, nil, errors.New(status.Error)
+		}
+	}
+	return capacity, nil, nil
+}
+
+func (t *agentTransport) Client() client.Client {
+	return nil
+}
+
+// Publish the capacity and health of the target cluster for the hub
+func publishAgentClusterInfo(ctx context.Context, hub client.Client, target string, capacity Weights, nodes int, err error) error {
+	clusterInfo := &mcadv1beta1.ClusterInfo{}
+	if err := hub.Get(ctx, types.NamespacedName{Name: agentClusterInfoName(target)}, clusterInfo); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		clusterInfo = &mcadv1beta1.ClusterInfo{ObjectMeta: metav1.ObjectMeta{Name: agentClusterInfoName(target)}}
+		if err := hub.Create(ctx, clusterInfo); err != nil {
+			return err
+		}
+	}
+	status := mcadv1beta1.TargetStatus{Name: target, Time: metav1.Now(), Capacity: capacity.AsResources(), Nodes: int32(nodes), Healthy: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	clusterInfo.Status = mcadv1beta1.ClusterInfoStatus{Time: status.Time, Capacity: status.Capacity, Targets: []mcadv1beta1.TargetStatus{status}}
+	return hub.Status().Update(ctx, clusterInfo)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The KubeStellar transport creates the wrapped resources of an AppWrapper in a workload description space
+// A binding policy per target downsyncs the resources labeled with the target name to the managed cluster
+// and requests the singleton reported state so that resource statuses are visible in the workload description space
+
+var bindingPolicyGVK = schema.GroupVersionKind{Group: "control.kubestellar.io", Version: "v1alpha1", Kind: "BindingPolicy"}
+
+const targetLabel = "workload.codeflare.dev/target" // target label for resources created in the workload description space
+
+type kubeStellarTransport struct {
+	wds         client.Client // client for the workload description space
+	inventory   client.Client // client for the inventory and transport space
+	clusterName string        // managed cluster name
+}
+
+// Create binding policy for the target if missing
+func (t *kubeStellarTransport) ensureBindingPolicy(ctx context.Context) error {
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"clusterSelectors": []interface{}{map[string]interface{}{
+				"matchLabels": map[string]interface{}{"name": t.clusterName},
+			}},
+			"downsync": []interface{}{map[string]interface{}{
+				"objectSelectors": []interface{}{map[string]interface{}{
+					"matchLabels": map[string]interface{}{targetLabel: t.clusterName},
+				}},
+				"wantSingletonReportedState": true,
+			}},
+		},
+	}}
+	policy.SetGroupVersionKind(bindingPolicyGVK)
+	policy.SetName("mcad-" + t.clusterName)
+	if err := t.wds.Create(ctx, policy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (t *kubeStellarTransport) Create(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	if err := t.ensureBindingPolicy(ctx); err != nil {
+		return err
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[targetLabel] = t.clusterName
+	obj.SetLabels(labels)
+	return t.wds.Create(ctx, obj)
+}
+
+func (t *kubeStellarTransport) Get(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	return t.wds.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+}
+
+func (t *kubeStellarTransport) Update(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object) error {
+	return t.wds.Update(ctx, obj)
+}
+
+func (t *kubeStellarTransport) Delete(ctx context.Context, _ *mcadv1beta1.AppWrapper, obj client.Object, opts ...client.DeleteOption) error {
+	return t.wds.Delete(ctx, obj, opts...)
+}
+
+func (t *kubeStellarTransport) Capacity(ctx context.Context) (Weights, map[string]*NodeInfo, error) {
+	return managedClusterCapacity(ctx, t.inventory, t.clusterName)
+}
+
+func (t *kubeStellarTransport) Client() client.Client {
+	return nil
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// The ManifestWork transport dispatches the wrapped resources of an AppWrapper to an Open Cluster Management
+// managed cluster by means of one ManifestWork in the cluster namespace on the hub
+// The status of each wrapped resource is reported back using a raw JSON status feedback rule,
+// which requires the RawFeedbackJsonString feature gate
+
+var (
+	manifestWorkGVK   = schema.GroupVersionKind{Group: "work.open-cluster-management.io", Version: "v1", Kind: "ManifestWork"}
+	managedClusterGVK = schema.GroupVersionKind{Group: "cluster.open-cluster-management.io", Version: "v1", Kind: "ManagedCluster"}
+)
+
+const statusFeedback = "status" // name of the status feedback value
+
+type manifestWorkTransport struct {
+	hub         client.Client // client for the hub
+	clusterName string        // managed cluster name
+}
+
+// Name of the ManifestWork or assigned AppWrapper representing the AppWrapper on a remote target
+func remoteName(appWrapper *mcadv1beta1.AppWrapper) string {
+	return "mcad-" + string(appWrapper.UID)
+}
+
+// Get the ManifestWork for the AppWrapper, return an empty ManifestWork and a NotFound error if missing
+func (t *manifestWorkTransport) getWork(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (*unstructured.Unstructured, error) {
+	work := &unstructured.Unstructured{}
+	work.SetGroupVersionKind(manifestWorkGVK)
+	work.SetNamespace(t.clusterName)
+	work.SetName(remoteName(appWrapper))
+	err := t.hub.Get(ctx, client.ObjectKeyFromObject(work), work)
+	if apierrors.IsNotFound(err) {
+		work.SetLabels(map[string]string{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name})
+	}
+	return work, err
+}
+
+// Convert object to manifest, dropping status and server-populated metadata
+func toManifest(obj client.Object, scheme *runtime.Scheme) (map[string]interface{}, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	manifest = runtime.DeepCopyJSON(manifest)
+	manifest["apiVersion"], manifest["kind"] = gvk.GroupVersion().String(), gvk.Kind
+	delete(manifest, "status")
+	for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields"} {
+		unstructured.RemoveNestedField(manifest, "metadata", field)
+	}
+	return manifest, nil
+}
+
+// Find the index of the manifest matching the object, -1 if none
+func findManifest(manifests []interface{}, target map[string]interface{}) int {
+	for i, m := range manifests {
+		manifest, _ := m.(map[string]interface{})
+		if sameResource(manifest, target) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Check whether two unstructured objects designate the same resource
+func sameResource(a, b map[string]interface{}) bool {
+	ua, ub := &unstructured.Unstructured{Object: a}, &unstructured.Unstructured{Object: b}
+	return ua.GroupVersionKind().GroupKind() == ub.GroupVersionKind().GroupKind() &&
+		ua.GetNamespace() == ub.GetNamespace() && ua.GetName() == ub.GetName()
+}
+
+// Replace the manifests of the ManifestWork, requesting status feedback for each manifest
+func setManifests(work *unstructured.Unstructured, manifests []interface{}) error {
+	configs := []interface{}{}
+	for _, m := range manifests {
+		manifest := &unstructured.Unstructured{Object: m.(map[string]interface{})}
+		gvk := manifest.GroupVersionKind()
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		configs = append(configs, map[string]interface{}{
+			"resourceIdentifier": map[string]interface{}{
+				"group": gvk.Group, "resource": plural.Resource,
+				"namespace": manifest.GetNamespace(), "name": manifest.GetName(),
+			},
+			"feedbackRules": []interface{}{map[string]interface{}{
+				"type":      "JSONPaths",
+				"jsonPaths": []interface{}{map[string]interface{}{"name": statusFeedback, "path": ".status"}},
+			}},
+		})
+	}
+	if err := unstructured.SetNestedSlice(work.Object, manifests, "spec", "workload", "manifests"); err != nil {
+		return err
+	}
+	return unstructured.SetNestedSlice(work.Object, configs, "spec", "manifestConfigs")
+}
+
+// Return a NotFound error for the object
+func notFound(obj map[string]interface{}) error {
+	u := &unstructured.Unstructured{Object: obj}
+	return apierrors.NewNotFound(schema.GroupResource{Group: u.GroupVersionKind().Group, Resource: u.GetKind()}, u.GetName())
+}
+
+// Return an AlreadyExists error for the object
+func alreadyExists(obj map[string]interface{}) error {
+	u := &unstructured.Unstructured{Object: obj}
+	return apierrors.NewAlreadyExists(schema.GroupResource{Group: u.GroupVersionKind().Group, Resource: u.GetKind()}, u.GetName())
+}
+
+func (t *manifestWorkTransport) Create(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	work, err := t.getWork(ctx, appWrapper)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	manifests, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+	if findManifest(manifests, manifest) >= 0 {
+		return alreadyExists(manifest)
+	}
+	if err := setManifests(work, append(manifests, manifest)); err != nil {
+		return err
+	}
+	if work.GetResourceVersion() == "" {
+		return t.hub.Create(ctx, work)
+	}
+	return t.hub.Update(ctx, work)
+}
+
+func (t *manifestWorkTransport) Get(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	target, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	work, err := t.getWork(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(target)
+		}
+		return err
+	}
+	manifests, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+	i := findManifest(manifests, target)
+	if i < 0 {
+		return notFound(target)
+	}
+	content := manifests[i].(map[string]interface{})
+	// add reported status if any
+	statuses, _, _ := unstructured.NestedSlice(work.Object, "status", "resourceStatus", "manifests")
+	for _, s := range statuses {
+		status, _ := s.(map[string]interface{})
+		resourceMeta, _, _ := unstructured.NestedMap(status, "resourceMeta")
+		group, _, _ := unstructured.NestedString(resourceMeta, "group")
+		kind, _, _ := unstructured.NestedString(resourceMeta, "kind")
+		namespace, _, _ := unstructured.NestedString(resourceMeta, "namespace")
+		name, _, _ := unstructured.NestedString(resourceMeta, "name")
+		u := &unstructured.Unstructured{Object: content}
+		if group != u.GroupVersionKind().Group || kind != u.GetKind() || namespace != u.GetNamespace() || name != u.GetName() {
+			continue
+		}
+		values, _, _ := unstructured.NestedSlice(status, "statusFeedback", "values")
+		for _, v := range values {
+			value, _ := v.(map[string]interface{})
+			if value["name"] != statusFeedback {
+				continue
+			}
+			if raw, ok, _ := unstructured.NestedString(value, "fieldValue", "jsonRaw"); ok {
+				reported := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(raw), &reported); err == nil {
+					content["status"] = reported
+				}
+			}
+		}
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetUnstructuredContent(content)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj)
+}
+
+func (t *manifestWorkTransport) Update(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	work, err := t.getWork(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(manifest)
+		}
+		return err
+	}
+	manifests, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+	i := findManifest(manifests, manifest)
+	if i < 0 {
+		return notFound(manifest)
+	}
+	manifests[i] = manifest
+	if err := setManifests(work, manifests); err != nil {
+		return err
+	}
+	return t.hub.Update(ctx, work)
+}
+
+// Remove the manifest from the ManifestWork, the work agent deletes the resource on the managed cluster
+// Delete options are ignored
+func (t *manifestWorkTransport) Delete(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, obj client.Object, _ ...client.DeleteOption) error {
+	manifest, err := toManifest(obj, t.hub.Scheme())
+	if err != nil {
+		return err
+	}
+	work, err := t.getWork(ctx, appWrapper)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return notFound(manifest)
+		}
+		return err
+	}
+	manifests, _, _ := unstructured.NestedSlice(work.Object, "spec", "workload", "manifests")
+	i := findManifest(manifests, manifest)
+	if i < 0 {
+		return notFound(manifest)
+	}
+	manifests = append(manifests[:i], manifests[i+1:]...)
+	if len(manifests) == 0 {
+		return client.IgnoreNotFound(t.hub.Delete(ctx, work))
+	}
+	if err := setManifests(work, manifests); err != nil {
+		return err
+	}
+	return t.hub.Update(ctx, work)
+}
+
+func (t *manifestWorkTransport) Capacity(ctx context.Context) (Weights, map[string]*NodeInfo, error) {
+	return managedClusterCapacity(ctx, t.hub, t.clusterName)
+}
+
+func (t *manifestWorkTransport) Client() client.Client {
+	return nil
+}
+
+// Report the allocatable capacity of a managed cluster, a managed cluster is healthy if it is available
+// Node-level capacity is not visible
+func managedClusterCapacity(ctx context.Context, c client.Client, name string) (Weights, map[string]*NodeInfo, error) {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(managedClusterGVK)
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, cluster); err != nil {
+		return nil, nil, err
+	}
+	allocatable, _, _ := unstructured.NestedStringMap(cluster.Object, "status", "allocatable")
+	resources := v1.ResourceList{}
+	for k, v := range allocatable {
+		if quantity, err := resource.ParseQuantity(v); err == nil {
+			resources[v1.ResourceName(k)] = quantity
+		}
+	}
+	capacity := NewWeights(resources)
+	conditions, _, _ := unstructured.NestedSlice(cluster.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, _ := c.(map[string]interface{})
+		if condition["type"] == "ManagedClusterConditionAvailable" && condition["status"] == "True" {
+			return capacity, nil, nil
+		}
+	}
+	return capacity, nil, errors.New("managed cluster " + name + " is not available")
+}
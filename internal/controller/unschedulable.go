@@ -0,0 +1,107 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// Capacity the scheduler could not use for the pods of an AppWrapper
+type phantomCapacity struct {
+	requests Weights   // requests of the unschedulable pods
+	expiry   time.Time // when to forget phantom capacity
+}
+
+// Check whether the scheduler message reports a lack of resources as opposed to, e.g., unsatisfiable selectors
+func insufficientResources(message string) bool {
+	return strings.Contains(message, "Insufficient ") || strings.Contains(message, "Too many pods")
+}
+
+// Find AppWrapper pods reported unschedulable by the scheduler for longer than the unschedulable timeout
+// Return the scheduler message for one of these pods and the total requests of the pods lacking resources
+func (r *AppWrapperReconciler) unschedulablePods(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) (string, Weights, error) {
+	c, err := r.targetClient(appWrapper)
+	if err != nil || c == nil {
+		return "", nil, err // pods are not visible
+	}
+	pods := &v1.PodList{}
+	if err := c.List(ctx, pods, client.UnsafeDisableDeepCopy,
+		client.MatchingLabels{namespaceLabel: appWrapper.Namespace, nameLabel: appWrapper.Name}); err != nil {
+		return "", nil, err
+	}
+	message := ""
+	requests := Weights{}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != v1.PodPending || pod.Spec.NodeName != "" {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable &&
+				time.Now().After(condition.LastTransitionTime.Add(r.Config.UnschedulableTimeout)) {
+				if message == "" {
+					message = condition.Message
+				}
+				if !insufficientResources(condition.Message) {
+					continue // capacity was not overestimated
+				}
+				for _, container := range pod.Spec.Containers {
+					requests.Add(NewWeights(container.Resources.Requests))
+				}
+			}
+		}
+	}
+	return message, addGPUType(requests, appWrapper.Spec.GPUType), nil
+}
+
+// Withhold capacity the dispatcher overestimated from future dispatch decisions
+// Phantom capacity is tracked per AppWrapper, a new report replaces the previous report for the same AppWrapper
+// Phantom capacity expires after phantomCapacityTimeout
+func (r *AppWrapperReconciler) addPhantomCapacity(appWrapper *mcadv1beta1.AppWrapper, requests Weights) {
+	if r.phantom == nil {
+		r.phantom = map[types.UID]*phantomCapacity{}
+	}
+	now := time.Now()
+	if r.ClusterCapacity != nil {
+		// until next capacity refresh
+		if previous, ok := r.phantom[appWrapper.UID]; ok && now.Before(previous.expiry) {
+			r.ClusterCapacity.Add(previous.requests)
+		}
+		r.ClusterCapacity.Sub(requests)
+	}
+	r.phantom[appWrapper.UID] = &phantomCapacity{requests: requests, expiry: now.Add(phantomCapacityTimeout)}
+	mcadLog.Info("Phantom capacity", "namespace", appWrapper.Namespace, "name", appWrapper.Name, "capacity", requests)
+}
+
+// Subtract unexpired phantom capacity from capacity, forget expired phantom capacity
+func (r *AppWrapperReconciler) applyPhantomCapacity(capacity Weights) {
+	now := time.Now()
+	for uid, phantom := range r.phantom {
+		if now.After(phantom.expiry) {
+			delete(r.phantom, uid)
+			continue
+		}
+		capacity.Sub(phantom.requests)
+	}
+}
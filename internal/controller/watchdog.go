@@ -0,0 +1,121 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	mcadv1beta1 "github.com/tardieu/mcad/api/v1beta1"
+)
+
+// StuckPolicy is the response to AppWrappers stuck creating or deleting resources
+type StuckPolicy string
+
+const (
+	// Report stuck AppWrappers using events and conditions
+	ReportStuck StuckPolicy = "Report"
+
+	// Report stuck AppWrappers and consider stuck deletions complete, abandoning remaining resources
+	// Requeuing AppWrappers are never abandoned as they would be dispatched again while holding resources
+	ForceFinalize StuckPolicy = "ForceFinalize"
+)
+
+// Parse stuck policy name
+func ParseStuckPolicy(s string) (StuckPolicy, error) {
+	switch p := StuckPolicy(s); p {
+	case ReportStuck, ForceFinalize:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid stuck policy %q", s)
+}
+
+const stuckCondition = "Stuck" // condition type for stuck AppWrappers
+
+// Check whether AppWrapper has been creating or deleting resources for longer than the stuck timeout
+func (r *AppWrapperReconciler) isStuck(appWrapper *mcadv1beta1.AppWrapper) bool {
+	if r.Config.StuckTimeout <= 0 {
+		return false
+	}
+	var since metav1.Time
+	if !appWrapper.DeletionTimestamp.IsZero() {
+		since = *appWrapper.DeletionTimestamp
+	} else if step := appWrapper.Status.Step; step == mcadv1beta1.Creating || step == mcadv1beta1.Deleting {
+		if n := len(appWrapper.Status.Transitions); n > 0 {
+			since = appWrapper.Status.Transitions[n-1].Time
+		}
+	} else {
+		return false
+	}
+	return time.Now().After(since.Add(r.Config.StuckTimeout))
+}
+
+// Set or clear the stuck condition of the AppWrapper, emit an event when the AppWrapper becomes stuck
+func (r *AppWrapperReconciler) watchdog(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper) error {
+	condition := metav1.Condition{Type: stuckCondition, Status: metav1.ConditionFalse, Reason: "Progressing"}
+	if r.isStuck(appWrapper) {
+		step := appWrapper.Status.Step
+		if !appWrapper.DeletionTimestamp.IsZero() {
+			step = mcadv1beta1.Deleting
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Timeout"
+		condition.Message = fmt.Sprintf("AppWrapper has been %s resources for more than %v", step, r.Config.StuckTimeout)
+	} else if !meta.IsStatusConditionTrue(appWrapper.Status.Conditions, stuckCondition) {
+		return nil // only record condition once stuck
+	}
+	if existing := meta.FindStatusCondition(appWrapper.Status.Conditions, stuckCondition); existing != nil &&
+		existing.Status == condition.Status && existing.Reason == condition.Reason {
+		return nil
+	}
+	meta.SetStatusCondition(&appWrapper.Status.Conditions, condition)
+	spec := appWrapper.Spec
+	if err := r.saveStatus(ctx, appWrapper); err != nil {
+		return err
+	}
+	appWrapper.Spec = spec // the updated AppWrapper does not include loaded templates
+	if condition.Status == metav1.ConditionTrue {
+		log.FromContext(ctx).Info("Stuck", "step", appWrapper.Status.Step)
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, stuckCondition, condition.Message)
+	}
+	return nil
+}
+
+// Delete wrapped resources, return true once deleted or abandoned according to stuck policy or target outage
+func (r *AppWrapperReconciler) deleteOrAbandon(ctx context.Context, appWrapper *mcadv1beta1.AppWrapper, timestamp metav1.Time) bool {
+	if target := r.failedTarget(appWrapper); target != "" {
+		log.FromContext(ctx).Info("Abandoning remaining resources on unhealthy target", "target", target)
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, failoverReason, "Abandoning remaining resources on unhealthy target "+target)
+		return true
+	}
+	if r.deleteResources(ctx, appWrapper, timestamp) {
+		return true
+	}
+	requeuing := appWrapper.DeletionTimestamp.IsZero() && appWrapper.Status.Phase == mcadv1beta1.Running
+	if r.Config.StuckPolicy == ForceFinalize && r.isStuck(appWrapper) && !requeuing {
+		log.FromContext(ctx).Info("Abandoning remaining resources")
+		r.Recorder.Event(appWrapper, v1.EventTypeWarning, stuckCondition, "Abandoning remaining resources")
+		return true
+	}
+	return false
+}
@@ -17,91 +17,15 @@ limitations under the License.
 package controller
 
 import (
-	"gopkg.in/inf.v0"
-
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/tardieu/mcad/pkg/weights"
 )
 
 // Weights represent a set of resource requests or available resources
-// Quantities are encoded as *inf.Dec to maintain precision and make arithmetic easy
-type Weights map[v1.ResourceName]*inf.Dec
+type Weights = weights.Weights
 
 // Converts a ResourceList to Weights
 func NewWeights(r v1.ResourceList) Weights {
-	w := Weights{}
-	for k, v := range r {
-		w[k] = v.AsDec() // should be lossless
-	}
-	return w
-}
-
-// Add weights to receiver
-func (w Weights) Add(r Weights) {
-	for k, v := range r {
-		if w[k] == nil {
-			w[k] = &inf.Dec{} // fresh zero
-		}
-		w[k].Add(w[k], v)
-	}
-}
-
-// Subtract weights from receiver
-func (w Weights) Sub(r Weights) {
-	for k, v := range r {
-		if w[k] == nil {
-			w[k] = &inf.Dec{} // fresh zero
-		}
-		w[k].Sub(w[k], v)
-	}
-}
-
-// Add coefficient * weights to receiver
-func (w Weights) AddProd(coefficient int32, r Weights) {
-	for k, v := range r {
-		if w[k] == nil {
-			w[k] = &inf.Dec{} // fresh zero
-		}
-		tmp := inf.NewDec(int64(coefficient), 0)
-		tmp.Mul(tmp, v)
-		w[k].Add(w[k], tmp)
-	}
-}
-
-// Update receiver to max of receiver and argument in each dimension
-func (w Weights) Max(r Weights) {
-	for k, v := range r {
-		if w[k] == nil {
-			w[k] = &inf.Dec{} // fresh zero
-		}
-		if w[k].Cmp(v) == -1 {
-			w[k].Set(v) // w[k] = v would not be correct due to aliasing
-		}
-	}
-}
-
-// Compare receiver to argument
-// True if receiver is less than or equal to argument in every dimension
-func (w Weights) Fits(r Weights) bool {
-	zero := &inf.Dec{}    // shared zero, never mutated
-	for k, v := range w { // range over receiver not argument
-		// ignore 0 requests in case r does not contain k
-		if v.Cmp(zero) <= 0 {
-			continue
-		}
-		// v > 0 so r[k] must be defined and no less than v
-		if r[k] == nil || v.Cmp(r[k]) == 1 {
-			return false
-		}
-	}
-	return true
-}
-
-// Converts Weights to a ResourceList
-func (w Weights) AsResources() v1.ResourceList {
-	resources := v1.ResourceList{}
-	for k, v := range w {
-		resources[k] = *resource.NewDecimalQuantity(*v, resource.DecimalSI)
-	}
-	return resources
+	return weights.New(r)
 }
@@ -0,0 +1,226 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package weights implements the resource arithmetic shared by quotas, reservations, and dispatching decisions.
+//
+// Weights map resource names to quantities encoded as arbitrary-precision decimals. Arithmetic is exact and never
+// overflows, however large the GPU counts or memory sizes. Conversions to fixed-size types report out-of-range
+// values instead of wrapping around. Missing resource names stand for zero quantities in every operation.
+package weights
+
+import (
+	"math/big"
+	"strconv"
+
+	"gopkg.in/inf.v0"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Weights represent a set of resource requests or available resources
+// Quantities are encoded as *inf.Dec to maintain precision and make arithmetic easy
+type Weights map[v1.ResourceName]*inf.Dec
+
+// Converts a ResourceList to Weights
+func New(r v1.ResourceList) Weights {
+	w := Weights{}
+	for k, v := range r {
+		w[k] = v.AsDec() // should be lossless
+	}
+	return w
+}
+
+// Return a deep copy of receiver
+func (w Weights) Clone() Weights {
+	c := Weights{}
+	c.Add(w)
+	return c
+}
+
+// Add weights to receiver
+func (w Weights) Add(r Weights) {
+	for k, v := range r {
+		if w[k] == nil {
+			w[k] = &inf.Dec{} // fresh zero
+		}
+		w[k].Add(w[k], v)
+	}
+}
+
+// Subtract weights from receiver
+func (w Weights) Sub(r Weights) {
+	for k, v := range r {
+		if w[k] == nil {
+			w[k] = &inf.Dec{} // fresh zero
+		}
+		w[k].Sub(w[k], v)
+	}
+}
+
+// Add coefficient * weights to receiver
+func (w Weights) AddProd(coefficient int32, r Weights) {
+	for k, v := range r {
+		if w[k] == nil {
+			w[k] = &inf.Dec{} // fresh zero
+		}
+		tmp := inf.NewDec(int64(coefficient), 0)
+		tmp.Mul(tmp, v)
+		w[k].Add(w[k], tmp)
+	}
+}
+
+// Update receiver to max of receiver and argument in each dimension
+func (w Weights) Max(r Weights) {
+	for k, v := range r {
+		if w[k] == nil {
+			w[k] = &inf.Dec{} // fresh zero
+		}
+		if w[k].Cmp(v) == -1 {
+			w[k].Set(v) // w[k] = v would not be correct due to aliasing
+		}
+	}
+}
+
+// Update receiver to min of receiver and argument in each dimension
+// Quantities missing from the argument are zero
+func (w Weights) Min(r Weights) {
+	zero := &inf.Dec{} // shared zero, never mutated
+	for k, v := range w {
+		m := r.Get(k)
+		if v.Cmp(m) == 1 {
+			v.Set(m) // v = m would not be correct due to aliasing
+		}
+	}
+	for k, v := range r {
+		if w[k] == nil && v.Cmp(zero) == -1 {
+			w[k] = &inf.Dec{}
+			w[k].Set(v)
+		}
+	}
+}
+
+// Compare receiver to argument
+// True if receiver is less than or equal to argument in every dimension
+func (w Weights) Fits(r Weights) bool {
+	zero := &inf.Dec{}    // shared zero, never mutated
+	for k, v := range w { // range over receiver not argument
+		// ignore 0 requests in case r does not contain k
+		if v.Cmp(zero) <= 0 {
+			continue
+		}
+		// v > 0 so r[k] must be defined and no less than v
+		if r[k] == nil || v.Cmp(r[k]) == 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Return quantity for resource name or zero if missing
+// The returned quantity must not be mutated
+func (w Weights) Get(name v1.ResourceName) *inf.Dec {
+	if v, ok := w[name]; ok {
+		return v
+	}
+	return &inf.Dec{}
+}
+
+// Compare the quantities of receiver and argument for resource name
+// Return -1, 0, or +1 if receiver is less than, equal to, or greater than argument
+func (w Weights) Cmp(r Weights, name v1.ResourceName) int {
+	return w.Get(name).Cmp(r.Get(name))
+}
+
+// Check whether receiver and argument are equal in every dimension
+func (w Weights) Equal(r Weights) bool {
+	for k := range w {
+		if w.Cmp(r, k) != 0 {
+			return false
+		}
+	}
+	for k := range r {
+		if w.Cmp(r, k) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether receiver is zero in every dimension
+func (w Weights) IsZero() bool {
+	for _, v := range w {
+		if v.Sign() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether receiver is negative in some dimension
+func (w Weights) IsNegative() bool {
+	for _, v := range w {
+		if v.Sign() < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Return quantity for resource name rounded up to an integer
+// False if the rounded quantity does not fit an int64
+func (w Weights) Int64(name v1.ResourceName) (int64, bool) {
+	rounded := new(inf.Dec).Round(w.Get(name), 0, inf.RoundCeil)
+	i := rounded.UnscaledBig()
+	if !i.IsInt64() {
+		return 0, false
+	}
+	return i.Int64(), true
+}
+
+// Return quantity for resource name as a float
+// Quantities too large for a float64 are returned as +Inf or -Inf
+func (w Weights) Float64(name v1.ResourceName) float64 {
+	f, _ := strconv.ParseFloat(w.Get(name).String(), 64) // ParseFloat returns ±Inf on overflow
+	return f
+}
+
+// Return the dominant share of receiver relative to the given capacity
+// Resources with no positive capacity are ignored
+func (w Weights) DominantShare(capacity Weights) float64 {
+	share := 0.0
+	for k := range w {
+		total := capacity.Get(k)
+		if total.Sign() <= 0 {
+			continue
+		}
+		q, _ := new(big.Rat).SetString(w.Get(k).String())
+		t, _ := new(big.Rat).SetString(total.String())
+		if s, _ := q.Quo(q, t).Float64(); s > share {
+			share = s
+		}
+	}
+	return share
+}
+
+// Converts Weights to a ResourceList
+func (w Weights) AsResources() v1.ResourceList {
+	resources := v1.ResourceList{}
+	for k, v := range w {
+		resources[k] = *resource.NewDecimalQuantity(*v, resource.DecimalSI)
+	}
+	return resources
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2023 IBM Corporation.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package weights
+
+import (
+	"math"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const gpu = v1.ResourceName("nvidia.com/gpu")
+
+func parse(resources map[v1.ResourceName]string) Weights {
+	list := v1.ResourceList{}
+	for k, v := range resources {
+		list[k] = resource.MustParse(v)
+	}
+	return New(list)
+}
+
+func TestArithmetic(t *testing.T) {
+	w := parse(map[v1.ResourceName]string{v1.ResourceCPU: "500m", gpu: "2"})
+	w.Add(parse(map[v1.ResourceName]string{v1.ResourceCPU: "1500m", v1.ResourceMemory: "1Gi"}))
+	if want := parse(map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "1Gi", gpu: "2"}); !w.Equal(want) {
+		t.Errorf("Add: got %v, want %v", w.AsResources(), want.AsResources())
+	}
+	w.Sub(parse(map[v1.ResourceName]string{v1.ResourceCPU: "3", gpu: "2"}))
+	if want := parse(map[v1.ResourceName]string{v1.ResourceCPU: "-1", v1.ResourceMemory: "1Gi"}); !w.Equal(want) {
+		t.Errorf("Sub: got %v, want %v", w.AsResources(), want.AsResources())
+	}
+	if !w.IsNegative() {
+		t.Errorf("IsNegative: got false, want true")
+	}
+	w.AddProd(4, parse(map[v1.ResourceName]string{v1.ResourceCPU: "250m", gpu: "1"}))
+	if want := parse(map[v1.ResourceName]string{v1.ResourceMemory: "1Gi", gpu: "4"}); !w.Equal(want) {
+		t.Errorf("AddProd: got %v, want %v", w.AsResources(), want.AsResources())
+	}
+	w.Max(parse(map[v1.ResourceName]string{v1.ResourceMemory: "512Mi", gpu: "8", v1.ResourceCPU: "1"}))
+	if want := parse(map[v1.ResourceName]string{v1.ResourceCPU: "1", v1.ResourceMemory: "1Gi", gpu: "8"}); !w.Equal(want) {
+		t.Errorf("Max: got %v, want %v", w.AsResources(), want.AsResources())
+	}
+}
+
+func TestMaxDoesNotAlias(t *testing.T) {
+	w := Weights{}
+	r := parse(map[v1.ResourceName]string{gpu: "1"})
+	w.Max(r)
+	w.Add(r)
+	if got := r.Get(gpu).String(); got != "1" {
+		t.Errorf("argument mutated: got %s, want 1", got)
+	}
+}
+
+func TestMin(t *testing.T) {
+	w := parse(map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "1Gi", gpu: "4"})
+	r := parse(map[v1.ResourceName]string{v1.ResourceCPU: "3", gpu: "1", v1.ResourcePods: "-1"})
+	w.Min(r)
+	if want := parse(map[v1.ResourceName]string{v1.ResourceCPU: "2", gpu: "1", v1.ResourcePods: "-1"}); !w.Equal(want) || !want.Equal(w) {
+		t.Errorf("Min: got %v, want %v", w.AsResources(), want.AsResources())
+	}
+	w.Add(w)
+	if got := r.Get(gpu).String(); got != "1" {
+		t.Errorf("argument mutated: got %s, want 1", got)
+	}
+}
+
+func TestClone(t *testing.T) {
+	w := parse(map[v1.ResourceName]string{gpu: "1"})
+	c := w.Clone()
+	c.Add(w)
+	if got := w.Get(gpu).String(); got != "1" {
+		t.Errorf("receiver mutated: got %s, want 1", got)
+	}
+}
+
+func TestFits(t *testing.T) {
+	capacity := parse(map[v1.ResourceName]string{v1.ResourceCPU: "4", gpu: "8"})
+	tests := []struct {
+		name    string
+		request map[v1.ResourceName]string
+		fits    bool
+	}{
+		{"empty", map[v1.ResourceName]string{}, true},
+		{"equal", map[v1.ResourceName]string{v1.ResourceCPU: "4", gpu: "8"}, true},
+		{"smaller", map[v1.ResourceName]string{v1.ResourceCPU: "1"}, true},
+		{"zero missing resource", map[v1.ResourceName]string{v1.ResourceMemory: "0"}, true},
+		{"negative missing resource", map[v1.ResourceName]string{v1.ResourceMemory: "-1"}, true},
+		{"missing resource", map[v1.ResourceName]string{v1.ResourceMemory: "1"}, false},
+		{"larger", map[v1.ResourceName]string{gpu: "9"}, false},
+		{"fraction larger", map[v1.ResourceName]string{v1.ResourceCPU: "4001m"}, false},
+	}
+	for _, test := range tests {
+		if got := parse(test.request).Fits(capacity); got != test.fits {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.fits)
+		}
+	}
+}
+
+func TestHugeQuantities(t *testing.T) {
+	huge := parse(map[v1.ResourceName]string{v1.ResourceMemory: "8Ei", gpu: "9223372036854775807"})
+	w := huge.Clone()
+	w.AddProd(math.MaxInt32, huge)
+	w.Add(huge)
+	if !huge.Fits(w) || w.Fits(huge) {
+		t.Errorf("Fits: arithmetic overflowed")
+	}
+	if _, ok := w.Int64(gpu); ok {
+		t.Errorf("Int64: got ok for out-of-range quantity")
+	}
+	if got := w.Float64(v1.ResourceMemory); math.IsInf(got, 0) || got <= 8*math.Pow(2, 60) {
+		t.Errorf("Float64: got %v", got)
+	}
+	w.Sub(huge)
+	w.AddProd(-math.MaxInt32, huge)
+	if !w.Equal(huge) {
+		t.Errorf("Sub: got %v, want %v", w.AsResources(), huge.AsResources())
+	}
+	if q := w.AsResources()[gpu]; q.String() != "9223372036854775807" {
+		t.Errorf("AsResources: got %s", q.String())
+	}
+}
+
+func TestConversions(t *testing.T) {
+	w := parse(map[v1.ResourceName]string{v1.ResourceCPU: "1500m", gpu: "1e3"})
+	if got, ok := w.Int64(v1.ResourceCPU); !ok || got != 2 {
+		t.Errorf("Int64: got %d, %v, want 2, true", got, ok)
+	}
+	if got, ok := w.Int64(gpu); !ok || got != 1000 {
+		t.Errorf("Int64: got %d, %v, want 1000, true", got, ok)
+	}
+	if got, ok := w.Int64(v1.ResourceMemory); !ok || got != 0 {
+		t.Errorf("Int64: got %d, %v, want 0, true", got, ok)
+	}
+	if got := w.Float64(v1.ResourceCPU); got != 1.5 {
+		t.Errorf("Float64: got %v, want 1.5", got)
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	a := parse(map[v1.ResourceName]string{v1.ResourceCPU: "1", gpu: "0"})
+	b := parse(map[v1.ResourceName]string{v1.ResourceCPU: "1000m"})
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Errorf("Equal: got false, want true")
+	}
+	if c := a.Cmp(parse(map[v1.ResourceName]string{v1.ResourceCPU: "2"}), v1.ResourceCPU); c != -1 {
+		t.Errorf("Cmp: got %d, want -1", c)
+	}
+	if c := a.Cmp(Weights{}, v1.ResourceCPU); c != 1 {
+		t.Errorf("Cmp: got %d, want 1", c)
+	}
+	if !parse(map[v1.ResourceName]string{gpu: "0"}).IsZero() || a.IsZero() {
+		t.Errorf("IsZero: wrong result")
+	}
+	if !(Weights{}).IsZero() {
+		t.Errorf("IsZero: empty weights are not zero")
+	}
+}
+
+func TestDominantShare(t *testing.T) {
+	capacity := parse(map[v1.ResourceName]string{v1.ResourceCPU: "8", gpu: "4", v1.ResourceMemory: "0"})
+	w := parse(map[v1.ResourceName]string{v1.ResourceCPU: "2", gpu: "3", v1.ResourceMemory: "1Gi", "example.com/nic": "1"})
+	if got := w.DominantShare(capacity); got != 0.75 {
+		t.Errorf("DominantShare: got %v, want 0.75", got)
+	}
+	if got := (Weights{}).DominantShare(capacity); got != 0 {
+		t.Errorf("DominantShare: got %v, want 0", got)
+	}
+}